@@ -0,0 +1,120 @@
+package common
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AdjustmentSize is the binary size of an Adjustment.
+const AdjustmentSize = 24
+
+// Adjustment is a corporate action, such as a split or dividend, effective from EffectiveTime.
+// Candles before EffectiveTime are adjusted by multiplying prices by PriceFactor and volumes by VolumeFactor.
+// For example, a 2:1 split has a price factor of 0.5 and a volume factor of 2.
+type Adjustment struct {
+	EffectiveTime int64
+	PriceFactor   float64
+	VolumeFactor  float64
+}
+
+func (a Adjustment) Effective() time.Time {
+	return time.Unix(a.EffectiveTime, 0).UTC()
+}
+
+func (a *Adjustment) Read(_ uint32, r io.Reader) error {
+	bin := make([]byte, AdjustmentSize)
+	n, err := io.ReadFull(r, bin)
+	if n < AdjustmentSize {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	a.EffectiveTime = int64(binary.LittleEndian.Uint64(bin[0:8]))
+	a.PriceFactor = Float64frombytes(bin[8:16])
+	a.VolumeFactor = Float64frombytes(bin[16:24])
+	return nil
+}
+
+func (a *Adjustment) Write(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, a.EffectiveTime); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, a.PriceFactor); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, a.VolumeFactor); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AdjustmentList is a list of adjustments sorted by EffectiveTime, with at most one adjustment per time.
+type AdjustmentList []Adjustment
+
+func (a AdjustmentList) Copy() AdjustmentList {
+	result := make(AdjustmentList, len(a))
+	copy(result, a)
+	return result
+}
+
+// Upsert adds the adjustment, replacing any adjustment with the same EffectiveTime.
+func (a *AdjustmentList) Upsert(adjustment Adjustment) error {
+	if adjustment.PriceFactor <= 0 || adjustment.VolumeFactor <= 0 {
+		return errors.New("adjustment factors should be positive")
+	}
+	index := sort.Search(len(*a), func(i int) bool { return (*a)[i].EffectiveTime >= adjustment.EffectiveTime })
+	if index < len(*a) && (*a)[index].EffectiveTime == adjustment.EffectiveTime {
+		(*a)[index] = adjustment
+		return nil
+	}
+	*a = append(*a, Adjustment{})
+	copy((*a)[index+1:], (*a)[index:])
+	(*a)[index] = adjustment
+	return nil
+}
+
+// Remove removes the adjustment with the EffectiveTime, returning if it existed.
+func (a *AdjustmentList) Remove(effectiveTime int64) bool {
+	for i, adjustment := range *a {
+		if adjustment.EffectiveTime == effectiveTime {
+			*a = append((*a)[:i], (*a)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns adjusted copies of the candles, by cumulatively applying the factors of
+// all adjustments effective after each candle. Adjusted candles are marked with FlagAdjusted.
+func (a AdjustmentList) Apply(candles CandleList) CandleList {
+	result := make(CandleList, len(candles))
+	for i, candle := range candles {
+		result[i] = candle
+		priceFactor, volumeFactor, applied := a.factorsAt(candle.Timestamp.Unix())
+		if !applied {
+			continue
+		}
+		result[i].Open *= priceFactor
+		result[i].High *= priceFactor
+		result[i].Low *= priceFactor
+		result[i].Close *= priceFactor
+		result[i].Volume *= volumeFactor
+		result[i].SetFlags(FlagAdjusted)
+	}
+	return result
+}
+
+func (a AdjustmentList) factorsAt(ts int64) (priceFactor, volumeFactor float64, applied bool) {
+	priceFactor, volumeFactor = 1, 1
+	index := sort.Search(len(a), func(i int) bool { return a[i].EffectiveTime > ts })
+	for _, adjustment := range a[index:] {
+		priceFactor *= adjustment.PriceFactor
+		volumeFactor *= adjustment.VolumeFactor
+	}
+	return priceFactor, volumeFactor, index < len(a)
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdjustmentListUpsert(t *testing.T) {
+	list := AdjustmentList{}
+	for _, adjustment := range []Adjustment{
+		{EffectiveTime: 300, PriceFactor: 0.5, VolumeFactor: 2},
+		{EffectiveTime: 100, PriceFactor: 0.9, VolumeFactor: 1},
+		{EffectiveTime: 200, PriceFactor: 0.8, VolumeFactor: 1},
+		// Replaces the adjustment with the same time, so applying it again changes nothing
+		{EffectiveTime: 300, PriceFactor: 0.25, VolumeFactor: 4},
+		{EffectiveTime: 300, PriceFactor: 0.25, VolumeFactor: 4},
+	} {
+		if err := list.Upsert(adjustment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(list) != 3 || list[0].EffectiveTime != 100 || list[1].EffectiveTime != 200 || list[2].PriceFactor != 0.25 {
+		t.Errorf("unexpected adjustments %v", list)
+	}
+	if err := list.Upsert(Adjustment{EffectiveTime: 400, PriceFactor: 0, VolumeFactor: 1}); err == nil {
+		t.Error("expected a zero factor to be rejected")
+	}
+
+	if !list.Remove(200) || list.Remove(200) || len(list) != 2 {
+		t.Errorf("expected 200 to be removed once, got %v", list)
+	}
+}
+
+func TestAdjustmentListApply(t *testing.T) {
+	split := time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC)
+	dividend := time.Date(2022, 3, 3, 0, 0, 0, 0, time.UTC)
+	list := AdjustmentList{
+		{EffectiveTime: split.Unix(), PriceFactor: 0.5, VolumeFactor: 2},
+		{EffectiveTime: dividend.Unix(), PriceFactor: 0.9, VolumeFactor: 1},
+	}
+	candle := TimelessCandle{Open: 100, High: 100, Low: 100, Close: 100, Volume: 10}
+	candles := CandleList{
+		{Timestamp: split.Add(-time.Minute), TimelessCandle: candle},
+		{Timestamp: split, TimelessCandle: candle},
+		{Timestamp: dividend, TimelessCandle: candle},
+	}
+
+	result := list.Apply(candles)
+	// Factors of every adjustment effective after the candle are multiplied
+	if result[0].Close != 45 || result[0].Volume != 20 || !result[0].HasFlags(FlagAdjusted) {
+		t.Errorf("expected both adjustments applied, got %v", result[0])
+	}
+	if result[1].Close != 90 || result[1].Volume != 10 || !result[1].HasFlags(FlagAdjusted) {
+		t.Errorf("expected only the dividend applied, got %v", result[1])
+	}
+	if result[2].TimelessCandle != candle {
+		t.Errorf("expected no adjustment, got %v", result[2])
+	}
+	if candles[0].Close != 100 {
+		t.Error("expected the candles to be left unchanged")
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"io"
 )
 
+// TimestampCandleSize is the binary size of a TimestampCandle.
+const TimestampCandleSize = 52
+
 func (t *TimestampCandle) Write(w io.Writer) error {
 	if err := binary.Write(w, binary.LittleEndian, t.Timestamp); err != nil {
 		return err
@@ -31,15 +34,15 @@ func (t *TimestampCandle) Write(w io.Writer) error {
 }
 
 func (t *TimestampCandle) Read(_ uint32, r io.Reader) error {
-	bin := make([]byte, 52)
-	n, err := r.Read(bin)
-	if n < 52 || len(bin) < 52 {
+	bin := make([]byte, TimestampCandleSize)
+	n, err := io.ReadFull(r, bin)
+	if n < TimestampCandleSize {
 		return io.EOF
 	}
 	if err != nil {
 		return err
 	}
-	t.Timestamp = int64(binary.LittleEndian.Uint32(bin[0:8]))
+	t.Timestamp = int64(binary.LittleEndian.Uint64(bin[0:8]))
 	t.TimelessCandle = TimelessCandle{
 		BitFields: binary.BigEndian.Uint32(bin[8:12]),
 		Open:      Float64frombytes(bin[12:20]),
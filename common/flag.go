@@ -0,0 +1,129 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CandleFlag is a bit mask over TimelessCandle.BitFields.
+type CandleFlag uint32
+
+// Built-in flags. Bits below firstUserFlagBit are reserved for built-in flags.
+const (
+	// FlagIncomplete marks a candle whose period has not ended yet
+	FlagIncomplete CandleFlag = 1 << 0
+	// FlagSynthetic marks a candle filled in for a period without trades
+	FlagSynthetic CandleFlag = 1 << 1
+	// FlagAdjusted marks a candle with prices adjusted for corporate actions
+	FlagAdjusted CandleFlag = 1 << 2
+	// FlagCorrected marks a candle corrected after it was first written
+	FlagCorrected CandleFlag = 1 << 3
+)
+
+const firstUserFlagBit = 16
+
+type flagRegistry struct {
+	accessLock sync.RWMutex
+	byName     map[string]CandleFlag
+	names      map[CandleFlag]string
+	nextBit    int
+}
+
+var flags = flagRegistry{
+	byName: map[string]CandleFlag{
+		"incomplete": FlagIncomplete,
+		"synthetic":  FlagSynthetic,
+		"adjusted":   FlagAdjusted,
+		"corrected":  FlagCorrected,
+	},
+	names: map[CandleFlag]string{
+		FlagIncomplete: "incomplete",
+		FlagSynthetic:  "synthetic",
+		FlagAdjusted:   "adjusted",
+		FlagCorrected:  "corrected",
+	},
+	nextBit: firstUserFlagBit,
+}
+
+// RegisterFlag allocates a user flag with the given name.
+// Flags are not persisted, so they should be registered in the same order on every start.
+func RegisterFlag(name string) (CandleFlag, error) {
+	flags.accessLock.Lock()
+	defer flags.accessLock.Unlock()
+
+	if _, ok := flags.byName[name]; ok {
+		return 0, errors.Errorf("flag '%s' is already registered", name)
+	}
+	if flags.nextBit >= 32 {
+		return 0, errors.Errorf("no bits left to register flag '%s'", name)
+	}
+	flag := CandleFlag(1) << flags.nextBit
+	flags.nextBit++
+	flags.byName[name] = flag
+	flags.names[flag] = name
+	return flag, nil
+}
+
+// FlagByName looks up a built-in or registered flag.
+func FlagByName(name string) (CandleFlag, bool) {
+	flags.accessLock.RLock()
+	defer flags.accessLock.RUnlock()
+	flag, ok := flags.byName[name]
+	return flag, ok
+}
+
+// String lists the names of the set flags, with unnamed bits in hex.
+func (f CandleFlag) String() string {
+	flags.accessLock.RLock()
+	defer flags.accessLock.RUnlock()
+
+	names := make([]string, 0)
+	for bit := 0; bit < 32; bit++ {
+		flag := CandleFlag(1) << bit
+		if f&flag == 0 {
+			continue
+		}
+		if name, ok := flags.names[flag]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("0x%x", uint32(flag)))
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+func (t TimelessCandle) Flags() CandleFlag {
+	return CandleFlag(t.BitFields)
+}
+
+// HasFlags returns if all flags of the mask are set.
+func (t TimelessCandle) HasFlags(mask CandleFlag) bool {
+	return t.Flags()&mask == mask
+}
+
+// HasAnyFlag returns if any flag of the mask is set.
+func (t TimelessCandle) HasAnyFlag(mask CandleFlag) bool {
+	return t.Flags()&mask != 0
+}
+
+func (t *TimelessCandle) SetFlags(mask CandleFlag) {
+	t.BitFields |= uint32(mask)
+}
+
+func (t *TimelessCandle) ClearFlags(mask CandleFlag) {
+	t.BitFields &^= uint32(mask)
+}
+
+// FilterFlags returns candles having all flags of include and none of exclude.
+func (c CandleList) FilterFlags(include, exclude CandleFlag) CandleList {
+	result := make(CandleList, 0, len(c))
+	for _, candle := range c {
+		if candle.HasFlags(include) && !candle.HasAnyFlag(exclude) {
+			result = append(result, candle)
+		}
+	}
+	return result
+}
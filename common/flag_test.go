@@ -0,0 +1,70 @@
+package common
+
+import "testing"
+
+func TestBuiltInFlags(t *testing.T) {
+	for name, expected := range map[string]CandleFlag{
+		"incomplete": FlagIncomplete,
+		"synthetic":  FlagSynthetic,
+		"adjusted":   FlagAdjusted,
+		"corrected":  FlagCorrected,
+	} {
+		if flag, ok := FlagByName(name); !ok || flag != expected {
+			t.Errorf("expected '%s' to be %d, got %d", name, expected, flag)
+		}
+	}
+	if _, err := RegisterFlag("adjusted"); err == nil {
+		t.Error("expected built-in names to be rejected")
+	}
+	if s := (FlagIncomplete | FlagCorrected | CandleFlag(1<<10)).String(); s != "incomplete|corrected|0x400" {
+		t.Errorf("unexpected names '%s'", s)
+	}
+}
+
+func TestRegisterFlagAllocatesUserBits(t *testing.T) {
+	registered := make([]CandleFlag, 0)
+	for i := 0; ; i++ {
+		flag, err := RegisterFlag(string(rune('a' + i)))
+		if err != nil {
+			break
+		}
+		registered = append(registered, flag)
+	}
+	// Bits from firstUserFlagBit are allocated in order, leaving lower bits to built-in flags
+	if len(registered) != 32-firstUserFlagBit {
+		t.Fatalf("expected %d user flags, got %d", 32-firstUserFlagBit, len(registered))
+	}
+	for i, flag := range registered {
+		if flag != CandleFlag(1)<<(firstUserFlagBit+i) {
+			t.Errorf("flag %d: expected bit %d, got 0x%x", i, firstUserFlagBit+i, uint32(flag))
+		}
+	}
+	if flag, ok := FlagByName("a"); !ok || flag != registered[0] {
+		t.Errorf("expected 'a' to be registered as 0x%x, got 0x%x", uint32(registered[0]), uint32(flag))
+	}
+	if _, err := RegisterFlag("a"); err == nil {
+		t.Error("expected a registered name to be rejected")
+	}
+}
+
+func TestCandleFlags(t *testing.T) {
+	candle := TimelessCandle{}
+	candle.SetFlags(FlagIncomplete | FlagSynthetic)
+	candle.ClearFlags(FlagIncomplete)
+	if candle.Flags() != FlagSynthetic || !candle.HasFlags(FlagSynthetic) || candle.HasFlags(FlagSynthetic|FlagAdjusted) ||
+		!candle.HasAnyFlag(FlagSynthetic|FlagAdjusted) || candle.HasAnyFlag(FlagIncomplete) {
+		t.Errorf("unexpected flags %s", candle.Flags())
+	}
+
+	candles := CandleList{
+		{TimelessCandle: TimelessCandle{Open: 1, BitFields: uint32(FlagSynthetic)}},
+		{TimelessCandle: TimelessCandle{Open: 2, BitFields: uint32(FlagSynthetic | FlagCorrected)}},
+		{TimelessCandle: TimelessCandle{Open: 3}},
+	}
+	if got := candles.FilterFlags(FlagSynthetic, FlagCorrected); len(got) != 1 || got[0].Open != 1 {
+		t.Errorf("expected only the first candle, got %v", got)
+	}
+	if got := candles.FilterFlags(0, 0); len(got) != 3 {
+		t.Errorf("expected all candles without masks, got %v", got)
+	}
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BucketStart returns the start of the bucket of the given length containing ts.
+// Buckets are aligned to the Unix epoch, so daily buckets start at 00:00 UTC,
+// and weekly buckets start on Thursdays at 00:00 UTC, as 1970-01-01 was a Thursday.
+func BucketStart(ts int64, length uint32) int64 {
+	bucket := ts - ts%int64(length)
+	if ts < 0 && ts%int64(length) != 0 {
+		bucket -= int64(length)
+	}
+	return bucket
+}
+
+// AlignRange widens the range so that both ends are on bucket boundaries of the given length.
+func (t TimeRange) AlignRange(length uint32) TimeRange {
+	start := BucketStart(t.Start.Unix(), length)
+	end := BucketStart(t.End.Unix(), length)
+	if end < t.End.Unix() {
+		end += int64(length)
+	}
+	return TimeRange{
+		Start: time.Unix(start, 0).UTC(),
+		End:   time.Unix(end, 0).UTC(),
+	}
+}
+
+// Resample aggregates candles of length baseLength into candles of length targetLength.
+// Candles must be sorted by timestamp. Each resulting candle takes the first open, highest high, lowest low,
+// last close and summed volume of its bucket, with BitFields of the bucket OR-ed together.
+func (c CandleList) Resample(baseLength, targetLength uint32) (CandleList, error) {
+	if baseLength == 0 || targetLength == 0 || targetLength%baseLength != 0 {
+		return CandleList{}, errors.Errorf("target length %d is not a multiple of base length %d", targetLength, baseLength)
+	}
+	result := make(CandleList, 0, len(c)*int(baseLength)/int(targetLength)+1)
+	for i := range c {
+		bucket := BucketStart(c[i].Timestamp.Unix(), targetLength)
+		last := len(result) - 1
+		if last >= 0 && result[last].Timestamp.Unix() == bucket {
+			result[last].TimelessCandle = result[last].TimelessCandle.Merge(c[i].TimelessCandle)
+			continue
+		}
+		result = append(result, Candle{
+			TimelessCandle: c[i].TimelessCandle,
+			Timestamp:      time.Unix(bucket, 0).UTC(),
+		})
+	}
+	return result, nil
+}
+
+// Merge combines a candle with the candle that follows it.
+func (t TimelessCandle) Merge(next TimelessCandle) TimelessCandle {
+	result := t
+	if next.High > result.High {
+		result.High = next.High
+	}
+	if next.Low < result.Low {
+		result.Low = next.Low
+	}
+	result.Close = next.Close
+	result.Volume += next.Volume
+	result.BitFields |= next.BitFields
+	return result
+}
@@ -0,0 +1,101 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	cases := []struct {
+		name     string
+		at       time.Time
+		length   uint32
+		expected time.Time
+	}{
+		{"hour", time.Date(2022, 3, 1, 10, 59, 59, 0, time.UTC), 3600, time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{"day", time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC), 86400, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// 2022-03-01 is a Tuesday, and weeks start on Thursdays like the epoch
+		{"week", time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC), 7 * 86400, time.Date(2022, 2, 24, 0, 0, 0, 0, time.UTC)},
+		{"before epoch", time.Date(1969, 12, 31, 23, 30, 0, 0, time.UTC), 3600, time.Date(1969, 12, 31, 23, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := BucketStart(c.at.Unix(), c.length); got != c.expected.Unix() {
+				t.Errorf("expected %v, got %v", c.expected, time.Unix(got, 0).UTC())
+			}
+		})
+	}
+	if weekday := time.Unix(BucketStart(time.Now().Unix(), 7*86400), 0).UTC().Weekday(); weekday != time.Thursday {
+		t.Errorf("expected weekly buckets to start on Thursday, got %s", weekday)
+	}
+}
+
+func TestAlignRange(t *testing.T) {
+	r := TimeRange{
+		Start: time.Date(2022, 3, 1, 10, 7, 0, 0, time.UTC),
+		End:   time.Date(2022, 3, 1, 10, 20, 0, 0, time.UTC),
+	}
+	aligned := r.AlignRange(600)
+	if !aligned.Start.Equal(time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)) || !aligned.End.Equal(r.End) {
+		t.Errorf("expected [10:00, 10:20), got [%v, %v)", aligned.Start, aligned.End)
+	}
+}
+
+func TestResample(t *testing.T) {
+	start := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	candles := CandleList{
+		{Timestamp: start, TimelessCandle: TimelessCandle{Open: 10, High: 12, Low: 9, Close: 11, Volume: 1, BitFields: 1}},
+		{Timestamp: start.Add(time.Minute), TimelessCandle: TimelessCandle{Open: 11, High: 15, Low: 10, Close: 14, Volume: 2, BitFields: 4}},
+		{Timestamp: start.Add(4 * time.Minute), TimelessCandle: TimelessCandle{Open: 14, High: 14, Low: 7, Close: 8, Volume: 3}},
+		{Timestamp: start.Add(5 * time.Minute), TimelessCandle: TimelessCandle{Open: 8, High: 9, Low: 8, Close: 9, Volume: 4}},
+	}
+	result, err := candles.Resample(60, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := CandleList{
+		{Timestamp: start, TimelessCandle: TimelessCandle{Open: 10, High: 15, Low: 7, Close: 8, Volume: 6, BitFields: 5}},
+		{Timestamp: start.Add(5 * time.Minute), TimelessCandle: candles[3].TimelessCandle},
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, result)
+	}
+	for i := range expected {
+		if !result[i].Timestamp.Equal(expected[i].Timestamp) || result[i].TimelessCandle != expected[i].TimelessCandle {
+			t.Errorf("bucket %d: expected %v, got %v", i, expected[i], result[i])
+		}
+	}
+}
+
+func TestResampleAcrossYears(t *testing.T) {
+	newYear := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles := CandleList{
+		{Timestamp: newYear.Add(-2 * time.Minute), TimelessCandle: TimelessCandle{Open: 1, High: 1, Low: 1, Close: 1, Volume: 1}},
+		{Timestamp: newYear.Add(-time.Minute), TimelessCandle: TimelessCandle{Open: 2, High: 2, Low: 2, Close: 2, Volume: 1}},
+		{Timestamp: newYear, TimelessCandle: TimelessCandle{Open: 3, High: 3, Low: 3, Close: 3, Volume: 1}},
+	}
+	// Daily buckets are split at the year boundary, while a weekly bucket spans it
+	daily, err := candles.Resample(60, 86400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 2 || !daily[1].Timestamp.Equal(newYear) || daily[0].Close != 2 {
+		t.Errorf("expected buckets of 2021-12-31 and 2022-01-01, got %v", daily)
+	}
+	weekly, err := candles.Resample(60, 7*86400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(weekly) != 1 || weekly[0].Open != 1 || weekly[0].Close != 3 || weekly[0].Volume != 3 {
+		t.Errorf("expected a single weekly bucket, got %v", weekly)
+	}
+}
+
+func TestResampleRejectsLengthsNotMultiples(t *testing.T) {
+	if _, err := (CandleList{}).Resample(60, 90); err == nil {
+		t.Error("expected 90 to be rejected as a target of 60")
+	}
+	if _, err := (CandleList{}).Resample(0, 60); err == nil {
+		t.Error("expected a zero base length to be rejected")
+	}
+}
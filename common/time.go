@@ -1,8 +1,11 @@
 package common
 
 import (
+	"math"
 	"sync"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 type TimeRange struct {
@@ -22,3 +25,30 @@ func GetStartOfYearTimestamp(year int) int64 {
 	yearTsCache[year] = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
 	return yearTsCache[year]
 }
+
+// Validate returns an error if the range covers years pages can not be stored for, which are before 1 or after 65535.
+func (t TimeRange) Validate() error {
+	if !t.Start.Before(t.End) {
+		return nil
+	}
+	first := t.Start.UTC().Year()
+	last := t.End.Add(-time.Second).UTC().Year()
+	if first < 1 || last > math.MaxUint16 {
+		return errors.Errorf("range covers years %d to %d, which are not within 1 to %d", first, last, math.MaxUint16)
+	}
+	return nil
+}
+
+// Years returns the years covered by the range, treating End as exclusive.
+func (t TimeRange) Years() []uint16 {
+	if !t.Start.Before(t.End) {
+		return []uint16{}
+	}
+	first := t.Start.UTC().Year()
+	last := t.End.Add(-time.Second).UTC().Year()
+	result := make([]uint16, 0, last-first+1)
+	for year := first; year <= last; year++ {
+		result = append(result, uint16(year))
+	}
+	return result
+}
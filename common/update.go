@@ -0,0 +1,63 @@
+package common
+
+// CandleUpdateField marks a field set in a CandleUpdate.
+type CandleUpdateField uint8
+
+const (
+	UpdateOpen CandleUpdateField = 1 << iota
+	UpdateHigh
+	UpdateLow
+	UpdateClose
+	UpdateVolume
+)
+
+// CandleUpdate is a partial update of an in-progress candle. Only fields marked in Fields are applied.
+type CandleUpdate struct {
+	Fields CandleUpdateField
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+func (u CandleUpdate) Has(field CandleUpdateField) bool {
+	return u.Fields&field != 0
+}
+
+// Apply updates an existing candle: high is raised, low is lowered, close and volume are replaced.
+// Open is kept, since it is fixed once the candle exists.
+func (u CandleUpdate) Apply(c TimelessCandle) TimelessCandle {
+	if u.Has(UpdateHigh) && u.High > c.High {
+		c.High = u.High
+	}
+	if u.Has(UpdateLow) && u.Low < c.Low {
+		c.Low = u.Low
+	}
+	if u.Has(UpdateClose) {
+		c.Close = u.Close
+		if u.Close > c.High {
+			c.High = u.Close
+		}
+		if u.Close < c.Low {
+			c.Low = u.Close
+		}
+	}
+	if u.Has(UpdateVolume) {
+		c.Volume = u.Volume
+	}
+	return c
+}
+
+// NewCandle creates the candle the update starts. Close must be set; open defaults to close.
+func (u CandleUpdate) NewCandle() (TimelessCandle, bool) {
+	if !u.Has(UpdateClose) {
+		return TimelessCandle{}, false
+	}
+	open := u.Close
+	if u.Has(UpdateOpen) {
+		open = u.Open
+	}
+	c := TimelessCandle{Open: open, High: open, Low: open, Close: open}
+	return u.Apply(c), true
+}
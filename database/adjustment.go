@@ -0,0 +1,37 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/page"
+)
+
+// AddAdjustment records a corporate action of the set, replacing one with the same effective time.
+// Stored candles are not changed; reads with WithAdjustments apply it.
+func (d *Database) AddAdjustment(set page.CandleSetWithoutYear, adjustment common.Adjustment) error {
+	cmd := command.NewAdjustCommand(set, command.AdjustUpsert, adjustment)
+	_, err := d.Execute([]command.CommandContent{&cmd})
+	return err
+}
+
+// RemoveAdjustment removes the adjustment of the set effective at t, returning if it existed.
+func (d *Database) RemoveAdjustment(set page.CandleSetWithoutYear, t time.Time) (bool, error) {
+	cmd := command.NewAdjustCommand(set, command.AdjustRemove, common.Adjustment{EffectiveTime: t.Unix()})
+	results, err := d.Execute([]command.CommandContent{&cmd})
+	if err != nil {
+		return false, err
+	}
+	return results[0].(bool), nil
+}
+
+// Adjustments lists the adjustments of the set, ordered by effective time.
+func (d *Database) Adjustments(set page.CandleSetWithoutYear) (common.AdjustmentList, error) {
+	cmd := command.NewReadAdjustmentsCommand(set)
+	results, err := d.Execute([]command.CommandContent{&cmd})
+	if err != nil {
+		return common.AdjustmentList{}, err
+	}
+	return results[0].(common.AdjustmentList), nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+)
+
+// copyLogs copies logs of the database directory to dir, or back from it if restore is set.
+func copyLogs(t *testing.T, directory, dir string, restore bool) {
+	t.Helper()
+	from, to := filepath.Join(directory, "wal"), dir
+	if restore {
+		from, to = dir, filepath.Join(directory, "wal")
+	}
+	files, err := filepath.Glob(filepath.Join(from, "wal.*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(to, filepath.Base(file)), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadWithAdjustments(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	candles := testCandles(testStart, 3, 10)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+	split := common.Adjustment{EffectiveTime: candles[2].Timestamp.Unix(), PriceFactor: 0.5, VolumeFactor: 2}
+	if err := db.AddAdjustment(set, split); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.Read(set, common.TimeRange{Start: testStart, End: testStart.Add(time.Hour)}, WithAdjustments())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, got, common.AdjustmentList{split}.Apply(candles))
+	if !got[0].HasFlags(common.FlagAdjusted) || got[2].HasFlags(common.FlagAdjusted) {
+		t.Errorf("expected only candles before the split to be marked, got %v", got)
+	}
+	// Stored candles are not changed
+	expectCandles(t, readAll(t, db, set), candles)
+}
+
+func TestAdjustmentsReplayedTwice(t *testing.T) {
+	config := testConfig(t)
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	first := common.Adjustment{EffectiveTime: testStart.Unix(), PriceFactor: 0.5, VolumeFactor: 2}
+	second := common.Adjustment{EffectiveTime: testStart.Add(time.Hour).Unix(), PriceFactor: 0.9, VolumeFactor: 1}
+	for _, adjustment := range []common.Adjustment{first, second, {EffectiveTime: first.EffectiveTime, PriceFactor: 0.25, VolumeFactor: 4}} {
+		if err := db.AddAdjustment(set, adjustment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if removed, err := db.RemoveAdjustment(set, testStart.Add(time.Hour)); err != nil || !removed {
+		t.Fatalf("expected the adjustment to be removed, got %v (%v)", removed, err)
+	}
+	expected := common.AdjustmentList{{EffectiveTime: first.EffectiveTime, PriceFactor: 0.25, VolumeFactor: 4}}
+
+	// The logs are replayed again after a crash before they were deleted
+	saved := t.TempDir()
+	db.Storage.Stop()
+	copyLogs(t, config.Directory, saved, false)
+	for i := 0; i < 2; i++ {
+		db = openTestDatabase(t, config)
+		adjustments, err := db.Adjustments(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(adjustments) != 1 || adjustments[0] != expected[0] {
+			t.Fatalf("replay %d: expected %v, got %v", i, expected, adjustments)
+		}
+		db.Storage.Stop()
+		copyLogs(t, config.Directory, saved, true)
+	}
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+)
+
+// ListMarkets lists markets having any stored sets.
+func (d *Database) ListMarkets() []string {
+	return d.catalog.Markets()
+}
+
+// ListCandleLengths lists candle lengths stored under the market.
+func (d *Database) ListCandleLengths(marketCode string) []uint32 {
+	return d.catalog.CandleLengths(marketCode)
+}
+
+// ListCodes lists codes stored under the market with the candle length.
+func (d *Database) ListCodes(marketCode string, candleLength uint32) []string {
+	return d.catalog.Codes(marketCode, candleLength)
+}
+
+// ListYears lists years of the set having candles, in ascending order.
+func (d *Database) ListYears(set page.CandleSetWithoutYear) []uint16 {
+	return d.catalog.Years(set)
+}
+
+// listYears lists years of the set, including pages created and excluding pages dropped by this transaction.
+func (t *TransactionContext) listYears(set page.CandleSetWithoutYear) []uint16 {
+	years := make([]uint16, 0)
+	if t.catalog != nil {
+		for _, year := range t.catalog.Years(set) {
+			dropped := false
+			for _, droppedSet := range t.droppedSets {
+				dropped = dropped || droppedSet == page.CandleSet{CandleSetWithoutYear: set, Year: year}
+			}
+			if !dropped {
+				years = append(years, year)
+			}
+		}
+	}
+	for _, inserted := range t.insertedSets {
+		if inserted.CandleSetWithoutYear != set {
+			continue
+		}
+		exists := false
+		for _, year := range years {
+			exists = exists || year == inserted.Year
+		}
+		if !exists {
+			years = append(years, inserted.Year)
+		}
+	}
+	sort.Slice(years, func(i, j int) bool { return years[i] < years[j] })
+	return years
+}
+
+// pageYear returns the year of the page storing t, failing as lockYears does for years pages can not be stored for.
+func pageYear(t time.Time) (uint16, error) {
+	if err := (common.TimeRange{Start: t, End: t.Add(time.Second)}).Validate(); err != nil {
+		return 0, err
+	}
+	return uint16(t.UTC().Year()), nil
+}
+
+// lockCodeAndListYears locks the code and lists years of the set, as listYears does.
+// Years are listed after locking the code, so no year can be created in between.
+func (t *TransactionContext) lockCodeAndListYears(set page.CandleSetWithoutYear, exclusive bool) ([]uint16, error) {
+	if err := t.ensureLocks(command.NeededLockSlice{{
+		Lock:      concurrency.NewCodeResourceName(set.MarketCode, set.Code),
+		Exclusive: exclusive,
+	}}); err != nil {
+		return []uint16{}, err
+	}
+	return t.listYears(set), nil
+}
+
+// lockYears locks the code and lists years of the set in the range, as lockCodeAndListYears does.
+func (t *TransactionContext) lockYears(set page.CandleSetWithoutYear, r common.TimeRange, exclusive bool) ([]uint16, error) {
+	if err := r.Validate(); err != nil {
+		return []uint16{}, err
+	}
+	allYears, err := t.lockCodeAndListYears(set, exclusive)
+	if err != nil {
+		return []uint16{}, err
+	}
+	inRange := make(map[uint16]bool)
+	for _, year := range r.Years() {
+		inRange[year] = true
+	}
+	years := make([]uint16, 0)
+	for _, year := range allYears {
+		if inRange[year] {
+			years = append(years, year)
+		}
+	}
+	return years, nil
+}
@@ -0,0 +1,126 @@
+package catalog
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/jungnoh/mora/page"
+)
+
+type yearSet map[uint16]struct{}
+type codeMap map[string]yearSet
+type lengthMap map[uint32]codeMap
+
+// Catalog indexes the markets, candle lengths, codes and years of stored sets.
+type Catalog struct {
+	accessLock sync.RWMutex
+	markets    map[string]lengthMap
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{
+		markets: make(map[string]lengthMap),
+	}
+}
+
+func (c *Catalog) Add(sets ...page.CandleSet) {
+	c.accessLock.Lock()
+	defer c.accessLock.Unlock()
+
+	for _, set := range sets {
+		if _, ok := c.markets[set.MarketCode]; !ok {
+			c.markets[set.MarketCode] = make(lengthMap)
+		}
+		lengths := c.markets[set.MarketCode]
+		if _, ok := lengths[set.CandleLength]; !ok {
+			lengths[set.CandleLength] = make(codeMap)
+		}
+		codes := lengths[set.CandleLength]
+		if _, ok := codes[set.Code]; !ok {
+			codes[set.Code] = make(yearSet)
+		}
+		codes[set.Code][set.Year] = struct{}{}
+	}
+}
+
+// Remove removes the set, along with its parents left without any sets.
+func (c *Catalog) Remove(sets ...page.CandleSet) {
+	c.accessLock.Lock()
+	defer c.accessLock.Unlock()
+
+	for _, set := range sets {
+		lengths, ok := c.markets[set.MarketCode]
+		if !ok {
+			continue
+		}
+		codes, ok := lengths[set.CandleLength]
+		if !ok {
+			continue
+		}
+		years, ok := codes[set.Code]
+		if !ok {
+			continue
+		}
+		delete(years, set.Year)
+		if len(years) == 0 {
+			delete(codes, set.Code)
+		}
+		if len(codes) == 0 {
+			delete(lengths, set.CandleLength)
+		}
+		if len(lengths) == 0 {
+			delete(c.markets, set.MarketCode)
+		}
+	}
+}
+
+func (c *Catalog) Markets() []string {
+	c.accessLock.RLock()
+	defer c.accessLock.RUnlock()
+
+	result := make([]string, 0, len(c.markets))
+	for market := range c.markets {
+		result = append(result, market)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (c *Catalog) CandleLengths(marketCode string) []uint32 {
+	c.accessLock.RLock()
+	defer c.accessLock.RUnlock()
+
+	lengths := c.markets[marketCode]
+	result := make([]uint32, 0, len(lengths))
+	for length := range lengths {
+		result = append(result, length)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+func (c *Catalog) Codes(marketCode string, candleLength uint32) []string {
+	c.accessLock.RLock()
+	defer c.accessLock.RUnlock()
+
+	codes := c.markets[marketCode][candleLength]
+	result := make([]string, 0, len(codes))
+	for code := range codes {
+		result = append(result, code)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (c *Catalog) Years(set page.CandleSetWithoutYear) []uint16 {
+	c.accessLock.RLock()
+	defer c.accessLock.RUnlock()
+
+	years := c.markets[set.MarketCode][set.CandleLength][set.Code]
+	result := make([]uint16, 0, len(years))
+	for year := range years {
+		result = append(result, year)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
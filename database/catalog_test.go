@@ -0,0 +1,74 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/storage"
+	"github.com/jungnoh/mora/database/storage/disk"
+	"github.com/jungnoh/mora/page"
+)
+
+func TestDeleteRangeRemovesEmptiedYears(t *testing.T) {
+	config := testConfig(t)
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	lastYear := testStart.AddDate(-1, 0, 0)
+	if _, err := db.Write(set, append(testCandles(lastYear, 3, 10), testCandles(testStart, 3, 10)...)); err != nil {
+		t.Fatal(err)
+	}
+	if years := db.ListYears(set); len(years) != 2 {
+		t.Fatalf("expected 2 years, got %v", years)
+	}
+
+	// A partial delete keeps the year
+	if _, err := db.DeleteRange(set, common.TimeRange{Start: testStart, End: testStart.Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if years := db.ListYears(set); len(years) != 2 {
+		t.Fatalf("expected 2 years, got %v", years)
+	}
+
+	if _, err := db.DeleteRange(set, common.TimeRange{Start: lastYear, End: lastYear.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if years := db.ListYears(set); len(years) != 1 || years[0] != 2022 {
+		t.Fatalf("expected only 2022, got %v", years)
+	}
+
+	db = reopenTestDatabase(t, db, config)
+	if years := db.ListYears(set); len(years) != 1 || years[0] != 2022 {
+		t.Fatalf("expected only 2022 after reopening, got %v", years)
+	}
+}
+
+func TestCatalogSkipsEmptyPageFiles(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.Stop()
+
+	// Page files without candles
+	d := disk.NewDisk(&config)
+	if err := d.Write(page.NewPage(page.CandleSet{CandleSetWithoutYear: set, Year: 2021})); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Write(page.NewPage(page.CandleSet{CandleSetWithoutYear: testSet("B"), Year: 2022})); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDatabase(t, config)
+	if years := db.ListYears(set); len(years) != 1 || years[0] != 2022 {
+		t.Errorf("expected only 2022, got %v", years)
+	}
+	if codes := db.ListCodes("TEST", 60); len(codes) != 1 || codes[0] != "A" {
+		t.Errorf("expected only 'A', got %v", codes)
+	}
+}
@@ -0,0 +1,177 @@
+package command
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+const adjustCommandSize uint32 = 57
+
+// AdjustOperation is the change an AdjustCommand makes to the adjustments of a set.
+type AdjustOperation uint8
+
+const (
+	// AdjustUpsert adds an adjustment, replacing one with the same effective time
+	AdjustUpsert AdjustOperation = 0
+	// AdjustRemove removes the adjustment with the effective time
+	AdjustRemove AdjustOperation = 1
+)
+
+// AdjustCommand changes the adjustments of a set.
+// Both operations are keyed by effective time, so replaying the command is idempotent.
+type AdjustCommand struct {
+	CandleLength uint32
+	MarketCode   string
+	Code         string
+	Operation    AdjustOperation
+	Adjustment   common.Adjustment
+}
+
+func NewAdjustCommand(set page.CandleSetWithoutYear, operation AdjustOperation, adjustment common.Adjustment) AdjustCommand {
+	return AdjustCommand{
+		CandleLength: set.CandleLength,
+		MarketCode:   set.MarketCode,
+		Code:         set.Code,
+		Operation:    operation,
+		Adjustment:   adjustment,
+	}
+}
+
+func (e *AdjustCommand) Read(size uint32, r io.Reader) error {
+	if size != adjustCommandSize {
+		return errors.New("wrong data size")
+	}
+	bin := make([]byte, adjustCommandSize-common.AdjustmentSize)
+	n, err := r.Read(bin)
+	if n < len(bin) {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	e.CandleLength = binary.LittleEndian.Uint32(bin[0:4])
+	e.MarketCode = common.ReadNullPaddedString(bin[4:14])
+	e.Code = common.ReadNullPaddedString(bin[14:32])
+	e.Operation = AdjustOperation(bin[32])
+	return e.Adjustment.Read(common.AdjustmentSize, r)
+}
+
+func (e *AdjustCommand) Write(w io.Writer) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, e.CandleLength); err != nil {
+		return
+	}
+	if err := common.WriteNullPaddedString(page.MAX_MARKET_CODE_LENGTH, e.MarketCode, w); err != nil {
+		return errors.Wrap(err, "failed to write market code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_CODE_LENGTH, e.Code, w); err != nil {
+		return errors.Wrap(err, "failed to write code")
+	}
+	if err = binary.Write(w, binary.LittleEndian, e.Operation); err != nil {
+		return
+	}
+	return e.Adjustment.Write(w)
+}
+
+func (e *AdjustCommand) BinarySize() uint32 {
+	return adjustCommandSize
+}
+
+func (e *AdjustCommand) TypeId() CommandType {
+	return AdjustCommandType
+}
+
+func (e *AdjustCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewCodeResourceName(e.MarketCode, e.Code),
+				Exclusive: true,
+			},
+		},
+	}
+}
+
+// Execute applies the operation, returning if the adjustments were changed.
+func (e *AdjustCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	adjustments, err := accessor.GetAdjustments(e.TargetSet(), true)
+	if err != nil {
+		return false, errors.Wrapf(err, "AdjustCommand: load failed (%s)", e.String())
+	}
+	switch e.Operation {
+	case AdjustUpsert:
+		if err := adjustments.Upsert(e.Adjustment); err != nil {
+			return false, errors.Wrapf(err, "AdjustCommand: failed (%s)", e.String())
+		}
+		return true, nil
+	case AdjustRemove:
+		return adjustments.Remove(e.Adjustment.EffectiveTime), nil
+	}
+	return false, errors.Errorf("AdjustCommand: unknown operation %d", e.Operation)
+}
+
+func (e *AdjustCommand) TargetSet() page.CandleSetWithoutYear {
+	return page.CandleSetWithoutYear{
+		CandleLength: e.CandleLength,
+		MarketCode:   e.MarketCode,
+		Code:         e.Code,
+	}
+}
+
+func (e *AdjustCommand) String() string {
+	return fmt.Sprintf("ADJUST(%s,%s,%d,%d,%d)", e.MarketCode, e.Code, e.CandleLength, e.Operation, e.Adjustment.EffectiveTime)
+}
+
+// ReadAdjustmentsCommand reads the adjustments of a set. Reads are never written to the WAL.
+type ReadAdjustmentsCommand struct {
+	Set page.CandleSetWithoutYear
+}
+
+func NewReadAdjustmentsCommand(set page.CandleSetWithoutYear) ReadAdjustmentsCommand {
+	return ReadAdjustmentsCommand{Set: set}
+}
+
+func (e *ReadAdjustmentsCommand) Read(size uint32, r io.Reader) error {
+	return errors.New("read adjustments command cannot be deserialized")
+}
+
+func (e *ReadAdjustmentsCommand) Write(w io.Writer) error {
+	return errors.New("read adjustments command cannot be serialized")
+}
+
+func (e *ReadAdjustmentsCommand) BinarySize() uint32 {
+	return 0
+}
+
+func (e *ReadAdjustmentsCommand) TypeId() CommandType {
+	return ReadAdjustmentsCommandType
+}
+
+func (e *ReadAdjustmentsCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewCodeResourceName(e.Set.MarketCode, e.Set.Code),
+				Exclusive: false,
+			},
+		},
+	}
+}
+
+func (e *ReadAdjustmentsCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	adjustments, err := accessor.GetAdjustments(e.Set, false)
+	if err != nil {
+		return common.AdjustmentList{}, errors.Wrapf(err, "ReadAdjustmentsCommand: load failed (%s)", e.String())
+	}
+	return adjustments.Copy(), nil
+}
+
+func (e *ReadAdjustmentsCommand) String() string {
+	return fmt.Sprintf("READ_ADJUSTMENTS(%s,%s,%d)", e.Set.MarketCode, e.Set.Code, e.Set.CandleLength)
+}
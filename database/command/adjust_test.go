@@ -0,0 +1,27 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jungnoh/mora/common"
+)
+
+func TestAdjustCommandRoundTrip(t *testing.T) {
+	adjustment := common.Adjustment{EffectiveTime: 1646092800, PriceFactor: 0.5, VolumeFactor: 2}
+	cmd := NewAdjustCommand(testSet.CandleSetWithoutYear, AdjustRemove, adjustment)
+	buf := bytes.Buffer{}
+	if err := cmd.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if uint32(buf.Len()) != cmd.BinarySize() {
+		t.Fatalf("expected %d bytes, got %d", cmd.BinarySize(), buf.Len())
+	}
+	read := AdjustCommand{}
+	if err := read.Read(uint32(buf.Len()), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if read != cmd {
+		t.Errorf("expected %+v, got %+v", cmd, read)
+	}
+}
@@ -1,8 +1,10 @@
 package command
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 
 	"github.com/pkg/errors"
@@ -16,79 +18,162 @@ func NewCommand(txId uint64, content CommandContent) Command {
 	}
 }
 
+// RecordMagic marks the start of every WAL record.
+const RecordMagic uint32 = 0x4c41574d
+
+// Records are laid out as magic(4) | size(4) | txId(8) | type(4) | body(size) | crc32c(4),
+// where the checksum covers everything from size to the end of the body.
+const recordHeaderSize = 20
+const recordTrailerSize = 4
+
+var (
+	// ErrTornRecord is returned if the record ends before its declared size, or has no complete header.
+	ErrTornRecord = errors.New("torn WAL record")
+	// ErrBadMagic is returned if the record does not start with RecordMagic.
+	ErrBadMagic = errors.New("bad WAL record magic")
+	// ErrChecksumMismatch is returned if the record does not match its checksum.
+	ErrChecksumMismatch = errors.New("WAL record checksum mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Read reads a record. io.EOF is returned only if r has no bytes left.
 func (e *Command) Read(_ uint32, r io.Reader) error {
-	headerBytes := make([]byte, 16)
-	n, err := r.Read(headerBytes)
-	if n < 16 {
-		return io.EOF
+	headerBytes := make([]byte, recordHeaderSize)
+	if n, err := io.ReadFull(r, headerBytes); err != nil {
+		if n == 0 && err == io.EOF {
+			return io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return ErrTornRecord
+		}
+		return err
 	}
-	if err != nil {
+	if binary.LittleEndian.Uint32(headerBytes[0:4]) != RecordMagic {
+		return ErrBadMagic
+	}
+
+	entrySize := binary.LittleEndian.Uint32(headerBytes[4:8])
+	e.TxID = binary.LittleEndian.Uint64(headerBytes[8:16])
+	e.Type = CommandType(binary.LittleEndian.Uint32(headerBytes[16:20]))
+
+	// Read body and checksum in chunks, so a corrupted size does not allocate a huge buffer at once
+	body := bytes.Buffer{}
+	if _, err := io.CopyN(&body, r, int64(entrySize)+recordTrailerSize); err != nil {
+		if err == io.EOF {
+			return ErrTornRecord
+		}
 		return err
 	}
+	bodyBytes := body.Bytes()[:entrySize]
+	checksum := crc32.Update(crc32.Checksum(headerBytes[4:], castagnoli), castagnoli, bodyBytes)
+	if checksum != binary.LittleEndian.Uint32(body.Bytes()[entrySize:]) {
+		return ErrChecksumMismatch
+	}
 
-	entrySize := binary.LittleEndian.Uint32(headerBytes[0:4])
-	e.TxID = binary.LittleEndian.Uint64(headerBytes[4:12])
-	e.Type = CommandType(binary.LittleEndian.Uint32(headerBytes[12:16]))
-	switch e.Type {
-	case CommitCommandType:
-		e.Content = &CommitCommand{}
-	case InsertCommandType:
-		e.Content = &InsertCommand{}
-	default:
-		return errors.Errorf("unknown entry type %d", e.Type)
+	content, err := newContent(e.Type)
+	if err != nil {
+		return err
 	}
+	e.Content = content
 
-	if err := e.Content.Read(entrySize, r); err != nil {
+	if err := e.Content.Read(entrySize, bytes.NewReader(bodyBytes)); err != nil {
 		return errors.Wrap(err, "failed to read entry content")
 	}
 	return nil
 }
 
-func (e *Command) ReadHeader(_ uint32, r io.ReadSeeker) error {
-	headerBytes := make([]byte, 16)
-	n, err := r.Read(headerBytes)
-	if n < 16 {
-		return io.EOF
+// newContent returns empty content of the logged command type.
+func newContent(t CommandType) (CommandContent, error) {
+	switch t {
+	case CommitCommandType:
+		return &CommitCommand{}, nil
+	case InsertCommandType:
+		return &InsertCommand{}, nil
+	case DeleteRangeCommandType:
+		return &DeleteRangeCommand{}, nil
+	case UpdateLastCommandType:
+		return &UpdateLastCommand{}, nil
+	case DropCommandType:
+		return &DropCommand{}, nil
+	case DropAdjustmentsCommandType:
+		return &DropAdjustmentsCommand{}, nil
+	case RenameCommandType:
+		return &RenameCommand{}, nil
+	case RenameAdjustmentsCommandType:
+		return &RenameAdjustmentsCommand{}, nil
+	case AdjustCommandType:
+		return &AdjustCommand{}, nil
+	case SavepointCommandType:
+		return &SavepointCommand{}, nil
+	case RollbackToCommandType:
+		return &RollbackToCommand{}, nil
+	default:
+		return nil, errors.Errorf("unknown entry type %d", t)
 	}
-	if err != nil {
+}
+
+// ReadHeader reads the header of a record and skips its body, without verifying the checksum.
+func (e *Command) ReadHeader(_ uint32, r io.ReadSeeker) error {
+	headerBytes := make([]byte, recordHeaderSize)
+	if n, err := io.ReadFull(r, headerBytes); err != nil {
+		if n == 0 && err == io.EOF {
+			return io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return ErrTornRecord
+		}
 		return err
 	}
+	if binary.LittleEndian.Uint32(headerBytes[0:4]) != RecordMagic {
+		return ErrBadMagic
+	}
 
-	entrySize := binary.LittleEndian.Uint32(headerBytes[0:4])
-	e.TxID = binary.LittleEndian.Uint64(headerBytes[4:12])
-	e.Type = CommandType(binary.LittleEndian.Uint32(headerBytes[12:16]))
+	entrySize := binary.LittleEndian.Uint32(headerBytes[4:8])
+	e.TxID = binary.LittleEndian.Uint64(headerBytes[8:16])
+	e.Type = CommandType(binary.LittleEndian.Uint32(headerBytes[16:20]))
 
-	if _, err := r.Seek(int64(entrySize), io.SeekCurrent); err != nil {
+	if _, err := r.Seek(int64(entrySize)+recordTrailerSize, io.SeekCurrent); err != nil {
 		return errors.Wrap(err, "failed to seek")
 	}
 	return nil
 }
 
+// Write writes the record with a single call to w, so records are not interleaved.
 func (e *Command) Write(w io.Writer) error {
 	if e.Content == nil {
 		return errors.New("command content is nil")
 	}
 	bodySize := e.Content.BinarySize()
-	if err := binary.Write(w, binary.LittleEndian, bodySize); err != nil {
+	buf := bytes.NewBuffer(make([]byte, 0, e.BinarySize()))
+	if err := binary.Write(buf, binary.LittleEndian, RecordMagic); err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.LittleEndian, e.TxID); err != nil {
+	if err := binary.Write(buf, binary.LittleEndian, bodySize); err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.LittleEndian, e.Type); err != nil {
+	if err := binary.Write(buf, binary.LittleEndian, e.TxID); err != nil {
 		return err
 	}
-	if err := e.Content.Write(w); err != nil {
+	if err := binary.Write(buf, binary.LittleEndian, e.Type); err != nil {
 		return err
 	}
-	return nil
+	if err := e.Content.Write(buf); err != nil {
+		return err
+	}
+	checksum := crc32.Checksum(buf.Bytes()[4:], castagnoli)
+	if err := binary.Write(buf, binary.LittleEndian, checksum); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
 }
 
 func (e *Command) BinarySize() uint32 {
 	if e.Content == nil {
-		return 16
+		return recordHeaderSize + recordTrailerSize
 	}
-	return 16 + e.Content.BinarySize()
+	return recordHeaderSize + e.Content.BinarySize() + recordTrailerSize
 }
 
 func (e *Command) String() string {
@@ -1,22 +1,31 @@
 package command
 
 import (
+	"encoding/binary"
 	"io"
+
+	"github.com/pkg/errors"
 )
 
+// CommitCommand marks the transaction as committed.
+// Seq is the commit sequence number, which orders transactions by commit instead of by start.
 type CommitCommand struct {
+	Seq uint64
 }
 
 func (e *CommitCommand) Read(size uint32, r io.Reader) error {
-	return nil
+	if size != 8 {
+		return errors.New("wrong data size")
+	}
+	return binary.Read(r, binary.LittleEndian, &e.Seq)
 }
 
 func (e *CommitCommand) Write(w io.Writer) (err error) {
-	return nil
+	return binary.Write(w, binary.LittleEndian, e.Seq)
 }
 
 func (e *CommitCommand) BinarySize() uint32 {
-	return 0
+	return 8
 }
 
 func (e *CommitCommand) TypeId() CommandType {
@@ -0,0 +1,128 @@
+package command
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+const deleteRangeCommandSize uint32 = 50
+
+// DeleteRangeCommand removes candles of a single year page with timestamps in [Start, End).
+type DeleteRangeCommand struct {
+	Year         uint16
+	CandleLength uint32
+	MarketCode   string
+	Code         string
+	Start        int64
+	End          int64
+}
+
+func NewDeleteRangeCommand(set page.CandleSet, r common.TimeRange) DeleteRangeCommand {
+	return DeleteRangeCommand{
+		Year:         set.Year,
+		CandleLength: set.CandleLength,
+		MarketCode:   set.MarketCode,
+		Code:         set.Code,
+		Start:        r.Start.Unix(),
+		End:          r.End.Unix(),
+	}
+}
+
+func (e *DeleteRangeCommand) Read(size uint32, r io.Reader) error {
+	if size != deleteRangeCommandSize {
+		return errors.New("wrong data size")
+	}
+	bin := make([]byte, deleteRangeCommandSize)
+	n, err := r.Read(bin)
+	if uint32(n) < deleteRangeCommandSize {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	e.Year = binary.LittleEndian.Uint16(bin[0:2])
+	e.CandleLength = binary.LittleEndian.Uint32(bin[2:6])
+	e.MarketCode = common.ReadNullPaddedString(bin[6:16])
+	e.Code = common.ReadNullPaddedString(bin[16:34])
+	e.Start = int64(binary.LittleEndian.Uint64(bin[34:42]))
+	e.End = int64(binary.LittleEndian.Uint64(bin[42:50]))
+	return nil
+}
+
+func (e *DeleteRangeCommand) Write(w io.Writer) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, e.Year); err != nil {
+		return
+	}
+	if err = binary.Write(w, binary.LittleEndian, e.CandleLength); err != nil {
+		return
+	}
+	if err := common.WriteNullPaddedString(page.MAX_MARKET_CODE_LENGTH, e.MarketCode, w); err != nil {
+		return errors.Wrap(err, "failed to write market code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_CODE_LENGTH, e.Code, w); err != nil {
+		return errors.Wrap(err, "failed to write code")
+	}
+	if err = binary.Write(w, binary.LittleEndian, e.Start); err != nil {
+		return
+	}
+	if err = binary.Write(w, binary.LittleEndian, e.End); err != nil {
+		return
+	}
+	return nil
+}
+
+func (e *DeleteRangeCommand) BinarySize() uint32 {
+	return deleteRangeCommandSize
+}
+
+func (e *DeleteRangeCommand) TypeId() CommandType {
+	return DeleteRangeCommandType
+}
+
+func (e *DeleteRangeCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewSetResourceName(e.TargetSet()),
+				Exclusive: true,
+			},
+		},
+	}
+}
+
+func (e *DeleteRangeCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	pageKey := e.TargetSet().UniqueKey()
+	unlock, err := accessor.AcquirePage(e.TargetSet(), true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "DeleteRangeCommand: acquire failed (key '%s')", pageKey)
+	}
+	defer unlock()
+
+	page, err := accessor.GetPage(e.TargetSet(), true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "DeleteRangeCommand: page load failed (key '%s')", pageKey)
+	}
+	return page.DeleteRange(e.Start, e.End), nil
+}
+
+func (e *DeleteRangeCommand) TargetSet() page.CandleSet {
+	return page.CandleSet{
+		Year: e.Year,
+		CandleSetWithoutYear: page.CandleSetWithoutYear{
+			CandleLength: e.CandleLength,
+			MarketCode:   e.MarketCode,
+			Code:         e.Code,
+		},
+	}
+}
+
+func (e *DeleteRangeCommand) String() string {
+	return fmt.Sprintf("DELETE(%s,%s,%d,%d,%d-%d)", e.MarketCode, e.Code, e.CandleLength, e.Year, e.Start, e.End)
+}
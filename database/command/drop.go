@@ -0,0 +1,210 @@
+package command
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+const dropCommandSize uint32 = 34
+
+// DropCommand removes all candles of a single year page.
+// The page file is deleted when the WAL is flushed.
+type DropCommand struct {
+	Year         uint16
+	CandleLength uint32
+	MarketCode   string
+	Code         string
+}
+
+func NewDropCommand(set page.CandleSet) DropCommand {
+	return DropCommand{
+		Year:         set.Year,
+		CandleLength: set.CandleLength,
+		MarketCode:   set.MarketCode,
+		Code:         set.Code,
+	}
+}
+
+func (e *DropCommand) Read(size uint32, r io.Reader) error {
+	if size != dropCommandSize {
+		return errors.New("wrong data size")
+	}
+	bin := make([]byte, dropCommandSize)
+	n, err := r.Read(bin)
+	if uint32(n) < dropCommandSize {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	e.Year = binary.LittleEndian.Uint16(bin[0:2])
+	e.CandleLength = binary.LittleEndian.Uint32(bin[2:6])
+	e.MarketCode = common.ReadNullPaddedString(bin[6:16])
+	e.Code = common.ReadNullPaddedString(bin[16:34])
+	return nil
+}
+
+func (e *DropCommand) Write(w io.Writer) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, e.Year); err != nil {
+		return
+	}
+	if err = binary.Write(w, binary.LittleEndian, e.CandleLength); err != nil {
+		return
+	}
+	if err := common.WriteNullPaddedString(page.MAX_MARKET_CODE_LENGTH, e.MarketCode, w); err != nil {
+		return errors.Wrap(err, "failed to write market code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_CODE_LENGTH, e.Code, w); err != nil {
+		return errors.Wrap(err, "failed to write code")
+	}
+	return nil
+}
+
+func (e *DropCommand) BinarySize() uint32 {
+	return dropCommandSize
+}
+
+func (e *DropCommand) TypeId() CommandType {
+	return DropCommandType
+}
+
+// Plan locks the whole code, so no pages of the code are created while it is dropped.
+func (e *DropCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewCodeResourceName(e.MarketCode, e.Code),
+				Exclusive: true,
+			},
+		},
+	}
+}
+
+func (e *DropCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	pageKey := e.TargetSet().UniqueKey()
+	unlock, err := accessor.AcquirePage(e.TargetSet(), true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "DropCommand: acquire failed (key '%s')", pageKey)
+	}
+	defer unlock()
+
+	page, err := accessor.GetPage(e.TargetSet(), true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "DropCommand: page load failed (key '%s')", pageKey)
+	}
+	return page.Clear(), nil
+}
+
+func (e *DropCommand) TargetSet() page.CandleSet {
+	return page.CandleSet{
+		Year: e.Year,
+		CandleSetWithoutYear: page.CandleSetWithoutYear{
+			CandleLength: e.CandleLength,
+			MarketCode:   e.MarketCode,
+			Code:         e.Code,
+		},
+	}
+}
+
+func (e *DropCommand) String() string {
+	return fmt.Sprintf("DROP(%s,%s,%d,%d)", e.MarketCode, e.Code, e.CandleLength, e.Year)
+}
+
+const dropAdjustmentsCommandSize uint32 = 32
+
+// DropAdjustmentsCommand removes all adjustments of a set.
+// The adjustment file is deleted when the WAL is flushed.
+type DropAdjustmentsCommand struct {
+	CandleLength uint32
+	MarketCode   string
+	Code         string
+}
+
+func NewDropAdjustmentsCommand(set page.CandleSetWithoutYear) DropAdjustmentsCommand {
+	return DropAdjustmentsCommand{
+		CandleLength: set.CandleLength,
+		MarketCode:   set.MarketCode,
+		Code:         set.Code,
+	}
+}
+
+func (e *DropAdjustmentsCommand) Read(size uint32, r io.Reader) error {
+	if size != dropAdjustmentsCommandSize {
+		return errors.New("wrong data size")
+	}
+	bin := make([]byte, dropAdjustmentsCommandSize)
+	n, err := r.Read(bin)
+	if uint32(n) < dropAdjustmentsCommandSize {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	e.CandleLength = binary.LittleEndian.Uint32(bin[0:4])
+	e.MarketCode = common.ReadNullPaddedString(bin[4:14])
+	e.Code = common.ReadNullPaddedString(bin[14:32])
+	return nil
+}
+
+func (e *DropAdjustmentsCommand) Write(w io.Writer) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, e.CandleLength); err != nil {
+		return
+	}
+	if err := common.WriteNullPaddedString(page.MAX_MARKET_CODE_LENGTH, e.MarketCode, w); err != nil {
+		return errors.Wrap(err, "failed to write market code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_CODE_LENGTH, e.Code, w); err != nil {
+		return errors.Wrap(err, "failed to write code")
+	}
+	return nil
+}
+
+func (e *DropAdjustmentsCommand) BinarySize() uint32 {
+	return dropAdjustmentsCommandSize
+}
+
+func (e *DropAdjustmentsCommand) TypeId() CommandType {
+	return DropAdjustmentsCommandType
+}
+
+func (e *DropAdjustmentsCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewCodeResourceName(e.MarketCode, e.Code),
+				Exclusive: true,
+			},
+		},
+	}
+}
+
+// Execute empties the adjustments, returning the number of removed adjustments.
+func (e *DropAdjustmentsCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	adjustments, err := accessor.GetAdjustments(e.TargetSet(), true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "DropAdjustmentsCommand: load failed (%s)", e.String())
+	}
+	removed := len(*adjustments)
+	*adjustments = common.AdjustmentList{}
+	return removed, nil
+}
+
+func (e *DropAdjustmentsCommand) TargetSet() page.CandleSetWithoutYear {
+	return page.CandleSetWithoutYear{
+		CandleLength: e.CandleLength,
+		MarketCode:   e.MarketCode,
+		Code:         e.Code,
+	}
+}
+
+func (e *DropAdjustmentsCommand) String() string {
+	return fmt.Sprintf("DROP_ADJUSTMENTS(%s,%s,%d)", e.MarketCode, e.Code, e.CandleLength)
+}
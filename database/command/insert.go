@@ -11,7 +11,7 @@ import (
 	"github.com/pkg/errors"
 )
 
-const insertCommandHeadSize uint32 = 38
+const insertCommandHeadSize uint32 = 39
 
 type InsertCommand struct {
 	Year         uint16
@@ -19,22 +19,24 @@ type InsertCommand struct {
 	MarketCode   string
 	Code         string
 	Count        uint32
+	Mode         page.ConflictMode
 	Candles      []common.TimestampCandle
 }
 
-func NewInsertCommand(set page.CandleSet, candles common.TimestampCandleList) InsertCommand {
+func NewInsertCommand(set page.CandleSet, candles common.TimestampCandleList, mode page.ConflictMode) InsertCommand {
 	return InsertCommand{
 		Year:         set.Year,
 		CandleLength: set.CandleLength,
 		MarketCode:   set.MarketCode,
 		Code:         set.Code,
 		Count:        uint32(len(candles)),
+		Mode:         mode,
 		Candles:      candles,
 	}
 }
 
 func (e *InsertCommand) Read(size uint32, r io.Reader) error {
-	if size < insertCommandHeadSize || (size-insertCommandHeadSize)%48 != 0 {
+	if size < insertCommandHeadSize || (size-insertCommandHeadSize)%common.TimestampCandleSize != 0 {
 		return errors.New("wrong data size")
 	}
 	headerBin := make([]byte, insertCommandHeadSize)
@@ -51,9 +53,13 @@ func (e *InsertCommand) Read(size uint32, r io.Reader) error {
 	e.MarketCode = common.ReadNullPaddedString(headerBin[6:16])
 	e.Code = common.ReadNullPaddedString(headerBin[16:34])
 	e.Count = binary.LittleEndian.Uint32(headerBin[34:38])
+	e.Mode = page.ConflictMode(headerBin[38])
+	if err := e.Mode.Validate(); err != nil {
+		return err
+	}
 	e.Candles = make([]common.TimestampCandle, e.Count)
 	for i := uint32(0); i < e.Count; i++ {
-		if err := e.Candles[i].Read(48, r); err != nil {
+		if err := e.Candles[i].Read(common.TimestampCandleSize, r); err != nil {
 			return err
 		}
 	}
@@ -76,6 +82,9 @@ func (e *InsertCommand) Write(w io.Writer) (err error) {
 	if err = binary.Write(w, binary.LittleEndian, e.Count); err != nil {
 		return
 	}
+	if err = binary.Write(w, binary.LittleEndian, e.Mode); err != nil {
+		return
+	}
 	for _, candle := range e.Candles {
 		if err = candle.Write(w); err != nil {
 			return
@@ -86,7 +95,7 @@ func (e *InsertCommand) Write(w io.Writer) (err error) {
 }
 
 func (e *InsertCommand) BinarySize() uint32 {
-	return insertCommandHeadSize + uint32(48*len(e.Candles))
+	return insertCommandHeadSize + uint32(common.TimestampCandleSize*len(e.Candles))
 }
 
 func (e *InsertCommand) TypeId() CommandType {
@@ -97,7 +106,7 @@ func (e *InsertCommand) Plan() CommandPlan {
 	return CommandPlan{
 		NeededLocks: []NeededLock{
 			{
-				Lock:      concurrency.NewSetResourceName(e.targetSet()),
+				Lock:      concurrency.NewSetResourceName(e.TargetSet()),
 				Exclusive: true,
 			},
 		},
@@ -105,24 +114,24 @@ func (e *InsertCommand) Plan() CommandPlan {
 }
 
 func (e *InsertCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
-	pageKey := e.targetSet().UniqueKey()
-	unlock, err := accessor.AcquirePage(e.targetSet(), true)
+	pageKey := e.TargetSet().UniqueKey()
+	unlock, err := accessor.AcquirePage(e.TargetSet(), true)
 	if err != nil {
 		return struct{}{}, errors.Wrapf(err, "InsertCommand: acquire failed (key '%s')", pageKey)
 	}
 	defer unlock()
 
-	page, err := accessor.GetPage(e.targetSet(), true)
+	page, err := accessor.GetPage(e.TargetSet(), true)
 	if err != nil {
 		return struct{}{}, errors.Wrapf(err, "InsertCommand: page load failed (key '%s')", pageKey)
 	}
-	if err := page.Add(common.TimestampCandleList(e.Candles).ToCandleList()); err != nil {
+	if err := page.Add(common.TimestampCandleList(e.Candles).ToCandleList(), e.Mode); err != nil {
 		return struct{}{}, errors.Wrapf(err, "InsertCommand: failed (key '%s')", pageKey)
 	}
 	return struct{}{}, nil
 }
 
-func (e *InsertCommand) targetSet() page.CandleSet {
+func (e *InsertCommand) TargetSet() page.CandleSet {
 	return page.CandleSet{
 		Year: e.Year,
 		CandleSetWithoutYear: page.CandleSetWithoutYear{
@@ -134,5 +143,5 @@ func (e *InsertCommand) targetSet() page.CandleSet {
 }
 
 func (e *InsertCommand) String() string {
-	return fmt.Sprintf("INSERT(%s,%s,%d,%d)", e.MarketCode, e.Code, e.CandleLength, e.Year)
+	return fmt.Sprintf("INSERT(%s,%s,%d,%d,%s)", e.MarketCode, e.Code, e.CandleLength, e.Year, e.Mode)
 }
@@ -0,0 +1,21 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/page"
+)
+
+func TestInsertCommandReadRejectsUnknownMode(t *testing.T) {
+	cmd := NewInsertCommand(testSet, common.TimestampCandleList{}, page.ConflictMode(9))
+	buf := bytes.Buffer{}
+	if err := cmd.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read := InsertCommand{}
+	if err := read.Read(uint32(buf.Len()), &buf); err == nil {
+		t.Fatal("expected an unknown conflict mode to be rejected")
+	}
+}
@@ -0,0 +1,95 @@
+package command
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// Records of logs written before magic and checksums were added are laid out as size(4) | txId(8) | type(4) | body(size).
+const legacyRecordHeaderSize = 16
+
+// Insert records written before conflict modes were added have a shorter head,
+// and declare candles as 48 bytes although TimestampCandle is written with 52.
+const baselineInsertHeadSize = 38
+const baselineCandleSize = 48
+
+// ReadLegacy reads a record of a log written before records had magic and checksums.
+// Such logs only have inserts without a conflict mode and commits without a body.
+// io.EOF is returned only if r has no bytes left.
+func (e *Command) ReadLegacy(r io.Reader) error {
+	headerBytes := make([]byte, legacyRecordHeaderSize)
+	if n, err := io.ReadFull(r, headerBytes); err != nil {
+		if n == 0 && err == io.EOF {
+			return io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return ErrTornRecord
+		}
+		return err
+	}
+	entrySize := binary.LittleEndian.Uint32(headerBytes[0:4])
+	e.TxID = binary.LittleEndian.Uint64(headerBytes[4:12])
+	e.Type = CommandType(binary.LittleEndian.Uint32(headerBytes[12:16]))
+
+	switch e.Type {
+	case InsertCommandType:
+		insert := &InsertCommand{}
+		if err := insert.readBaseline(entrySize, r); err != nil {
+			return err
+		}
+		e.Content = insert
+	case CommitCommandType:
+		// Commits had no body, and have no sequence number
+		if entrySize != 0 {
+			return errors.New("wrong data size")
+		}
+		e.Content = &CommitCommand{}
+	default:
+		return errors.Errorf("unexpected command type %d in a legacy log", e.Type)
+	}
+	return nil
+}
+
+// readBaseline reads an insert record written before conflict modes were added, which overwrote existing candles.
+func (e *InsertCommand) readBaseline(size uint32, r io.Reader) error {
+	if size < baselineInsertHeadSize || (size-baselineInsertHeadSize)%baselineCandleSize != 0 {
+		return errors.New("wrong data size")
+	}
+	headerBin := make([]byte, baselineInsertHeadSize)
+	if _, err := io.ReadFull(r, headerBin); err != nil {
+		return legacyBodyError(err)
+	}
+	e.Year = binary.LittleEndian.Uint16(headerBin[0:2])
+	e.CandleLength = binary.LittleEndian.Uint32(headerBin[2:6])
+	e.MarketCode = common.ReadNullPaddedString(headerBin[6:16])
+	e.Code = common.ReadNullPaddedString(headerBin[16:34])
+	e.Count = binary.LittleEndian.Uint32(headerBin[34:38])
+	e.Mode = page.ConflictOverwrite
+	if e.Count != (size-baselineInsertHeadSize)/baselineCandleSize {
+		return errors.New("wrong candle count")
+	}
+
+	e.Candles = make([]common.TimestampCandle, e.Count)
+	candleBin := make([]byte, common.TimestampCandleSize)
+	for i := uint32(0); i < e.Count; i++ {
+		if _, err := io.ReadFull(r, candleBin); err != nil {
+			return legacyBodyError(err)
+		}
+		if err := e.Candles[i].Read(common.TimestampCandleSize, bytes.NewReader(candleBin)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func legacyBodyError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTornRecord
+	}
+	return err
+}
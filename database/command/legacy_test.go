@@ -0,0 +1,92 @@
+package command
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/page"
+)
+
+var testSet = page.CandleSet{
+	Year:                 2022,
+	CandleSetWithoutYear: page.CandleSetWithoutYear{MarketCode: "X", Code: "A", CandleLength: 60},
+}
+
+// writeLegacyRecord writes a record the way logs were written before magic and checksums were added.
+func writeLegacyRecord(t *testing.T, buf *bytes.Buffer, txId uint64, typeId CommandType, size uint32, body []byte) {
+	t.Helper()
+	binary.Write(buf, binary.LittleEndian, size)
+	binary.Write(buf, binary.LittleEndian, txId)
+	binary.Write(buf, binary.LittleEndian, typeId)
+	buf.Write(body)
+}
+
+func TestReadLegacyBaselineInsert(t *testing.T) {
+	candles := common.TimestampCandleList{
+		{Timestamp: 1646092800, TimelessCandle: common.TimelessCandle{Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: 10}},
+		{Timestamp: 1646092860, TimelessCandle: common.TimelessCandle{Open: 2, High: 3, Low: 1.5, Close: 2.5, Volume: 20}},
+	}
+	insert := NewInsertCommand(testSet, candles, page.ConflictOverwrite)
+	body := bytes.Buffer{}
+	if err := insert.Write(&body); err != nil {
+		t.Fatal(err)
+	}
+	// Baseline heads had no conflict mode, and declared 48 bytes per candle
+	baseline := append(body.Bytes()[:baselineInsertHeadSize:baselineInsertHeadSize], body.Bytes()[insertCommandHeadSize:]...)
+
+	log := bytes.Buffer{}
+	writeLegacyRecord(t, &log, 7, InsertCommandType, baselineInsertHeadSize+baselineCandleSize*2, baseline)
+	writeLegacyRecord(t, &log, 7, CommitCommandType, 0, nil)
+
+	r := bytes.NewReader(log.Bytes())
+	e := Command{}
+	if err := e.ReadLegacy(r); err != nil {
+		t.Fatalf("failed to read insert: %v", err)
+	}
+	read, ok := e.Content.(*InsertCommand)
+	if !ok || e.TxID != 7 {
+		t.Fatalf("unexpected record %v", e)
+	}
+	if read.Code != "A" || read.Year != 2022 || read.Mode != page.ConflictOverwrite || len(read.Candles) != 2 {
+		t.Fatalf("unexpected insert %+v", read)
+	}
+	for i := range candles {
+		if read.Candles[i] != candles[i] {
+			t.Errorf("candle %d: expected %+v, got %+v", i, candles[i], read.Candles[i])
+		}
+	}
+
+	commit := Command{}
+	if err := commit.ReadLegacy(r); err != nil {
+		t.Fatalf("failed to read commit: %v", err)
+	}
+	if c, ok := commit.Content.(*CommitCommand); !ok || c.Seq != 0 {
+		t.Fatalf("unexpected commit %v", commit)
+	}
+}
+
+func TestReadLegacyTorn(t *testing.T) {
+	log := bytes.Buffer{}
+	writeLegacyRecord(t, &log, 3, InsertCommandType, baselineInsertHeadSize+baselineCandleSize, []byte{1, 2, 3})
+
+	e := Command{}
+	if err := e.ReadLegacy(bytes.NewReader(log.Bytes())); err != ErrTornRecord {
+		t.Fatalf("expected torn record, got %v", err)
+	}
+}
+
+func TestReadLegacyRejectsNewerRecords(t *testing.T) {
+	commit := bytes.Buffer{}
+	writeLegacyRecord(t, &commit, 3, CommitCommandType, 8, make([]byte, 8))
+	savepoint := bytes.Buffer{}
+	writeLegacyRecord(t, &savepoint, 3, SavepointCommandType, 0, nil)
+
+	for _, log := range []*bytes.Buffer{&commit, &savepoint} {
+		e := Command{}
+		if err := e.ReadLegacy(bytes.NewReader(log.Bytes())); err == nil || err == ErrTornRecord {
+			t.Errorf("expected an error, got %v", err)
+		}
+	}
+}
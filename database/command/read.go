@@ -0,0 +1,71 @@
+package command
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// ReadCommand reads candles of a single year page in [Range.Start, Range.End).
+// Reads are never written to the WAL.
+type ReadCommand struct {
+	Set   page.CandleSet
+	Range common.TimeRange
+}
+
+func NewReadCommand(set page.CandleSet, r common.TimeRange) ReadCommand {
+	return ReadCommand{
+		Set:   set,
+		Range: r,
+	}
+}
+
+func (e *ReadCommand) Read(size uint32, r io.Reader) error {
+	return errors.New("read command cannot be deserialized")
+}
+
+func (e *ReadCommand) Write(w io.Writer) error {
+	return errors.New("read command cannot be serialized")
+}
+
+func (e *ReadCommand) BinarySize() uint32 {
+	return 0
+}
+
+func (e *ReadCommand) TypeId() CommandType {
+	return ReadCommandType
+}
+
+func (e *ReadCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewSetResourceName(e.Set),
+				Exclusive: false,
+			},
+		},
+	}
+}
+
+func (e *ReadCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	pageKey := e.Set.UniqueKey()
+	unlock, err := accessor.AcquirePage(e.Set, false)
+	if err != nil {
+		return common.CandleList{}, errors.Wrapf(err, "ReadCommand: acquire failed (key '%s')", pageKey)
+	}
+	defer unlock()
+
+	page, err := accessor.GetPage(e.Set, false)
+	if err != nil {
+		return common.CandleList{}, errors.Wrapf(err, "ReadCommand: page load failed (key '%s')", pageKey)
+	}
+	return page.Slice(e.Range.Start.Unix(), e.Range.End.Unix()).ToCandleList(), nil
+}
+
+func (e *ReadCommand) String() string {
+	return fmt.Sprintf("READ(%s,%s,%d,%d)", e.Set.MarketCode, e.Set.Code, e.Set.CandleLength, e.Set.Year)
+}
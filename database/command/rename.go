@@ -0,0 +1,282 @@
+package command
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+const renameCommandSize uint32 = 62
+
+// RenameCommand moves a single year page to another market and code, emptying the source page.
+// The record is a marker without the moved candles, so replaying it reads the source page on disk.
+// The storage keeps the emptied source page in memory until the record is flushed, so that page is not overwritten before then.
+type RenameCommand struct {
+	Year           uint16
+	CandleLength   uint32
+	FromMarketCode string
+	FromCode       string
+	ToMarketCode   string
+	ToCode         string
+}
+
+func NewRenameCommand(from page.CandleSet, toMarketCode, toCode string) RenameCommand {
+	return RenameCommand{
+		Year:           from.Year,
+		CandleLength:   from.CandleLength,
+		FromMarketCode: from.MarketCode,
+		FromCode:       from.Code,
+		ToMarketCode:   toMarketCode,
+		ToCode:         toCode,
+	}
+}
+
+func (e *RenameCommand) Read(size uint32, r io.Reader) error {
+	if size != renameCommandSize {
+		return errors.New("wrong data size")
+	}
+	headerBin := make([]byte, renameCommandSize)
+	n, err := r.Read(headerBin)
+	if uint32(n) < renameCommandSize {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	e.Year = binary.LittleEndian.Uint16(headerBin[0:2])
+	e.CandleLength = binary.LittleEndian.Uint32(headerBin[2:6])
+	e.FromMarketCode = common.ReadNullPaddedString(headerBin[6:16])
+	e.FromCode = common.ReadNullPaddedString(headerBin[16:34])
+	e.ToMarketCode = common.ReadNullPaddedString(headerBin[34:44])
+	e.ToCode = common.ReadNullPaddedString(headerBin[44:62])
+	return nil
+}
+
+func (e *RenameCommand) Write(w io.Writer) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, e.Year); err != nil {
+		return
+	}
+	if err = binary.Write(w, binary.LittleEndian, e.CandleLength); err != nil {
+		return
+	}
+	if err := common.WriteNullPaddedString(page.MAX_MARKET_CODE_LENGTH, e.FromMarketCode, w); err != nil {
+		return errors.Wrap(err, "failed to write source market code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_CODE_LENGTH, e.FromCode, w); err != nil {
+		return errors.Wrap(err, "failed to write source code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_MARKET_CODE_LENGTH, e.ToMarketCode, w); err != nil {
+		return errors.Wrap(err, "failed to write destination market code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_CODE_LENGTH, e.ToCode, w); err != nil {
+		return errors.Wrap(err, "failed to write destination code")
+	}
+	return nil
+}
+
+func (e *RenameCommand) BinarySize() uint32 {
+	return renameCommandSize
+}
+
+func (e *RenameCommand) TypeId() CommandType {
+	return RenameCommandType
+}
+
+func (e *RenameCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewCodeResourceName(e.FromMarketCode, e.FromCode),
+				Exclusive: true,
+			},
+			{
+				Lock:      concurrency.NewCodeResourceName(e.ToMarketCode, e.ToCode),
+				Exclusive: true,
+			},
+		},
+	}
+}
+
+// Execute replaces the destination page with the candles of the source page, and empties the source page.
+func (e *RenameCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	from, to := e.SourceSet(), e.TargetSet()
+	unlockFrom, err := accessor.AcquirePage(from, true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "RenameCommand: acquire failed (key '%s')", from.UniqueKey())
+	}
+	defer unlockFrom()
+	unlockTo, err := accessor.AcquirePage(to, true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "RenameCommand: acquire failed (key '%s')", to.UniqueKey())
+	}
+	defer unlockTo()
+
+	fromPage, err := accessor.GetPage(from, true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "RenameCommand: page load failed (key '%s')", from.UniqueKey())
+	}
+	toPage, err := accessor.GetPage(to, true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "RenameCommand: page load failed (key '%s')", to.UniqueKey())
+	}
+	candles := fromPage.Body.ToCandleList()
+	fromPage.Clear()
+	toPage.Clear()
+	if err := toPage.Add(candles, page.ConflictOverwrite); err != nil {
+		return 0, errors.Wrapf(err, "RenameCommand: failed (key '%s')", to.UniqueKey())
+	}
+	return len(candles), nil
+}
+
+func (e *RenameCommand) SourceSet() page.CandleSet {
+	return page.CandleSet{
+		Year: e.Year,
+		CandleSetWithoutYear: page.CandleSetWithoutYear{
+			CandleLength: e.CandleLength,
+			MarketCode:   e.FromMarketCode,
+			Code:         e.FromCode,
+		},
+	}
+}
+
+func (e *RenameCommand) TargetSet() page.CandleSet {
+	return page.CandleSet{
+		Year: e.Year,
+		CandleSetWithoutYear: page.CandleSetWithoutYear{
+			CandleLength: e.CandleLength,
+			MarketCode:   e.ToMarketCode,
+			Code:         e.ToCode,
+		},
+	}
+}
+
+func (e *RenameCommand) String() string {
+	return fmt.Sprintf("RENAME(%s,%s->%s,%s,%d,%d)", e.FromMarketCode, e.FromCode, e.ToMarketCode, e.ToCode, e.CandleLength, e.Year)
+}
+
+const renameAdjustmentsCommandSize uint32 = 60
+
+// RenameAdjustmentsCommand moves the adjustments of a set to another market and code, replacing the adjustments there.
+// Like RenameCommand, the record is a marker, and replaying it reads the source adjustments on disk.
+type RenameAdjustmentsCommand struct {
+	CandleLength   uint32
+	FromMarketCode string
+	FromCode       string
+	ToMarketCode   string
+	ToCode         string
+}
+
+func NewRenameAdjustmentsCommand(from page.CandleSetWithoutYear, toMarketCode, toCode string) RenameAdjustmentsCommand {
+	return RenameAdjustmentsCommand{
+		CandleLength:   from.CandleLength,
+		FromMarketCode: from.MarketCode,
+		FromCode:       from.Code,
+		ToMarketCode:   toMarketCode,
+		ToCode:         toCode,
+	}
+}
+
+func (e *RenameAdjustmentsCommand) Read(size uint32, r io.Reader) error {
+	if size != renameAdjustmentsCommandSize {
+		return errors.New("wrong data size")
+	}
+	bin := make([]byte, renameAdjustmentsCommandSize)
+	n, err := r.Read(bin)
+	if uint32(n) < renameAdjustmentsCommandSize {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	e.CandleLength = binary.LittleEndian.Uint32(bin[0:4])
+	e.FromMarketCode = common.ReadNullPaddedString(bin[4:14])
+	e.FromCode = common.ReadNullPaddedString(bin[14:32])
+	e.ToMarketCode = common.ReadNullPaddedString(bin[32:42])
+	e.ToCode = common.ReadNullPaddedString(bin[42:60])
+	return nil
+}
+
+func (e *RenameAdjustmentsCommand) Write(w io.Writer) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, e.CandleLength); err != nil {
+		return
+	}
+	if err := common.WriteNullPaddedString(page.MAX_MARKET_CODE_LENGTH, e.FromMarketCode, w); err != nil {
+		return errors.Wrap(err, "failed to write source market code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_CODE_LENGTH, e.FromCode, w); err != nil {
+		return errors.Wrap(err, "failed to write source code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_MARKET_CODE_LENGTH, e.ToMarketCode, w); err != nil {
+		return errors.Wrap(err, "failed to write destination market code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_CODE_LENGTH, e.ToCode, w); err != nil {
+		return errors.Wrap(err, "failed to write destination code")
+	}
+	return nil
+}
+
+func (e *RenameAdjustmentsCommand) BinarySize() uint32 {
+	return renameAdjustmentsCommandSize
+}
+
+func (e *RenameAdjustmentsCommand) TypeId() CommandType {
+	return RenameAdjustmentsCommandType
+}
+
+func (e *RenameAdjustmentsCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewCodeResourceName(e.FromMarketCode, e.FromCode),
+				Exclusive: true,
+			},
+			{
+				Lock:      concurrency.NewCodeResourceName(e.ToMarketCode, e.ToCode),
+				Exclusive: true,
+			},
+		},
+	}
+}
+
+// Execute replaces the destination adjustments with the source ones, and empties the source adjustments.
+// It returns the number of moved adjustments.
+func (e *RenameAdjustmentsCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	from, err := accessor.GetAdjustments(e.SourceSet(), true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "RenameAdjustmentsCommand: load failed (%s)", e.String())
+	}
+	to, err := accessor.GetAdjustments(e.TargetSet(), true)
+	if err != nil {
+		return 0, errors.Wrapf(err, "RenameAdjustmentsCommand: load failed (%s)", e.String())
+	}
+	*to = from.Copy()
+	*from = common.AdjustmentList{}
+	return len(*to), nil
+}
+
+func (e *RenameAdjustmentsCommand) SourceSet() page.CandleSetWithoutYear {
+	return page.CandleSetWithoutYear{
+		CandleLength: e.CandleLength,
+		MarketCode:   e.FromMarketCode,
+		Code:         e.FromCode,
+	}
+}
+
+func (e *RenameAdjustmentsCommand) TargetSet() page.CandleSetWithoutYear {
+	return page.CandleSetWithoutYear{
+		CandleLength: e.CandleLength,
+		MarketCode:   e.ToMarketCode,
+		Code:         e.ToCode,
+	}
+}
+
+func (e *RenameAdjustmentsCommand) String() string {
+	return fmt.Sprintf("RENAME_ADJUSTMENTS(%s,%s->%s,%s,%d)", e.FromMarketCode, e.FromCode, e.ToMarketCode, e.ToCode, e.CandleLength)
+}
@@ -0,0 +1,24 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRenameIsLoggedAsMarker(t *testing.T) {
+	cmd := NewRenameCommand(testSet, "Y", "B")
+	buf := bytes.Buffer{}
+	if err := cmd.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if uint32(buf.Len()) != cmd.BinarySize() || cmd.BinarySize() != renameCommandSize {
+		t.Fatalf("expected a %d byte marker, got %d bytes", renameCommandSize, buf.Len())
+	}
+	read := RenameCommand{}
+	if err := read.Read(uint32(buf.Len()), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if read.SourceSet() != testSet || read.ToMarketCode != "Y" || read.ToCode != "B" {
+		t.Errorf("unexpected marker %+v", read)
+	}
+}
@@ -0,0 +1,109 @@
+package command
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const maxSavepointNameLength = 255
+
+// SavepointCommand marks a savepoint in the WAL. Entries of the transaction after the savepoint
+// are discarded by a following RollbackToCommand with the same name.
+type SavepointCommand struct {
+	Name string
+}
+
+// RollbackToCommand marks that the transaction rolled back to the last savepoint with the name.
+type RollbackToCommand struct {
+	Name string
+}
+
+func readSavepointName(size uint32, r io.Reader) (string, error) {
+	if size < 1 {
+		return "", errors.New("wrong data size")
+	}
+	bin := make([]byte, size)
+	n, err := io.ReadFull(r, bin)
+	if uint32(n) < size {
+		return "", io.EOF
+	}
+	if err != nil {
+		return "", err
+	}
+	if uint32(bin[0])+1 != size {
+		return "", errors.New("wrong data size")
+	}
+	return string(bin[1:]), nil
+}
+
+func writeSavepointName(name string, w io.Writer) error {
+	if len(name) > maxSavepointNameLength {
+		return errors.Errorf("savepoint name is too long (maximum %d, got %d)", maxSavepointNameLength, len(name))
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint8(len(name))); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte(name))
+	return err
+}
+
+func (e *SavepointCommand) Read(size uint32, r io.Reader) (err error) {
+	e.Name, err = readSavepointName(size, r)
+	return
+}
+
+func (e *SavepointCommand) Write(w io.Writer) error {
+	return writeSavepointName(e.Name, w)
+}
+
+func (e *SavepointCommand) BinarySize() uint32 {
+	return uint32(1 + len(e.Name))
+}
+
+func (e *SavepointCommand) TypeId() CommandType {
+	return SavepointCommandType
+}
+
+func (e *SavepointCommand) Plan() CommandPlan {
+	return CommandPlan{}
+}
+
+func (e *SavepointCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	return struct{}{}, nil
+}
+
+func (e *SavepointCommand) String() string {
+	return fmt.Sprintf("SAVEPOINT(%s)", e.Name)
+}
+
+func (e *RollbackToCommand) Read(size uint32, r io.Reader) (err error) {
+	e.Name, err = readSavepointName(size, r)
+	return
+}
+
+func (e *RollbackToCommand) Write(w io.Writer) error {
+	return writeSavepointName(e.Name, w)
+}
+
+func (e *RollbackToCommand) BinarySize() uint32 {
+	return uint32(1 + len(e.Name))
+}
+
+func (e *RollbackToCommand) TypeId() CommandType {
+	return RollbackToCommandType
+}
+
+func (e *RollbackToCommand) Plan() CommandPlan {
+	return CommandPlan{}
+}
+
+func (e *RollbackToCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	return struct{}{}, nil
+}
+
+func (e *RollbackToCommand) String() string {
+	return fmt.Sprintf("ROLLBACK_TO(%s)", e.Name)
+}
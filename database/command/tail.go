@@ -0,0 +1,71 @@
+package command
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// TailCommand reads the last Count candles of a single year page.
+// Like ReadCommand, it is never written to the WAL.
+type TailCommand struct {
+	Set   page.CandleSet
+	Count int
+}
+
+func NewTailCommand(set page.CandleSet, count int) TailCommand {
+	return TailCommand{
+		Set:   set,
+		Count: count,
+	}
+}
+
+func (e *TailCommand) Read(size uint32, r io.Reader) error {
+	return errors.New("tail command cannot be deserialized")
+}
+
+func (e *TailCommand) Write(w io.Writer) error {
+	return errors.New("tail command cannot be serialized")
+}
+
+func (e *TailCommand) BinarySize() uint32 {
+	return 0
+}
+
+func (e *TailCommand) TypeId() CommandType {
+	return TailCommandType
+}
+
+func (e *TailCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewSetResourceName(e.Set),
+				Exclusive: false,
+			},
+		},
+	}
+}
+
+func (e *TailCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	pageKey := e.Set.UniqueKey()
+	unlock, err := accessor.AcquirePage(e.Set, false)
+	if err != nil {
+		return common.CandleList{}, errors.Wrapf(err, "TailCommand: acquire failed (key '%s')", pageKey)
+	}
+	defer unlock()
+
+	page, err := accessor.GetPage(e.Set, false)
+	if err != nil {
+		return common.CandleList{}, errors.Wrapf(err, "TailCommand: page load failed (key '%s')", pageKey)
+	}
+	return page.Tail(e.Count).ToCandleList(), nil
+}
+
+func (e *TailCommand) String() string {
+	return fmt.Sprintf("TAIL(%s,%s,%d,%d,%d)", e.Set.MarketCode, e.Set.Code, e.Set.CandleLength, e.Set.Year, e.Count)
+}
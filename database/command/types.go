@@ -9,10 +9,32 @@ import (
 type CommandType uint32
 
 const (
-	CommitCommandType CommandType = 1
-	InsertCommandType CommandType = 2
+	CommitCommandType            CommandType = 1
+	InsertCommandType            CommandType = 2
+	ReadCommandType              CommandType = 3
+	TailCommandType              CommandType = 4
+	DeleteRangeCommandType       CommandType = 5
+	UpdateLastCommandType        CommandType = 6
+	DropCommandType              CommandType = 7
+	RenameCommandType            CommandType = 8
+	AdjustCommandType            CommandType = 9
+	ReadAdjustmentsCommandType   CommandType = 10
+	SavepointCommandType         CommandType = 11
+	RollbackToCommandType        CommandType = 12
+	RenameAdjustmentsCommandType CommandType = 13
+	DropAdjustmentsCommandType   CommandType = 14
 )
 
+// Logged returns if commands of this type should be written to the WAL.
+func (c CommandType) Logged() bool {
+	switch c {
+	case ReadCommandType, TailCommandType, ReadAdjustmentsCommandType:
+		return false
+	default:
+		return true
+	}
+}
+
 type Command struct {
 	TxID    uint64
 	Type    CommandType
@@ -26,6 +48,9 @@ type CommandPlan struct {
 type PageSetAccessor interface {
 	AcquirePage(set page.CandleSet, exclusive bool) (func(), error)
 	GetPage(set page.CandleSet, exclusive bool) (*page.Page, error)
+	// UpdateLast applies Page.UpdateLast to the page of the set, which may avoid copying the page
+	UpdateLast(set page.CandleSet, offset uint32, update common.CandleUpdate) error
+	GetAdjustments(set page.CandleSetWithoutYear, exclusive bool) (*common.AdjustmentList, error)
 }
 
 type NeededLock struct {
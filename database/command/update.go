@@ -0,0 +1,164 @@
+package command
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+const updateLastCommandHeadSize uint32 = 39
+
+// UpdateLastCommand applies a partial update to the in-progress (last) candle of a set.
+// Only the fields set in the update are written, so frequent updates keep the WAL small.
+type UpdateLastCommand struct {
+	Year            uint16
+	CandleLength    uint32
+	MarketCode      string
+	Code            string
+	TimestampOffset uint32
+	Update          common.CandleUpdate
+}
+
+func NewUpdateLastCommand(set page.CandleSet, timestampOffset uint32, update common.CandleUpdate) UpdateLastCommand {
+	return UpdateLastCommand{
+		Year:            set.Year,
+		CandleLength:    set.CandleLength,
+		MarketCode:      set.MarketCode,
+		Code:            set.Code,
+		TimestampOffset: timestampOffset,
+		Update:          update,
+	}
+}
+
+func (e *UpdateLastCommand) Read(size uint32, r io.Reader) error {
+	if size < updateLastCommandHeadSize {
+		return errors.New("wrong data size")
+	}
+	bin := make([]byte, size)
+	n, err := io.ReadFull(r, bin)
+	if uint32(n) < size {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	e.Year = binary.LittleEndian.Uint16(bin[0:2])
+	e.CandleLength = binary.LittleEndian.Uint32(bin[2:6])
+	e.MarketCode = common.ReadNullPaddedString(bin[6:16])
+	e.Code = common.ReadNullPaddedString(bin[16:34])
+	e.TimestampOffset = binary.LittleEndian.Uint32(bin[34:38])
+	e.Update = common.CandleUpdate{Fields: common.CandleUpdateField(bin[38])}
+	if size != e.BinarySize() {
+		return errors.New("wrong data size")
+	}
+
+	pos := updateLastCommandHeadSize
+	for _, field := range e.fields() {
+		if e.Update.Has(field.flag) {
+			*field.value = common.Float64frombytes(bin[pos : pos+8])
+			pos += 8
+		}
+	}
+	return nil
+}
+
+func (e *UpdateLastCommand) Write(w io.Writer) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, e.Year); err != nil {
+		return
+	}
+	if err = binary.Write(w, binary.LittleEndian, e.CandleLength); err != nil {
+		return
+	}
+	if err := common.WriteNullPaddedString(page.MAX_MARKET_CODE_LENGTH, e.MarketCode, w); err != nil {
+		return errors.Wrap(err, "failed to write market code")
+	}
+	if err := common.WriteNullPaddedString(page.MAX_CODE_LENGTH, e.Code, w); err != nil {
+		return errors.Wrap(err, "failed to write code")
+	}
+	if err = binary.Write(w, binary.LittleEndian, e.TimestampOffset); err != nil {
+		return
+	}
+	if err = binary.Write(w, binary.LittleEndian, e.Update.Fields); err != nil {
+		return
+	}
+	for _, field := range e.fields() {
+		if e.Update.Has(field.flag) {
+			if err = binary.Write(w, binary.LittleEndian, *field.value); err != nil {
+				return
+			}
+		}
+	}
+	return nil
+}
+
+type updateField struct {
+	flag  common.CandleUpdateField
+	value *float64
+}
+
+// fields lists the update fields in the order they are serialized.
+func (e *UpdateLastCommand) fields() []updateField {
+	return []updateField{
+		{common.UpdateOpen, &e.Update.Open},
+		{common.UpdateHigh, &e.Update.High},
+		{common.UpdateLow, &e.Update.Low},
+		{common.UpdateClose, &e.Update.Close},
+		{common.UpdateVolume, &e.Update.Volume},
+	}
+}
+
+func (e *UpdateLastCommand) BinarySize() uint32 {
+	mask := e.Update.Fields & (common.UpdateOpen | common.UpdateHigh | common.UpdateLow | common.UpdateClose | common.UpdateVolume)
+	return updateLastCommandHeadSize + uint32(8*bits.OnesCount8(uint8(mask)))
+}
+
+func (e *UpdateLastCommand) TypeId() CommandType {
+	return UpdateLastCommandType
+}
+
+func (e *UpdateLastCommand) Plan() CommandPlan {
+	return CommandPlan{
+		NeededLocks: []NeededLock{
+			{
+				Lock:      concurrency.NewSetResourceName(e.TargetSet()),
+				Exclusive: true,
+			},
+		},
+	}
+}
+
+func (e *UpdateLastCommand) Execute(accessor PageSetAccessor) (interface{}, error) {
+	pageKey := e.TargetSet().UniqueKey()
+	unlock, err := accessor.AcquirePage(e.TargetSet(), true)
+	if err != nil {
+		return struct{}{}, errors.Wrapf(err, "UpdateLastCommand: acquire failed (key '%s')", pageKey)
+	}
+	defer unlock()
+
+	if err := accessor.UpdateLast(e.TargetSet(), e.TimestampOffset, e.Update); err != nil {
+		return struct{}{}, errors.Wrapf(err, "UpdateLastCommand: failed (key '%s')", pageKey)
+	}
+	return struct{}{}, nil
+}
+
+func (e *UpdateLastCommand) TargetSet() page.CandleSet {
+	return page.CandleSet{
+		Year: e.Year,
+		CandleSetWithoutYear: page.CandleSetWithoutYear{
+			CandleLength: e.CandleLength,
+			MarketCode:   e.MarketCode,
+			Code:         e.Code,
+		},
+	}
+}
+
+func (e *UpdateLastCommand) String() string {
+	return fmt.Sprintf("UPDATE_LAST(%s,%s,%d,%d,%d)", e.MarketCode, e.Code, e.CandleLength, e.Year, e.TimestampOffset)
+}
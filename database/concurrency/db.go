@@ -1,6 +1,7 @@
 package concurrency
 
 import (
+	"context"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -55,21 +56,20 @@ type DatabaseLock struct {
 }
 
 func NewDatabaseLock() *DatabaseLock {
-	manager := LockManager{
-		txLocks: NewTransactionLockMap(),
-		entries: make(map[uint64]*LockEntry),
-	}
+	manager := newLockManager()
 	return &DatabaseLock{
-		manager: &manager,
-		lockSet: newMultiLevelLockSet(&manager),
+		manager: manager,
+		lockSet: newMultiLevelLockSet(manager),
 	}
 }
 
-func (d *DatabaseLock) EnsureLock(txId TransactionId, resource ResourceName, lockType LockType) error {
+// EnsureLock acquires or upgrades locks so the transaction holds lockType on the resource.
+// Waiting for other transactions ends with an error once ctx is done, or with ErrDeadlock if they wait on this one.
+func (d *DatabaseLock) EnsureLock(ctx context.Context, txId TransactionId, resource ResourceName, lockType LockType) error {
 	if lockType == NoLock {
 		return nil
 	}
-	if lockType != SLock && lockType != XLock {
+	if lockType != SLock && lockType != XLock && lockType != ISLock {
 		return errors.Errorf("unexpected lock type '%s'", lockType)
 	}
 
@@ -81,8 +81,16 @@ func (d *DatabaseLock) EnsureLock(txId TransactionId, resource ResourceName, loc
 		return nil
 	}
 
+	// Any explicit lock already grants intent to read descendants
+	if lockType == ISLock {
+		if explicitLockType != NoLock {
+			return nil
+		}
+		return d.acquireSIntent(ctx, txId, lock)
+	}
+
 	if explicitLockType != NoLock {
-		if err := lock.Esclate(txId); err != nil {
+		if err := lock.Esclate(ctx, txId); err != nil {
 			return errors.Wrap(err, "failed to esclate")
 		}
 		lockTypeAfterEsclate := lock.LockType(txId)
@@ -90,7 +98,11 @@ func (d *DatabaseLock) EnsureLock(txId TransactionId, resource ResourceName, loc
 			panic(errors.Errorf("lock for '%s' esclated but not S/X", lock.name))
 		}
 		if lockTypeAfterEsclate == SLock && lockType == XLock {
-			if err := lock.Promote(txId, XLock); err != nil {
+			// Ancestors only have IS for S, and X needs IX
+			if err := d.acquireXIntent(ctx, txId, lock.parent); err != nil {
+				return err
+			}
+			if err := lock.Promote(ctx, txId, XLock); err != nil {
 				return errors.Wrap(err, "failed to promote S->X after esclation")
 			}
 		}
@@ -98,18 +110,18 @@ func (d *DatabaseLock) EnsureLock(txId TransactionId, resource ResourceName, loc
 	}
 
 	if lockType == SLock {
-		if err := d.acquireSIntent(txId, lock.parent); err != nil {
+		if err := d.acquireSIntent(ctx, txId, lock.parent); err != nil {
 			return err
 		}
-		return lock.Acquire(txId, SLock)
+		return lock.Acquire(ctx, txId, SLock)
 	}
-	if err := d.acquireXIntent(txId, lock.parent); err != nil {
+	if err := d.acquireXIntent(ctx, txId, lock.parent); err != nil {
 		return err
 	}
-	return lock.Acquire(txId, XLock)
+	return lock.Acquire(ctx, txId, XLock)
 }
 
-func (d *DatabaseLock) acquireSIntent(txId TransactionId, lock *MultiLevelLock) error {
+func (d *DatabaseLock) acquireSIntent(ctx context.Context, txId TransactionId, lock *MultiLevelLock) error {
 	if lock == nil {
 		return nil
 	}
@@ -122,14 +134,14 @@ func (d *DatabaseLock) acquireSIntent(txId TransactionId, lock *MultiLevelLock)
 		return nil
 	}
 	if lock.parent != nil {
-		if err := d.acquireSIntent(txId, lock.parent); err != nil {
+		if err := d.acquireSIntent(ctx, txId, lock.parent); err != nil {
 			return err
 		}
 	}
-	return lock.Acquire(txId, ISLock)
+	return lock.Acquire(ctx, txId, ISLock)
 }
 
-func (d *DatabaseLock) acquireXIntent(txId TransactionId, lock *MultiLevelLock) error {
+func (d *DatabaseLock) acquireXIntent(ctx context.Context, txId TransactionId, lock *MultiLevelLock) error {
 	if lock == nil {
 		return nil
 	}
@@ -142,17 +154,27 @@ func (d *DatabaseLock) acquireXIntent(txId TransactionId, lock *MultiLevelLock)
 		return nil
 	}
 	if lock.parent != nil {
-		if err := d.acquireXIntent(txId, lock.parent); err != nil {
+		if err := d.acquireXIntent(ctx, txId, lock.parent); err != nil {
 			return err
 		}
 	}
 	if lockType == ISLock {
-		return lock.Promote(txId, IXLock)
+		return lock.Promote(ctx, txId, IXLock)
 	}
 	if lockType == SLock {
-		return lock.Promote(txId, SIXLock)
+		return lock.Promote(ctx, txId, SIXLock)
+	}
+	return lock.Acquire(ctx, txId, IXLock)
+}
+
+// Release releases the lock the transaction explicitly holds on the resource.
+// Intent locks on ancestors are kept until Free is called.
+func (d *DatabaseLock) Release(txId TransactionId, resource ResourceName) error {
+	lock := d.lockSet.Get(resource)
+	if lock.LockType(txId) == NoLock {
+		return nil
 	}
-	return lock.Acquire(txId, IXLock)
+	return lock.Release(txId)
 }
 
 func (d *DatabaseLock) Free(txId TransactionId) error {
@@ -0,0 +1,33 @@
+package concurrency
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEnsureLockPromotesSToXWithIntentOnAncestors(t *testing.T) {
+	d := NewDatabaseLock()
+	txId := TransactionId(1)
+	code := NewCodeResourceName("TEST", "A")
+	market := NewMarketResourceName("TEST")
+
+	if err := d.EnsureLock(context.Background(), txId, code, SLock); err != nil {
+		t.Fatal(err)
+	}
+	if lockType := d.lockSet.Get(market).LockType(txId); lockType != ISLock {
+		t.Fatalf("expected IS on the market for S, got %s", lockType)
+	}
+	// X on the code needs IX on its ancestors, which only have IS for S
+	if err := d.EnsureLock(context.Background(), txId, code, XLock); err != nil {
+		t.Fatal(err)
+	}
+	if lockType := d.lockSet.Get(code).LockType(txId); lockType != XLock {
+		t.Errorf("expected X on the code, got %s", lockType)
+	}
+	if lockType := d.lockSet.Get(market).LockType(txId); lockType != IXLock {
+		t.Errorf("expected IX on the market, got %s", lockType)
+	}
+	if err := d.Free(txId); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -47,31 +47,73 @@ func (l *LockEntry) LockCompatible(lockType LockType, txId TransactionId) bool {
 	return l.lockCompatible(lockType, txId)
 }
 
-func (l *LockEntry) AddToQueue(request lockRequest, front bool) {
+// AddToQueue grants the request if possible, returning true. Otherwise the request is queued,
+// and its Ack channel receives once the lock is granted.
+// Promotions of a held lock are not queued behind other requests, as those wait for the held lock anyway.
+func (l *LockEntry) AddToQueue(request lockRequest, front bool) bool {
 	l.accessLock.Lock()
 	defer l.accessLock.Unlock()
 
-	if !l.queue.HasNext() && l.lockCompatible(request.Lock.Type, request.Lock.Transaction) {
+	_, holding := l.locks[request.Lock.Transaction]
+	if (holding || !l.queue.HasNext()) && l.lockCompatible(request.Lock.Type, request.Lock.Transaction) {
 		l.grantLock(request.Lock)
-		request.Ack <- true
-		return
+		return true
 	}
 	if front {
 		l.queue.PushFront(request)
 	} else {
 		l.queue.PushEnd(request)
 	}
+	return false
+}
+
+// Cancel removes a queued request, returning false if it was already granted.
+func (l *LockEntry) Cancel(ack chan<- bool) bool {
+	l.accessLock.Lock()
+	defer l.accessLock.Unlock()
+
+	if !l.queue.Remove(ack) {
+		return false
+	}
+	// Requests queued behind the cancelled one may be grantable now
+	l.processQueue()
+	return true
+}
+
+// Blockers returns transactions the queued request is waiting for:
+// holders of incompatible locks, and transactions with requests queued before it.
+func (l *LockEntry) Blockers(request lockRequest) []TransactionId {
+	l.accessLock.Lock()
+	defer l.accessLock.Unlock()
+
+	result := make([]TransactionId, 0)
+	for _, lock := range l.locks {
+		if lock.Transaction != request.Lock.Transaction && !request.Lock.Type.Compatible(lock.Type) {
+			result = append(result, lock.Transaction)
+		}
+	}
+	if _, holding := l.locks[request.Lock.Transaction]; holding {
+		return result
+	}
+	for _, queued := range l.queue.Before(request.Ack) {
+		if queued.Lock.Transaction != request.Lock.Transaction {
+			result = append(result, queued.Lock.Transaction)
+		}
+	}
+	return result
 }
 
 func (l *LockEntry) processQueue() {
-	popped := l.queue.PopMatching(func(item *lockRequest) bool {
-		return l.lockCompatible(item.Lock.Type, item.Lock.Transaction)
-	})
-	if popped == nil {
-		return
+	for {
+		popped := l.queue.PopMatching(func(item *lockRequest) bool {
+			return l.lockCompatible(item.Lock.Type, item.Lock.Transaction)
+		})
+		if popped == nil {
+			return
+		}
+		l.grantLock(popped.Lock)
+		popped.Ack <- true
 	}
-	l.grantLock(popped.Lock)
-	popped.Ack <- true
 }
 
 func (l *LockEntry) grantLock(lock Lock) {
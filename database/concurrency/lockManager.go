@@ -1,6 +1,7 @@
 package concurrency
 
 import (
+	"context"
 	"sync"
 
 	errSlice "github.com/carlmjohnson/errors"
@@ -8,10 +9,24 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// ErrDeadlock is returned instead of waiting for a lock, when the transaction would end up waiting on itself.
+var ErrDeadlock = errors.New("deadlock detected")
+
 type LockManager struct {
 	txLocks     TransactionLockMap
 	entries     map[uint64]*LockEntry
 	entriesLock sync.Mutex
+	// waiting has requests of transactions waiting for a lock, guarded by waitLock
+	waiting  map[TransactionId]lockRequest
+	waitLock sync.Mutex
+}
+
+func newLockManager() *LockManager {
+	return &LockManager{
+		txLocks: NewTransactionLockMap(),
+		entries: make(map[uint64]*LockEntry),
+		waiting: make(map[TransactionId]lockRequest),
+	}
 }
 
 func (l *LockManager) getResourceEntry(name ResourceName) *LockEntry {
@@ -24,22 +39,80 @@ func (l *LockManager) getResourceEntry(name ResourceName) *LockEntry {
 	return l.entries[name.hashValue]
 }
 
-func (l *LockManager) Acquire(txId TransactionId, name ResourceName, lockType LockType) error {
+// wait adds the lock request to the resource, and blocks until it is granted or the context is done.
+// ErrDeadlock is returned without waiting if the transactions the request waits for are waiting on this one.
+func (l *LockManager) wait(ctx context.Context, resource *LockEntry, wantedLock Lock) error {
+	ack := make(chan bool, 1)
+	request := lockRequest{Lock: wantedLock, Ack: ack}
+
+	l.waitLock.Lock()
+	if resource.AddToQueue(request, false) {
+		l.waitLock.Unlock()
+		return nil
+	}
+	if l.waitsOn(request, wantedLock.Transaction) {
+		resource.Cancel(ack)
+		l.waitLock.Unlock()
+		return errors.Wrapf(ErrDeadlock, "waiting for '%s' lock on '%s'", wantedLock.Type, wantedLock.Name)
+	}
+	l.waiting[wantedLock.Transaction] = request
+	l.waitLock.Unlock()
+
+	defer func() {
+		l.waitLock.Lock()
+		delete(l.waiting, wantedLock.Transaction)
+		l.waitLock.Unlock()
+	}()
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		if resource.Cancel(ack) {
+			return errors.Wrapf(ctx.Err(), "waiting for '%s' lock on '%s'", wantedLock.Type, wantedLock.Name)
+		}
+		// Granted while being cancelled, so the lock is held now
+		return nil
+	}
+}
+
+// waitsOn returns if the request waits for txId, directly or through other waiting transactions.
+// waitLock must be held.
+func (l *LockManager) waitsOn(request lockRequest, txId TransactionId) bool {
+	visited := make(map[TransactionId]bool)
+	pending := l.getResourceEntry(request.Lock.Name).Blockers(request)
+	for len(pending) > 0 {
+		blocker := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if blocker == txId {
+			return true
+		}
+		if visited[blocker] {
+			continue
+		}
+		visited[blocker] = true
+		if waiting, ok := l.waiting[blocker]; ok {
+			pending = append(pending, l.getResourceEntry(waiting.Lock.Name).Blockers(waiting)...)
+		}
+	}
+	return false
+}
+
+func (l *LockManager) Acquire(ctx context.Context, txId TransactionId, name ResourceName, lockType LockType) error {
 	log.Debug().Uint64("txId", uint64(txId)).Stringer("resource", name).Stringer("type", lockType).Msg("Acquire")
 	wantedLock := Lock{Name: name, Transaction: txId, Type: lockType}
-	ack := make(chan bool)
 	resource := l.getResourceEntry(name)
 
 	if l.txLocks.Contains(wantedLock) {
 		return errors.Errorf("'%s' lock already held by this transaction", lockType)
 	}
-	go resource.AddToQueue(lockRequest{Lock: wantedLock, Ack: ack}, false)
-	<-ack
+	if err := l.wait(ctx, resource, wantedLock); err != nil {
+		return err
+	}
 	l.txLocks.AddLock(txId, name, lockType)
 	return nil
 }
 
-func (l *LockManager) AcquireThenRelease(txId TransactionId, name ResourceName, lockType LockType, releases []ResourceName) error {
+func (l *LockManager) AcquireThenRelease(ctx context.Context, txId TransactionId, name ResourceName, lockType LockType, releases []ResourceName) error {
 	log.Debug().Uint64("txId", uint64(txId)).Stringer("resource", name).Stringer("type", lockType).Msg("AcquireThenRelease")
 	for _, release := range releases {
 		if !l.txLocks.ContainsResource(txId, release) {
@@ -52,9 +125,9 @@ func (l *LockManager) AcquireThenRelease(txId TransactionId, name ResourceName,
 		return errors.New("tx already has wanted lock")
 	}
 	resource := l.getResourceEntry(name)
-	ack := make(chan bool)
-	go resource.AddToQueue(lockRequest{Lock: wantedLock, Ack: ack}, false)
-	<-ack
+	if err := l.wait(ctx, resource, wantedLock); err != nil {
+		return err
+	}
 	l.txLocks.AddLock(txId, name, lockType)
 
 	for _, release := range releases {
@@ -65,7 +138,7 @@ func (l *LockManager) AcquireThenRelease(txId TransactionId, name ResourceName,
 	return nil
 }
 
-func (l *LockManager) Promote(txId TransactionId, name ResourceName, newLockType LockType) error {
+func (l *LockManager) Promote(ctx context.Context, txId TransactionId, name ResourceName, newLockType LockType) error {
 	log.Debug().Uint64("txId", uint64(txId)).Stringer("resource", name).Stringer("type", newLockType).Msg("Promote")
 	if !l.txLocks.ContainsResource(txId, name) {
 		return errors.New("Transaction does not have lock on this resource")
@@ -79,11 +152,8 @@ func (l *LockManager) Promote(txId TransactionId, name ResourceName, newLockType
 		return errors.Errorf("Cannot promote lock '%s' to '%s'", existingType, newLockType)
 	}
 
-	ack := make(chan bool)
 	wantedLock := Lock{Name: name, Transaction: txId, Type: newLockType}
-	go resourceEntry.AddToQueue(lockRequest{Lock: wantedLock, Ack: ack}, false)
-	<-ack
-	return nil
+	return l.wait(ctx, resourceEntry, wantedLock)
 }
 
 func (l *LockManager) Release(txId TransactionId, name ResourceName) error {
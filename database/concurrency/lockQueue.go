@@ -64,3 +64,36 @@ func (l *lockQueue) HasNext() bool {
 	defer l.lock.Unlock()
 	return l.queue.Len() != 0
 }
+
+// Remove removes the request with the ack channel, returning false if it is not queued anymore.
+func (l *lockQueue) Remove(ack chan<- bool) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	index := l.queue.Index(func(i interface{}) bool {
+		return i.(lockRequest).Ack == ack
+	})
+	if index == -1 {
+		return false
+	}
+	l.queue.Remove(index)
+	return true
+}
+
+// Before returns requests queued before the request with the ack channel, or nothing if it is not queued.
+func (l *lockQueue) Before(ack chan<- bool) []lockRequest {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for i := 0; i < l.queue.Len(); i++ {
+		if l.queue.At(i).(lockRequest).Ack != ack {
+			continue
+		}
+		result := make([]lockRequest, 0, i)
+		for j := 0; j < i; j++ {
+			result = append(result, l.queue.At(j).(lockRequest))
+		}
+		return result
+	}
+	return []lockRequest{}
+}
@@ -1,6 +1,7 @@
 package concurrency
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/pkg/errors"
@@ -78,7 +79,7 @@ func (m *MultiLevelLock) LockType(txId TransactionId) LockType {
 	return m.manager.LockType(txId, m.name)
 }
 
-func (m *MultiLevelLock) Acquire(txId TransactionId, lockType LockType) error {
+func (m *MultiLevelLock) Acquire(ctx context.Context, txId TransactionId, lockType LockType) error {
 	log.Debug().Uint64("txId", uint64(txId)).Stringer("resource", m.name).Stringer("type", lockType).Msg("Acquire requested")
 	if m.parent != nil {
 		parentLockType := m.manager.LockType(txId, m.parent.name)
@@ -86,7 +87,7 @@ func (m *MultiLevelLock) Acquire(txId TransactionId, lockType LockType) error {
 			return errors.Errorf("incompatible lock type with parent (child %s, parent %s)", lockType, parentLockType)
 		}
 	}
-	if err := m.manager.Acquire(txId, m.name, lockType); err != nil {
+	if err := m.manager.Acquire(ctx, txId, m.name, lockType); err != nil {
 		return errors.Wrapf(err, "failed to lock (%s,%s,txId=%d)", m.name, lockType, txId)
 	}
 	if m.parent != nil {
@@ -110,7 +111,7 @@ func (m *MultiLevelLock) Release(txId TransactionId) error {
 	return nil
 }
 
-func (m *MultiLevelLock) Promote(txId TransactionId, newLockType LockType) error {
+func (m *MultiLevelLock) Promote(ctx context.Context, txId TransactionId, newLockType LockType) error {
 	log.Debug().Uint64("txId", uint64(txId)).Stringer("resource", m.name).Stringer("type", newLockType).Msg("Promotion requested")
 	prevLockType := m.LockType(txId)
 	if prevLockType == newLockType {
@@ -125,7 +126,7 @@ func (m *MultiLevelLock) Promote(txId TransactionId, newLockType LockType) error
 			return errors.Errorf("incompatible lock type with parent (child %s, parent %s)", newLockType, parentLockType)
 		}
 	}
-	if err := m.manager.Promote(txId, m.name, newLockType); err != nil {
+	if err := m.manager.Promote(ctx, txId, m.name, newLockType); err != nil {
 		return errors.Wrapf(err, "failed to promote (%s,%s->%s,txId=%d)", m.name, prevLockType, newLockType, txId)
 	}
 
@@ -142,7 +143,7 @@ func (m *MultiLevelLock) Promote(txId TransactionId, newLockType LockType) error
 	return nil
 }
 
-func (m *MultiLevelLock) Esclate(txId TransactionId) error {
+func (m *MultiLevelLock) Esclate(ctx context.Context, txId TransactionId) error {
 	log.Debug().Uint64("txId", uint64(txId)).Stringer("resource", m.name).Msg("Esclation requested")
 	prevLockType := m.LockType(txId)
 	if prevLockType == SLock || prevLockType == XLock {
@@ -163,9 +164,9 @@ func (m *MultiLevelLock) Esclate(txId TransactionId) error {
 
 	var releaseErr error = nil
 	if m.LockType(txId) == ISLock {
-		releaseErr = m.manager.AcquireThenRelease(txId, m.name, SLock, toRelease)
+		releaseErr = m.manager.AcquireThenRelease(ctx, txId, m.name, SLock, toRelease)
 	} else {
-		releaseErr = m.manager.AcquireThenRelease(txId, m.name, XLock, toRelease)
+		releaseErr = m.manager.AcquireThenRelease(ctx, txId, m.name, XLock, toRelease)
 	}
 	if releaseErr != nil {
 		return errors.Wrap(releaseErr, "failed to switch locks")
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jungnoh/mora/database/util"
+)
+
+func TestNewDatabaseRejectsUnknownDurability(t *testing.T) {
+	config := testConfig(t)
+	config.Durability = "fsync"
+	if _, err := NewDatabase(config); err == nil {
+		t.Fatal("expected an unknown durability mode to be rejected")
+	}
+}
+
+func TestNewDatabaseRejectsUnknownValidationModes(t *testing.T) {
+	config := testConfig(t)
+	config.Validation = "strct"
+	if _, err := NewDatabase(config); err == nil {
+		t.Fatal("expected an unknown validation mode to be rejected")
+	}
+
+	config = testConfig(t)
+	config.MarketValidation = map[string]util.ValidationMode{"TEST": "strct"}
+	if _, err := NewDatabase(config); err == nil {
+		t.Fatal("expected an unknown market validation mode to be rejected")
+	}
+}
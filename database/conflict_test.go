@@ -0,0 +1,65 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+func TestWriteRejectFailsWholeWrite(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	existing := testCandles(testStart, 2, 10)
+	if _, err := db.Write(set, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first year has no conflicts, but the write fails as a whole
+	candles := append(testCandles(testStart.AddDate(-1, 0, 0), 2, 100), testCandles(testStart.Add(time.Minute), 2, 20)...)
+	if _, err := db.WriteWithMode(set, candles, page.ConflictReject); errors.Cause(err) != page.ErrDuplicateTimestamp {
+		t.Fatalf("expected duplicate timestamp error, got %v", err)
+	}
+	expectCandles(t, readAll(t, db, set), existing)
+}
+
+func TestWriteMergeOHLC(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	existing := testCandles(testStart, 1, 10)
+	if _, err := db.Write(set, existing); err != nil {
+		t.Fatal(err)
+	}
+	update := testCandles(testStart, 1, 20)
+	if _, err := db.WriteWithMode(set, update, page.ConflictMergeOHLC); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := existing[0]
+	expected.High = update[0].High
+	expected.Close = update[0].Close
+	expected.Volume += update[0].Volume
+	got := readAll(t, db, set)
+	if len(got) != 1 || got[0].TimelessCandle != expected.TimelessCandle {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestWriteRejectsUnknownConflictMode(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	candles := testCandles(testStart, 2, 10)
+
+	if _, err := db.WriteWithMode(set, candles, page.ConflictMode(9)); err == nil {
+		t.Fatal("expected an unknown conflict mode to be rejected")
+	}
+	insert := command.NewInsertCommand(page.CandleSet{Year: 2022, CandleSetWithoutYear: set}, candles.ToTimestampCandleList(), page.ConflictMode(9))
+	if _, err := db.Execute([]command.CommandContent{&insert}); err == nil {
+		t.Fatal("expected an insert command with an unknown conflict mode to be rejected")
+	}
+	if got := readAll(t, db, set); len(got) != 0 {
+		t.Fatalf("expected nothing to be written, got %v", got)
+	}
+}
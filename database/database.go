@@ -1,57 +1,237 @@
 package database
 
 import (
+	"time"
+
 	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/catalog"
 	"github.com/jungnoh/mora/database/command"
 	"github.com/jungnoh/mora/database/concurrency"
 	"github.com/jungnoh/mora/database/storage"
 	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/database/validation"
 	"github.com/jungnoh/mora/page"
 	"github.com/pkg/errors"
 )
 
 type Database struct {
-	config  util.Config
-	Storage *storage.Storage
-	Lock    *concurrency.DatabaseLock
+	config    util.Config
+	Storage   *storage.Storage
+	Lock      *concurrency.DatabaseLock
+	rollups   *rollupRegistry
+	catalog   *catalog.Catalog
+	validator *validation.Validator
 }
 
 func NewDatabase(config util.Config) (*Database, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
 	db := Database{}
 	db.config = config
 	db.Storage = storage.NewStorage(&db.config)
 	db.Lock = concurrency.NewDatabaseLock()
+	db.rollups = newRollupRegistry()
+	db.validator = validation.NewValidator(&db.config)
+
+	sets, err := db.Storage.ListSets()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build catalog")
+	}
+	db.catalog = catalog.NewCatalog()
+	db.catalog.Add(sets...)
 
 	return &db, nil
 }
 func (d *Database) Execute(commands []command.CommandContent) ([]interface{}, error) {
-	accessor, err := d.Storage.Access()
+	tx, err := d.begin()
 	if err != nil {
 		return []interface{}{}, err
 	}
-	tx := NewTransactionContext(&accessor, d.Lock)
 	defer tx.RollbackIfActive()
+	return tx.executeAndCommit(commands)
+}
 
+func (d *Database) begin() (*TransactionContext, error) {
+	accessor, err := d.Storage.Access()
+	if err != nil {
+		return nil, err
+	}
+	tx := NewTransactionContext(&accessor, d.Lock)
+	tx.rollups = d.rollups
+	tx.catalog = d.catalog
+	tx.validator = d.validator
 	if err := tx.Start(); err != nil {
-		return []interface{}{}, errors.Wrapf(err, "failed to start")
+		return nil, errors.Wrapf(err, "failed to start")
+	}
+	return &tx, nil
+}
+
+// High level commands
+func (d *Database) Write(set page.CandleSetWithoutYear, candles common.CandleList) ([]interface{}, error) {
+	return d.WriteWithMode(set, candles, page.ConflictOverwrite)
+}
+
+// WriteWithMode writes candles, resolving candles with existing timestamps with the given mode.
+// With page.ConflictReject, the whole write fails if any timestamp already exists or is repeated in candles.
+func (d *Database) WriteWithMode(set page.CandleSetWithoutYear, candles common.CandleList, mode page.ConflictMode) ([]interface{}, error) {
+	if err := mode.Validate(); err != nil {
+		return []interface{}{}, err
 	}
+	return d.Execute(CommandContentFactory{}.InsertToSet(set, candles, mode))
+}
+
+// UpdateLast applies a partial update to the in-progress candle of the set starting at t.
+// If t is after the last candle, a new candle is started. Rollups of the set are updated in the same way.
+// The candle resulting from the update is validated like inserted candles are.
+func (d *Database) UpdateLast(set page.CandleSetWithoutYear, t time.Time, update common.CandleUpdate) error {
+	year, err := pageYear(t)
+	if err != nil {
+		return err
+	}
+	if set.CandleLength > 0 && common.BucketStart(t.Unix(), set.CandleLength) != t.Unix() {
+		return errors.Errorf("time %s is not aligned to candle length %d", t.UTC().Format(time.RFC3339), set.CandleLength)
+	}
+	candleSet := page.CandleSet{CandleSetWithoutYear: set, Year: year}
+	offset := uint32(t.Unix() - common.GetStartOfYearTimestamp(int(year)))
+	cmd := command.NewUpdateLastCommand(candleSet, offset, update)
+	_, err = d.Execute([]command.CommandContent{&cmd})
+	return err
+}
+
+// DeleteRange removes candles of the set with timestamps in [r.Start, r.End), returning the number of removed candles.
+func (d *Database) DeleteRange(set page.CandleSetWithoutYear, r common.TimeRange) (int, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.RollbackIfActive()
 
-	result := make([]interface{}, 0, len(commands))
-	for _, cmd := range commands {
-		cmdResult, err := tx.Execute(cmd)
+	years, err := tx.lockYears(set, r, true)
+	if err != nil {
+		return 0, err
+	}
+	results, err := tx.executeAndCommit(CommandContentFactory{}.DeleteFromSet(set, years, r))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, result := range results {
+		removed += result.(int)
+	}
+	return removed, nil
+}
+
+// Read returns candles of the set with timestamps in [r.Start, r.End), spanning year pages if needed.
+// Only years having candles are read.
+func (d *Database) Read(set page.CandleSetWithoutYear, r common.TimeRange, opts ...ReadOption) (common.CandleList, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return common.CandleList{}, err
+	}
+	defer tx.RollbackIfActive()
+
+	options := newReadOptions(opts)
+	commands, err := tx.readCommands(set, r, options)
+	if err != nil {
+		return common.CandleList{}, err
+	}
+	results, err := tx.executeAndCommit(commands)
+	if err != nil {
+		return common.CandleList{}, err
+	}
+	return options.collect(results), nil
+}
+
+// readCommands locks the code and creates commands reading years of the set in the range.
+func (t *TransactionContext) readCommands(set page.CandleSetWithoutYear, r common.TimeRange, options readOptions) ([]command.CommandContent, error) {
+	years, err := t.lockYears(set, r, false)
+	if err != nil {
+		return []command.CommandContent{}, err
+	}
+	commands := CommandContentFactory{}.ReadFromSet(set, years, r)
+	if options.adjusted {
+		readAdjustments := command.NewReadAdjustmentsCommand(set)
+		commands = append([]command.CommandContent{&readAdjustments}, commands...)
+	}
+	return commands, nil
+}
+
+// Tail returns the latest n candles of the set in ascending order.
+// Year pages are visited from the newest one, and older years are only loaded if more candles are needed.
+func (d *Database) Tail(set page.CandleSetWithoutYear, n int) (common.CandleList, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return common.CandleList{}, err
+	}
+	defer tx.RollbackIfActive()
+
+	years, err := tx.lockCodeAndListYears(set, false)
+	if err != nil {
+		return common.CandleList{}, err
+	}
+	chunks := make([]common.CandleList, 0)
+	found := 0
+	for i := len(years) - 1; i >= 0 && found < n; i-- {
+		cmd := command.NewTailCommand(page.CandleSet{CandleSetWithoutYear: set, Year: years[i]}, n-found)
+		result, err := tx.Execute(&cmd)
 		if err != nil {
-			return []interface{}{}, errors.Wrapf(err, "failed to execute command '%s'", cmd.String())
+			return common.CandleList{}, errors.Wrapf(err, "failed to read year %d", years[i])
 		}
-		result = append(result, cmdResult)
+		chunks = append(chunks, result.(common.CandleList))
+		found += len(result.(common.CandleList))
 	}
 	if err := tx.Commit(); err != nil {
-		return []interface{}{}, errors.Wrap(err, "failed to commit")
+		return common.CandleList{}, errors.Wrap(err, "failed to commit")
+	}
+
+	candles := make(common.CandleList, 0, found)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		candles = append(candles, chunks[i]...)
 	}
-	return result, nil
+	return candles, nil
 }
 
-// High level commands
-func (d *Database) Write(set page.CandleSetWithoutYear, candles common.CandleList) ([]interface{}, error) {
-	commands := CommandContentFactory{}.InsertToSet(set, candles)
-	return d.Execute(commands)
+// ReadResampled reads candles of the set and aggregates them into candles of the given length,
+// which must be a multiple of set.CandleLength. The range is widened to bucket boundaries,
+// so the first and last buckets are not cut short. Options filter candles before they are aggregated.
+func (d *Database) ReadResampled(set page.CandleSetWithoutYear, length uint32, r common.TimeRange, opts ...ReadOption) (common.CandleList, error) {
+	if set.CandleLength == 0 || length == 0 || length%set.CandleLength != 0 {
+		return common.CandleList{}, errors.Errorf("length %d is not a multiple of candle length %d", length, set.CandleLength)
+	}
+	candles, err := d.Read(set, r.AlignRange(length), opts...)
+	if err != nil {
+		return common.CandleList{}, err
+	}
+	return candles.Resample(set.CandleLength, length)
+}
+
+// Get looks up the candle of the set with the exact timestamp.
+func (d *Database) Get(set page.CandleSetWithoutYear, t time.Time) (common.Candle, bool, error) {
+	year, err := pageYear(t)
+	if err != nil {
+		return common.Candle{}, false, err
+	}
+	target := page.CandleSet{CandleSetWithoutYear: set, Year: year}
+	tx, err := d.begin()
+	if err != nil {
+		return common.Candle{}, false, err
+	}
+	defer tx.RollbackIfActive()
+
+	if err := tx.lockSet(target, false); err != nil {
+		return common.Candle{}, false, err
+	}
+	offset := uint32(t.Unix() - common.GetStartOfYearTimestamp(int(target.Year)))
+	block, found, err := tx.accessor.Search(target, offset, page.SearchExact)
+	if err != nil {
+		return common.Candle{}, false, errors.Wrapf(err, "failed to search (key '%s')", target.UniqueKey())
+	}
+	if err := tx.Commit(); err != nil {
+		return common.Candle{}, false, errors.Wrap(err, "failed to commit")
+	}
+	if !found {
+		return common.Candle{}, false, nil
+	}
+	return block.ToCandle(), true, nil
 }
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/storage"
+)
+
+func TestDeleteRangeAcrossYears(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	lastYearEnd := time.Date(2021, 12, 31, 23, 57, 0, 0, time.UTC)
+	lastYear := testCandles(lastYearEnd, 3, 10)
+	thisYear := testCandles(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), 3, 20)
+	if _, err := db.Write(set, append(append(common.CandleList{}, lastYear...), thisYear...)); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := db.DeleteRange(set, common.TimeRange{Start: lastYearEnd.Add(time.Minute), End: lastYearEnd.Add(5 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 4 {
+		t.Fatalf("expected 4 removed candles, got %d", removed)
+	}
+	expected := common.CandleList{lastYear[0], thisYear[2]}
+	expectCandles(t, readAll(t, db, set), expected)
+
+	// Pages written back by eviction keep the deletes
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	expectCandles(t, readAll(t, db, set), expected)
+}
+
+func TestTransactionCommittedAfterLaterOne(t *testing.T) {
+	for _, evictAfterCommit := range []bool{false, true} {
+		t.Run(map[bool]string{false: "replayed", true: "evicted"}[evictAfterCommit], func(t *testing.T) {
+			config := testConfig(t)
+			config.MaxMemoryPages = 0
+			db := openTestDatabase(t, config)
+			set := testSet("A")
+
+			// The earlier transaction gets the smaller id, but commits last
+			early, err := db.Begin(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer early.Rollback()
+			late := testCandles(testStart, 1, 10)
+			if _, err := db.Write(set, late); err != nil {
+				t.Fatal(err)
+			}
+			// The first run resets hit counts, and the second one writes the page back to disk
+			db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+			db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+
+			committedLast := testCandles(testStart.Add(time.Minute), 1, 20)
+			if err := early.Insert(set, committedLast); err != nil {
+				t.Fatal(err)
+			}
+			if err := early.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if evictAfterCommit {
+				db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+				db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+			}
+
+			expected := append(append(common.CandleList{}, late...), committedLast...)
+			expectCandles(t, readAll(t, db, set), expected)
+			db = reopenTestDatabase(t, db, config)
+			expectCandles(t, readAll(t, db, set), expected)
+		})
+	}
+}
+
+func TestDeleteBlocksInsertsCreatingYears(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	removed, err := tx.Delete(set, common.TimeRange{Start: testStart.AddDate(-1, 0, 0), End: testStart.AddDate(2, 0, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Fatalf("expected 3 removed candles, got %d", removed)
+	}
+
+	// An insert creating a year in the range waits for the delete, instead of being left undeleted by it
+	nextYear := testCandles(testStart.AddDate(1, 0, 0), 2, 20)
+	done := make(chan error, 1)
+	go func() {
+		_, err := db.Write(set, nextYear)
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("insert creating a year ran while the delete was open")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.Read(set, common.TimeRange{Start: testStart.AddDate(-1, 0, 0), End: testStart.AddDate(2, 0, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, got, nextYear)
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// DropSet removes the set in every year along with its adjustments, returning the number of removed candles.
+// Dropped pages are evicted from memory on commit, and page files, the adjustment file and empty folders are deleted
+// when the WAL is flushed.
+func (d *Database) DropSet(set page.CandleSetWithoutYear) (int, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.RollbackIfActive()
+
+	years, err := tx.lockCodeAndListYears(set, true)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, year := range years {
+		cmd := command.NewDropCommand(page.CandleSet{CandleSetWithoutYear: set, Year: year})
+		result, err := tx.Execute(&cmd)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to execute command '%s'", cmd.String())
+		}
+		removed += result.(int)
+	}
+	// Nothing is logged for sets without adjustments, as in Rename
+	adjustments, err := tx.accessor.GetAdjustments(set, false)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read adjustments")
+	}
+	if len(*adjustments) > 0 {
+		cmd := command.NewDropAdjustmentsCommand(set)
+		if _, err := tx.Execute(&cmd); err != nil {
+			return 0, errors.Wrapf(err, "failed to execute command '%s'", cmd.String())
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit")
+	}
+	return removed, nil
+}
+
+// TruncateSet removes a single year of the set, returning the number of removed candles.
+// The page is evicted from memory on commit, and the page file is deleted when the WAL is flushed.
+func (d *Database) TruncateSet(set page.CandleSet) (int, error) {
+	cmd := command.NewDropCommand(set)
+	results, err := d.Execute([]command.CommandContent{&cmd})
+	if err != nil {
+		return 0, err
+	}
+	return results[0].(int), nil
+}
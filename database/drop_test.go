@@ -0,0 +1,82 @@
+package database
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/storage"
+	"github.com/jungnoh/mora/page"
+)
+
+func TestDropSetEvictsPages(t *testing.T) {
+	config := testConfig(t)
+	db := openTestDatabase(t, config)
+	dropped, kept := testSet("A"), testSet("B")
+	if _, err := db.Write(dropped, append(testCandles(testStart.AddDate(-1, 0, 0), 3, 10), testCandles(testStart, 3, 10)...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Write(kept, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := db.DropSet(dropped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 6 {
+		t.Fatalf("expected 6 removed candles, got %d", removed)
+	}
+	if result := db.Storage.EvictMemory(storage.UserTriggerEvictionReason); result.PagesCountBeforeEvict != 1 {
+		t.Errorf("expected only the kept page to be resident, got %v", result)
+	}
+	if got := readAll(t, db, dropped); len(got) != 0 {
+		t.Errorf("expected the dropped set to be empty, got %v", got)
+	}
+
+	db = reopenTestDatabase(t, db, config)
+	if got := readAll(t, db, dropped); len(got) != 0 {
+		t.Errorf("expected the dropped set to be empty after reopening, got %v", got)
+	}
+	expectCandles(t, readAll(t, db, kept), testCandles(testStart, 3, 10))
+}
+
+func TestDropSetRemovesAdjustments(t *testing.T) {
+	config := testConfig(t)
+	db := openTestDatabase(t, config)
+	dropped, kept := testSet("A"), testSet("B")
+	for _, set := range []page.CandleSetWithoutYear{dropped, kept} {
+		if _, err := db.Write(set, testCandles(testStart, 3, 10)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AddAdjustment(set, common.Adjustment{EffectiveTime: testStart.Unix(), PriceFactor: 2, VolumeFactor: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Logs are flushed on reopening, so the adjustment files are on disk before the drop
+	db = reopenTestDatabase(t, db, config)
+	folder := path.Join(config.Directory, "TEST", "60", "A")
+	if _, err := os.Stat(path.Join(folder, "adjustments.adj")); err != nil {
+		t.Fatalf("expected the adjustment file to be flushed, got %v", err)
+	}
+
+	if _, err := db.DropSet(dropped); err != nil {
+		t.Fatal(err)
+	}
+	if adjustments, err := db.Adjustments(dropped); err != nil || len(adjustments) != 0 {
+		t.Errorf("expected no adjustments for the dropped set, got %v (%v)", adjustments, err)
+	}
+
+	db = reopenTestDatabase(t, db, config)
+	if adjustments, err := db.Adjustments(dropped); err != nil || len(adjustments) != 0 {
+		t.Errorf("expected no adjustments for the dropped set after reopening, got %v (%v)", adjustments, err)
+	}
+	if adjustments, err := db.Adjustments(kept); err != nil || len(adjustments) != 1 {
+		t.Errorf("expected the kept set to keep its adjustment, got %v (%v)", adjustments, err)
+	}
+	// Without the adjustment file, the folder of the dropped code is empty and deleted
+	if _, err := os.Stat(folder); !os.IsNotExist(err) {
+		t.Errorf("expected the folder of the dropped set to be deleted, got %v", err)
+	}
+}
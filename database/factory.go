@@ -11,7 +11,8 @@ import (
 type CommandContentFactory struct {
 }
 
-func (c CommandContentFactory) InsertToSet(set page.CandleSetWithoutYear, candles common.CandleList) []command.CommandContent {
+// InsertToSet creates insert commands for each year of the candles.
+func (c CommandContentFactory) InsertToSet(set page.CandleSetWithoutYear, candles common.CandleList, mode page.ConflictMode) []command.CommandContent {
 	years := candles.SplitByYear()
 	result := make([]command.CommandContent, 0, len(years))
 
@@ -28,7 +29,33 @@ func (c CommandContentFactory) InsertToSet(set page.CandleSetWithoutYear, candle
 		newCmd := command.NewInsertCommand(page.CandleSet{
 			CandleSetWithoutYear: set,
 			Year:                 uint16(year),
-		}, yearCandles.ToTimestampCandleList())
+		}, yearCandles.ToTimestampCandleList(), mode)
+		result = append(result, &newCmd)
+	}
+	return result
+}
+
+// ReadFromSet creates read commands for each of the years of the set.
+func (c CommandContentFactory) ReadFromSet(set page.CandleSetWithoutYear, years []uint16, r common.TimeRange) []command.CommandContent {
+	result := make([]command.CommandContent, 0, len(years))
+	for _, year := range years {
+		newCmd := command.NewReadCommand(page.CandleSet{
+			CandleSetWithoutYear: set,
+			Year:                 year,
+		}, r)
+		result = append(result, &newCmd)
+	}
+	return result
+}
+
+// DeleteFromSet creates delete commands for each of the years of the set.
+func (c CommandContentFactory) DeleteFromSet(set page.CandleSetWithoutYear, years []uint16, r common.TimeRange) []command.CommandContent {
+	result := make([]command.CommandContent, 0, len(years))
+	for _, year := range years {
+		newCmd := command.NewDeleteRangeCommand(page.CandleSet{
+			CandleSetWithoutYear: set,
+			Year:                 year,
+		}, r)
 		result = append(result, &newCmd)
 	}
 	return result
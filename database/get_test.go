@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/storage"
+)
+
+func TestGet(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	// Candles on several days, so lookups are narrowed by the day index
+	candles := append(testCandles(testStart, 3, 10), testCandles(testStart.AddDate(0, 0, 2), 3, 20)...)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+
+	expectGet := func(t *testing.T) {
+		t.Helper()
+		for _, candle := range candles {
+			got, found, err := db.Get(set, candle.Timestamp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !found {
+				t.Fatalf("expected candle at %v", candle.Timestamp)
+			}
+			expectCandles(t, common.CandleList{got}, common.CandleList{candle})
+		}
+		for _, missing := range []time.Time{testStart.Add(30 * time.Second), testStart.AddDate(0, 0, 1), testStart.AddDate(-1, 0, 0)} {
+			if _, found, err := db.Get(set, missing); err != nil || found {
+				t.Errorf("expected no candle at %v, got found=%v err=%v", missing, found, err)
+			}
+		}
+	}
+	t.Run("memory", expectGet)
+
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	t.Run("disk", expectGet)
+	// Lookups on disk do not load the page
+	if result := db.Storage.EvictMemory(storage.UserTriggerEvictionReason); result.PagesCountBeforeEvict != 0 {
+		t.Errorf("expected no pages to be loaded, got %d", result.PagesCountBeforeEvict)
+	}
+}
+
+func TestGetRejectsTimeOutOfPageYears(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	candles := testCandles(time.Date(2000, 3, 1, 0, 0, 0, 0, time.UTC), 1, 10)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+
+	// Year 67536 would wrap around to 2000 if truncated to a page year
+	if _, _, err := db.Get(set, time.Date(67536, 3, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatal("expected a lookup out of page years to fail")
+	}
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/page"
+)
+
+var testStart = time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func testConfig(t *testing.T) util.Config {
+	t.Helper()
+	return util.Config{
+		Directory:        t.TempDir(),
+		MaxMemoryPages:   100,
+		EvictionInterval: 3600,
+	}
+}
+
+func openTestDatabase(t *testing.T, config util.Config) *Database {
+	t.Helper()
+	db, err := NewDatabase(config)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	return db
+}
+
+func testSet(code string) page.CandleSetWithoutYear {
+	return page.CandleSetWithoutYear{MarketCode: "TEST", Code: code, CandleLength: 60}
+}
+
+// testCandles returns n one minute candles from start, with prices increasing from value.
+func testCandles(start time.Time, n int, value float64) common.CandleList {
+	result := make(common.CandleList, 0, n)
+	for i := 0; i < n; i++ {
+		v := value + float64(i)
+		result = append(result, common.Candle{
+			Timestamp:      start.Add(time.Duration(i) * time.Minute),
+			TimelessCandle: common.TimelessCandle{Open: v, High: v + 1, Low: v - 1, Close: v, Volume: 1},
+		})
+	}
+	return result
+}
+
+func readAll(t *testing.T, db *Database, set page.CandleSetWithoutYear) common.CandleList {
+	t.Helper()
+	result, err := db.Read(set, common.TimeRange{Start: testStart.AddDate(-1, 0, 0), End: testStart.AddDate(1, 0, 0)})
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	return result
+}
+
+func expectCandles(t *testing.T, got, expected common.CandleList) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d candles, got %d: %v", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if !got[i].Timestamp.Equal(expected[i].Timestamp) || got[i].TimelessCandle != expected[i].TimelessCandle {
+			t.Fatalf("candle %d: expected %v, got %v", i, expected[i], got[i])
+		}
+	}
+}
+
+// reopenTestDatabase stops background tasks of the database and opens another one on the same directory,
+// which replays logs left by the first one like after a crash.
+func reopenTestDatabase(t *testing.T, db *Database, config util.Config) *Database {
+	t.Helper()
+	db.Storage.Stop()
+	return openTestDatabase(t, config)
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/database/storage"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// CandleIterator streams candles of a set in [Start, End) one year page at a time.
+// A shared lock is held only on the page being iterated, and is released when moving on to the next year.
+// Blocks are read in batches, and memory or disk locks are held only while reading one, so eviction and WAL flushes
+// are not blocked by an open iterator. Writers of the page being iterated are still blocked until the iterator moves on.
+type CandleIterator struct {
+	tx    *TransactionContext
+	set   page.CandleSetWithoutYear
+	r     common.TimeRange
+	years []uint16
+	opts  readOptions
+
+	adjustments common.AdjustmentList
+
+	yearIndex int
+	cursor    *storage.PageCursor
+	current   common.Candle
+	err       error
+	closed    bool
+}
+
+// Iterate opens an iterator over the set. The iterator should be closed by the caller.
+// Years having candles are listed when the iterator is opened, so years created afterwards are not iterated.
+func (d *Database) Iterate(set page.CandleSetWithoutYear, r common.TimeRange, opts ...ReadOption) (*CandleIterator, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return nil, err
+	}
+	years, err := tx.lockYears(set, r, false)
+	if err != nil {
+		tx.RollbackIfActive()
+		return nil, err
+	}
+	it := &CandleIterator{
+		tx:    tx,
+		set:   set,
+		r:     r,
+		years: years,
+		opts:  newReadOptions(opts),
+	}
+	if it.opts.adjusted {
+		if err := it.loadAdjustments(); err != nil {
+			tx.RollbackIfActive()
+			return nil, err
+		}
+	}
+	// The code lock is released, so writers are only blocked by the page being iterated
+	if err := tx.dbLock.Release(tx.txId, concurrency.NewCodeResourceName(set.MarketCode, set.Code)); err != nil {
+		tx.RollbackIfActive()
+		return nil, err
+	}
+	return it, nil
+}
+
+// Next advances the iterator, returning false if there are no more candles or an error occurred.
+func (it *CandleIterator) Next() bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+	for it.yearIndex < len(it.years) {
+		if it.cursor == nil {
+			if err := it.openYear(); err != nil {
+				it.err = err
+				return false
+			}
+		}
+		block, ok, err := it.cursor.Next()
+		if err != nil {
+			it.err = errors.Wrapf(err, "failed to read year %d", it.years[it.yearIndex])
+			return false
+		}
+		if ok && int64(block.Timestamp) < it.r.End.Unix() {
+			candle := block.ToCandle()
+			if it.opts.adjusted {
+				candle = it.adjustments.Apply(common.CandleList{candle})[0]
+			}
+			if !it.opts.matches(candle) {
+				continue
+			}
+			it.current = candle
+			return true
+		}
+		if err := it.closeYear(); err != nil {
+			it.err = err
+			return false
+		}
+		it.yearIndex++
+	}
+	return false
+}
+
+// loadAdjustments reads the adjustments of the set.
+func (it *CandleIterator) loadAdjustments() error {
+	cmd := command.NewReadAdjustmentsCommand(it.set)
+	result, err := it.tx.Execute(&cmd)
+	if err != nil {
+		return errors.Wrap(err, "failed to read adjustments")
+	}
+	it.adjustments = result.(common.AdjustmentList)
+	return nil
+}
+
+func (it *CandleIterator) Candle() common.Candle {
+	return it.current
+}
+
+func (it *CandleIterator) Err() error {
+	return it.err
+}
+
+// Close releases all locks held by the iterator.
+func (it *CandleIterator) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	if it.cursor != nil {
+		it.cursor.Close()
+		it.cursor = nil
+	}
+	return it.tx.Commit()
+}
+
+func (it *CandleIterator) currentSet() page.CandleSet {
+	return page.CandleSet{
+		CandleSetWithoutYear: it.set,
+		Year:                 it.years[it.yearIndex],
+	}
+}
+
+func (it *CandleIterator) openYear() error {
+	set := it.currentSet()
+	if err := it.tx.lockSet(set, false); err != nil {
+		return err
+	}
+	fromOffset := uint32(0)
+	if start := it.r.Start.Unix(); start > common.GetStartOfYearTimestamp(int(set.Year)) {
+		fromOffset = uint32(start - common.GetStartOfYearTimestamp(int(set.Year)))
+	}
+	cursor, err := it.tx.accessor.OpenCursor(set, fromOffset)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open year %d", set.Year)
+	}
+	it.cursor = cursor
+	return nil
+}
+
+func (it *CandleIterator) closeYear() error {
+	if err := it.cursor.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close year %d", it.years[it.yearIndex])
+	}
+	it.cursor = nil
+	if err := it.tx.unlockSet(it.currentSet()); err != nil {
+		return errors.Wrapf(err, "failed to unlock year %d", it.years[it.yearIndex])
+	}
+	return nil
+}
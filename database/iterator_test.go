@@ -0,0 +1,55 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/storage"
+)
+
+func TestIteratorDoesNotBlockEviction(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	// Spans several batches of the cursor
+	candles := testCandles(testStart, 3000, 10)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+
+	it, err := db.Iterate(set, common.TimeRange{Start: testStart, End: testStart.AddDate(0, 1, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	read := make(common.CandleList, 0, len(candles))
+	for len(read) < 10 && it.Next() {
+		read = append(read, it.Candle())
+	}
+
+	evicted := make(chan storage.MemoryEvictionResult, 1)
+	go func() {
+		// The first run resets hit counts of the page, which is then evicted by the second one
+		db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+		evicted <- db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	}()
+	select {
+	case result := <-evicted:
+		if result.EvictedCount != 1 {
+			t.Fatalf("expected the page to be evicted, got %v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("eviction is blocked by the open iterator")
+	}
+
+	// The rest is read from disk
+	for it.Next() {
+		read = append(read, it.Candle())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, read, candles)
+}
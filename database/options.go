@@ -0,0 +1,72 @@
+package database
+
+import "github.com/jungnoh/mora/common"
+
+type readOptions struct {
+	includeFlags common.CandleFlag
+	excludeFlags common.CandleFlag
+	adjusted     bool
+}
+
+// ReadOption changes which candles are returned by reads.
+type ReadOption func(*readOptions)
+
+// WithFlags only returns candles having all the given flags.
+func WithFlags(mask common.CandleFlag) ReadOption {
+	return func(o *readOptions) {
+		o.includeFlags |= mask
+	}
+}
+
+// WithoutFlags only returns candles having none of the given flags.
+func WithoutFlags(mask common.CandleFlag) ReadOption {
+	return func(o *readOptions) {
+		o.excludeFlags |= mask
+	}
+}
+
+// WithAdjustments returns prices and volumes adjusted by the adjustments of the set.
+// Adjusted candles are marked with common.FlagAdjusted, and flag filters apply after adjusting.
+func WithAdjustments() ReadOption {
+	return func(o *readOptions) {
+		o.adjusted = true
+	}
+}
+
+func newReadOptions(opts []ReadOption) readOptions {
+	result := readOptions{}
+	for _, opt := range opts {
+		opt(&result)
+	}
+	return result
+}
+
+func (o readOptions) matches(candle common.Candle) bool {
+	return candle.HasFlags(o.includeFlags) && !candle.HasAnyFlag(o.excludeFlags)
+}
+
+func (o readOptions) apply(candles common.CandleList) common.CandleList {
+	if o.includeFlags == 0 && o.excludeFlags == 0 {
+		return candles
+	}
+	return candles.FilterFlags(o.includeFlags, o.excludeFlags)
+}
+
+// collect joins candles of read results, applying the options.
+// Results may include the adjustments of the set, read when adjusted candles are requested.
+func (o readOptions) collect(results []interface{}) common.CandleList {
+	candles := make(common.CandleList, 0)
+	var adjustments common.AdjustmentList
+	for _, result := range results {
+		switch value := result.(type) {
+		case common.CandleList:
+			candles = append(candles, value...)
+		case common.AdjustmentList:
+			adjustments = value
+		}
+	}
+	if o.adjusted {
+		candles = adjustments.Apply(candles)
+	}
+	return o.apply(candles)
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jungnoh/mora/common"
+)
+
+func TestReadFilteredByFlags(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	candles := testCandles(testStart, 4, 10)
+	candles[1].SetFlags(common.FlagSynthetic)
+	candles[2].SetFlags(common.FlagSynthetic | common.FlagCorrected)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+	r := common.TimeRange{Start: testStart, End: testStart.AddDate(0, 0, 1)}
+
+	got, err := db.Read(set, r, WithFlags(common.FlagSynthetic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, got, candles[1:3])
+
+	got, err = db.Read(set, r, WithoutFlags(common.FlagSynthetic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, got, common.CandleList{candles[0], candles[3]})
+
+	got, err = db.Read(set, r, WithFlags(common.FlagSynthetic), WithoutFlags(common.FlagCorrected))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, got, candles[1:2])
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/storage"
+)
+
+func TestReadSpansYears(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	candles := testCandles(time.Date(2021, 12, 31, 23, 58, 0, 0, time.UTC), 4, 10)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.Read(set, common.TimeRange{Start: candles[1].Timestamp, End: candles[3].Timestamp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, got, candles[1:3])
+}
+
+func TestReadLoadsOnlyYearsWithCandles(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	candles := testCandles(testStart, 3, 10)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+
+	got, err := db.Read(set, common.TimeRange{Start: time.Time{}, End: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, got, candles)
+	if result := db.Storage.EvictMemory(storage.UserTriggerEvictionReason); result.PagesCountBeforeEvict != 1 {
+		t.Errorf("expected only the page with candles to be loaded, got %d pages", result.PagesCountBeforeEvict)
+	}
+}
+
+func TestReadRejectsYearsOutOfRange(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	ranges := []common.TimeRange{
+		{Start: time.Date(0, 6, 1, 0, 0, 0, 0, time.UTC), End: testStart},
+		{Start: testStart, End: time.Date(70000, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, r := range ranges {
+		if _, err := db.Read(testSet("A"), r); err == nil {
+			t.Errorf("expected reading %v to fail", r)
+		}
+	}
+}
+
+func TestReadsAreNotLogged(t *testing.T) {
+	config := testConfig(t)
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+	logs, err := filepath.Glob(filepath.Join(config.Directory, "wal", "wal.*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := make(map[string]int64)
+	for _, file := range logs {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[file] = info.Size()
+	}
+
+	// Shared locks let a read run while another transaction holds a read of the same page
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Read(set, common.TimeRange{Start: testStart, End: testStart.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := db.Read(set, common.TimeRange{Start: testStart, End: testStart.Add(time.Hour)})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read is blocked by another read")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, size := range sizes {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != size {
+			t.Errorf("expected reads to leave '%s' unchanged, grew from %d to %d bytes", file, size, info.Size())
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/storage"
+	"github.com/jungnoh/mora/database/storage/disk"
+	"github.com/jungnoh/mora/page"
+)
+
+func TestRecoveryOnStartup(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	committed, uncommitted := testSet("A"), testSet("B")
+	candles := testCandles(testStart, 3, 10)
+	if _, err := db.Write(committed, candles); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(uncommitted, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	db = reopenTestDatabase(t, db, config)
+	// Records are logged on commit, so the open transaction left nothing to discard
+	report := db.Storage.RecoveryReport()
+	if report.CommittedTxs != 1 || report.DiscardedTxs != 0 || len(report.TornTails) != 0 {
+		t.Errorf("unexpected recovery report %+v", report)
+	}
+	expectCandles(t, readAll(t, db, committed), candles)
+	if got := readAll(t, db, uncommitted); len(got) != 0 {
+		t.Errorf("expected the uncommitted insert to be discarded, got %v", got)
+	}
+
+	// Commits after recovery are numbered after recovered ones, so they are neither skipped on eviction nor on replay
+	more := testCandles(testStart.Add(time.Hour), 2, 20)
+	if _, err := db.Write(committed, more); err != nil {
+		t.Fatal(err)
+	}
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db = reopenTestDatabase(t, db, config)
+	expectCandles(t, readAll(t, db, committed), append(candles, more...))
+}
+
+func TestRecoveryTruncatesTornTail(t *testing.T) {
+	config := testConfig(t)
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	candles := testCandles(testStart, 3, 10)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+	db.Storage.Stop()
+
+	// The process crashed while appending a record
+	files, err := filepath.Glob(path.Join(config.Directory, "wal", "wal.*.log"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("expected logs, got %v (%v)", files, err)
+	}
+	var written string
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.Size() > 8 {
+			written = file
+		}
+	}
+	f, err := os.OpenFile(written, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0x4d, 0x4c, 0x4f}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db = openTestDatabase(t, config)
+	report := db.Storage.RecoveryReport()
+	if len(report.TornTails) != 1 || report.TornTails[0].File != written || report.TornTails[0].Truncated != 3 {
+		t.Errorf("expected the torn tail to be truncated, got %+v", report.TornTails)
+	}
+	expectCandles(t, readAll(t, db, set), candles)
+}
+
+func TestRecoveryReplaysDeletesAcrossYears(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	lastYearEnd := time.Date(2021, 12, 31, 23, 57, 0, 0, time.UTC)
+	lastYear := testCandles(lastYearEnd, 3, 10)
+	thisYear := testCandles(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), 3, 20)
+	if _, err := db.Write(set, append(append(common.CandleList{}, lastYear...), thisYear...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DeleteRange(set, common.TimeRange{Start: lastYearEnd.Add(time.Minute), End: lastYearEnd.Add(5 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pages are written back by eviction before the crash, and the log replayed on them still has the deletes
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db = reopenTestDatabase(t, db, config)
+	expectCandles(t, readAll(t, db, set), common.CandleList{lastYear[0], thisYear[2]})
+}
+
+func TestRecoveryReplaysUpdateLastOnRollups(t *testing.T) {
+	config := testConfig(t)
+	db := openTestDatabase(t, config)
+	if err := db.AddRollup("TEST", 60, 300); err != nil {
+		t.Fatal(err)
+	}
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range []time.Time{testStart.Add(2 * time.Minute), testStart.Add(5 * time.Minute)} {
+		if err := db.UpdateLast(set, at, tick(20, 3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rollupSet := set
+	rollupSet.CandleLength = 300
+	expected := readAll(t, db, rollupSet)
+
+	db = reopenTestDatabase(t, db, config)
+	expectCandles(t, readAll(t, db, rollupSet), expected)
+}
+
+func TestRecoveryCatalogSkipsEmptyPageFiles(t *testing.T) {
+	config := testConfig(t)
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+	db.Storage.Stop()
+
+	// The written page is only in the log, next to page files without candles
+	d := disk.NewDisk(&config)
+	if err := d.Write(page.NewPage(page.CandleSet{CandleSetWithoutYear: set, Year: 2021})); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDatabase(t, config)
+	if years := db.ListYears(set); len(years) != 1 || years[0] != 2022 {
+		t.Errorf("expected only 2022, got %v", years)
+	}
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// Rename moves all years of the set to another market and code in a single transaction, returning the number of moved candles.
+// The destination must not hold candles or adjustments of the same candle length.
+// Adjustments of the set and sets derived by rollups are moved along with the set.
+func (d *Database) Rename(set page.CandleSetWithoutYear, toMarketCode, toCode string) (int, error) {
+	to := page.CandleSetWithoutYear{MarketCode: toMarketCode, Code: toCode, CandleLength: set.CandleLength}
+	if to == set {
+		return 0, errors.New("source and destination are the same")
+	}
+	tx, err := d.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.RollbackIfActive()
+
+	if err := tx.ensureLocks(command.NeededLockSlice{
+		{Lock: concurrency.NewCodeResourceName(set.MarketCode, set.Code), Exclusive: true},
+		{Lock: concurrency.NewCodeResourceName(toMarketCode, toCode), Exclusive: true},
+	}); err != nil {
+		return 0, err
+	}
+	for _, year := range tx.listYears(to) {
+		header, err := tx.accessor.Header(page.CandleSet{CandleSetWithoutYear: to, Year: year})
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to check destination year %d", year)
+		}
+		if header.Count > 0 {
+			return 0, errors.Errorf("destination already has candles in year %d", year)
+		}
+	}
+
+	adjustments, err := tx.accessor.GetAdjustments(to, false)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to check destination adjustments")
+	}
+	if len(*adjustments) > 0 {
+		return 0, errors.New("destination already has adjustments")
+	}
+
+	moved := 0
+	for _, year := range tx.listYears(set) {
+		cmd := command.NewRenameCommand(page.CandleSet{CandleSetWithoutYear: set, Year: year}, toMarketCode, toCode)
+		result, err := tx.Execute(&cmd)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to execute command '%s'", cmd.String())
+		}
+		moved += result.(int)
+	}
+	// Nothing is logged for sets without adjustments, so no adjustment file is created for the destination
+	adjustments, err = tx.accessor.GetAdjustments(set, false)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read adjustments")
+	}
+	if len(*adjustments) > 0 {
+		cmd := command.NewRenameAdjustmentsCommand(set, toMarketCode, toCode)
+		if _, err := tx.Execute(&cmd); err != nil {
+			return 0, errors.Wrapf(err, "failed to execute command '%s'", cmd.String())
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit")
+	}
+	return moved, nil
+}
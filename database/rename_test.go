@@ -0,0 +1,73 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/storage"
+)
+
+func TestRenameMovesAdjustments(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	from, to := testSet("A"), testSet("B")
+	candles := testCandles(testStart, 5, 10)
+	if _, err := db.Write(from, candles); err != nil {
+		t.Fatal(err)
+	}
+	adjustment := common.Adjustment{EffectiveTime: testStart.Unix(), PriceFactor: 2, VolumeFactor: 1}
+	if err := db.AddAdjustment(from, adjustment); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := db.Rename(from, "TEST", "B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 5 {
+		t.Fatalf("expected 5 moved candles, got %d", moved)
+	}
+	// The destination is written back, while the emptied source is kept in memory until the log is flushed
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+
+	check := func(db *Database) {
+		t.Helper()
+		expectCandles(t, readAll(t, db, to), candles)
+		if got := readAll(t, db, from); len(got) != 0 {
+			t.Errorf("expected the source to be empty, got %v", got)
+		}
+		if years := db.ListYears(from); len(years) != 0 {
+			t.Errorf("expected no years for the source, got %v", years)
+		}
+		adjustments, err := db.Adjustments(to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(adjustments) != 1 || adjustments[0] != adjustment {
+			t.Errorf("expected adjustments to be moved, got %v", adjustments)
+		}
+		if adjustments, err := db.Adjustments(from); err != nil || len(adjustments) != 0 {
+			t.Errorf("expected no adjustments for the source, got %v (%v)", adjustments, err)
+		}
+	}
+	check(db)
+	check(reopenTestDatabase(t, db, config))
+}
+
+func TestRenameRejectsDestinationWithAdjustments(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	from, to := testSet("A"), testSet("B")
+	if _, err := db.Write(from, testCandles(testStart, 5, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddAdjustment(to, common.Adjustment{EffectiveTime: testStart.Unix(), PriceFactor: 2, VolumeFactor: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Rename(from, "TEST", "B"); err == nil {
+		t.Fatal("expected rename onto a code with adjustments to fail")
+	}
+	if got := readAll(t, db, from); len(got) != 5 {
+		t.Errorf("expected the source to be kept, got %v", got)
+	}
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+)
+
+func TestReadResampledAcrossYears(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	newYear := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles := testCandles(newYear.Add(-10*time.Minute), 20, 10)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+
+	// The range is widened to the buckets containing its ends
+	got, err := db.ReadResampled(set, 600, common.TimeRange{Start: newYear.Add(-5 * time.Minute), End: newYear.Add(5 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := candles.Resample(60, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, got, expected)
+	if expected[0].Volume != 10 || expected[0].Close != candles[9].Close {
+		t.Fatalf("unexpected first bucket %v", expected[0])
+	}
+}
+
+func TestReadResampledRejectsLengthsNotMultiples(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	if _, err := db.ReadResampled(testSet("A"), 90, common.TimeRange{Start: testStart, End: testStart.Add(time.Hour)}); err == nil {
+		t.Error("expected 90 to be rejected as a resampled length of 60")
+	}
+}
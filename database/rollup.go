@@ -0,0 +1,297 @@
+package database
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+type rollupKey struct {
+	MarketCode   string
+	CandleLength uint32
+}
+
+// rollupRegistry holds rules of candle sets to be derived from sets of a base candle length.
+type rollupRegistry struct {
+	lock  sync.RWMutex
+	rules map[rollupKey][]uint32
+}
+
+func newRollupRegistry() *rollupRegistry {
+	return &rollupRegistry{
+		rules: make(map[rollupKey][]uint32),
+	}
+}
+
+func (r *rollupRegistry) Add(marketCode string, baseLength uint32, targetLengths []uint32) error {
+	for _, target := range targetLengths {
+		if baseLength == 0 || target <= baseLength || target%baseLength != 0 {
+			return errors.Errorf("rollup length %d is not a multiple of base length %d", target, baseLength)
+		}
+		// Buckets must not cross year boundaries, as each year page is updated separately
+		if 86400%target != 0 {
+			return errors.Errorf("rollup length %d does not divide a day; longer buckets such as weeks and months may cross years, so read them with ReadResampled instead", target)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	key := rollupKey{MarketCode: marketCode, CandleLength: baseLength}
+	for _, target := range targetLengths {
+		exists := false
+		for _, v := range r.rules[key] {
+			exists = exists || v == target
+		}
+		if !exists {
+			r.rules[key] = append(r.rules[key], target)
+		}
+	}
+	return nil
+}
+
+func (r *rollupRegistry) Targets(marketCode string, baseLength uint32) []uint32 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	targets := r.rules[rollupKey{MarketCode: marketCode, CandleLength: baseLength}]
+	result := make([]uint32, len(targets))
+	copy(result, targets)
+	return result
+}
+
+// AddRollup registers sets of the given target lengths to be derived from sets of the market with baseLength.
+// Derived sets are maintained by every change of a base set inside the same transaction:
+// inserts, UpdateLast and DeleteRange recompute the touched buckets, and drops and renames are applied to derived sets as well.
+// Target lengths must be multiples of baseLength that divide a day. Longer buckets are rejected, as a weekly bucket
+// may span two year pages and months have no fixed length; ReadResampled serves them on read instead.
+func (d *Database) AddRollup(marketCode string, baseLength uint32, targetLengths ...uint32) error {
+	return d.rollups.Add(marketCode, baseLength, targetLengths)
+}
+
+// buildRollupsOf creates commands keeping derived sets consistent with a command executed on a base set.
+func (t *TransactionContext) buildRollupsOf(cmd command.CommandContent, result interface{}) ([]command.CommandContent, error) {
+	switch typed := cmd.(type) {
+	case *command.InsertCommand:
+		return t.buildRollups(typed)
+	case *command.UpdateLastCommand:
+		return t.buildUpdateLastRollups(typed)
+	case *command.DeleteRangeCommand:
+		if removed, ok := result.(int); ok && removed == 0 {
+			return []command.CommandContent{}, nil
+		}
+		return t.buildDeleteRangeRollups(typed)
+	case *command.DropCommand:
+		return t.buildDropRollups(typed), nil
+	case *command.RenameCommand:
+		return t.buildRenameRollups(typed), nil
+	case *command.RenameAdjustmentsCommand:
+		return t.buildRenameAdjustmentsRollups(typed)
+	case *command.DropAdjustmentsCommand:
+		return t.buildDropAdjustmentsRollups(typed)
+	}
+	return []command.CommandContent{}, nil
+}
+
+func (t *TransactionContext) rollupTargets(set page.CandleSetWithoutYear) []uint32 {
+	if t.rollups == nil {
+		return []uint32{}
+	}
+	return t.rollups.Targets(set.MarketCode, set.CandleLength)
+}
+
+func derivedSet(base page.CandleSet, target uint32) page.CandleSet {
+	derived := base
+	derived.CandleLength = target
+	return derived
+}
+
+// buildRollups creates insert commands updating derived sets for buckets touched by the insert.
+// Buckets are recomputed from the whole base page, so candles merged late are reflected.
+func (t *TransactionContext) buildRollups(cmd *command.InsertCommand) ([]command.CommandContent, error) {
+	if t.rollups == nil {
+		return []command.CommandContent{}, nil
+	}
+	targets := t.rollups.Targets(cmd.MarketCode, cmd.CandleLength)
+	if len(targets) == 0 {
+		return []command.CommandContent{}, nil
+	}
+
+	baseSet := cmd.TargetSet()
+	content, err := t.accessor.GetPage(baseSet, false)
+	if err != nil {
+		return []command.CommandContent{}, errors.Wrapf(err, "failed to read base page (key '%s')", baseSet.UniqueKey())
+	}
+	result := make([]command.CommandContent, 0, len(targets))
+	for _, target := range targets {
+		buckets := make(map[int64]struct{})
+		for _, candle := range cmd.Candles {
+			buckets[common.BucketStart(candle.Timestamp, target)] = struct{}{}
+		}
+		bucketStarts := make([]int64, 0, len(buckets))
+		for bucket := range buckets {
+			bucketStarts = append(bucketStarts, bucket)
+		}
+		sort.Slice(bucketStarts, func(i, j int) bool { return bucketStarts[i] < bucketStarts[j] })
+
+		derived := make(common.CandleList, 0, len(bucketStarts))
+		for _, bucket := range bucketStarts {
+			candles, err := content.Slice(bucket, bucket+int64(target)).ToCandleList().Resample(cmd.CandleLength, target)
+			if err != nil {
+				return []command.CommandContent{}, err
+			}
+			derived = append(derived, candles...)
+		}
+		if len(derived) == 0 {
+			continue
+		}
+		newCmd := command.NewInsertCommand(derivedSet(baseSet, target), derived.ToTimestampCandleList(), page.ConflictOverwrite)
+		result = append(result, &newCmd)
+	}
+	return result, nil
+}
+
+// buildUpdateLastRollups creates insert commands recomputing the bucket of the updated candle in derived sets.
+// Like buildRollups, the bucket is resampled from the base page and overwritten, as updating the derived candle
+// in place would keep highs and lows the base candles no longer reach.
+func (t *TransactionContext) buildUpdateLastRollups(cmd *command.UpdateLastCommand) ([]command.CommandContent, error) {
+	if t.rollups == nil {
+		return []command.CommandContent{}, nil
+	}
+	targets := t.rollups.Targets(cmd.MarketCode, cmd.CandleLength)
+	if len(targets) == 0 {
+		return []command.CommandContent{}, nil
+	}
+
+	baseSet := cmd.TargetSet()
+	content, err := t.accessor.GetPage(baseSet, false)
+	if err != nil {
+		return []command.CommandContent{}, errors.Wrapf(err, "failed to read base page (key '%s')", baseSet.UniqueKey())
+	}
+	ts := common.GetStartOfYearTimestamp(int(cmd.Year)) + int64(cmd.TimestampOffset)
+	result := make([]command.CommandContent, 0, len(targets))
+	for _, target := range targets {
+		bucket := common.BucketStart(ts, target)
+		derived, err := content.Slice(bucket, bucket+int64(target)).ToCandleList().Resample(cmd.CandleLength, target)
+		if err != nil {
+			return []command.CommandContent{}, err
+		}
+		if len(derived) == 0 {
+			continue
+		}
+		newCmd := command.NewInsertCommand(derivedSet(baseSet, target), derived.ToTimestampCandleList(), page.ConflictOverwrite)
+		result = append(result, &newCmd)
+	}
+	return result, nil
+}
+
+// buildDeleteRangeRollups creates commands recomputing derived buckets overlapping the deleted range.
+// The buckets are cleared and rebuilt from the base candles left, so buckets emptied by the delete are removed.
+func (t *TransactionContext) buildDeleteRangeRollups(cmd *command.DeleteRangeCommand) ([]command.CommandContent, error) {
+	baseSet := cmd.TargetSet()
+	targets := t.rollupTargets(baseSet.CandleSetWithoutYear)
+	if len(targets) == 0 {
+		return []command.CommandContent{}, nil
+	}
+
+	start, end := cmd.Start, cmd.End
+	if yearStart := common.GetStartOfYearTimestamp(int(cmd.Year)); start < yearStart {
+		start = yearStart
+	}
+	if yearEnd := common.GetStartOfYearTimestamp(int(cmd.Year) + 1); end > yearEnd {
+		end = yearEnd
+	}
+	if start >= end {
+		return []command.CommandContent{}, nil
+	}
+	content, err := t.accessor.GetPage(baseSet, false)
+	if err != nil {
+		return []command.CommandContent{}, errors.Wrapf(err, "failed to read base page (key '%s')", baseSet.UniqueKey())
+	}
+	result := make([]command.CommandContent, 0, 2*len(targets))
+	for _, target := range targets {
+		from := common.BucketStart(start, target)
+		to := common.BucketStart(end-1, target) + int64(target)
+		targetSet := derivedSet(baseSet, target)
+		deleteCmd := command.NewDeleteRangeCommand(targetSet, common.TimeRange{Start: time.Unix(from, 0), End: time.Unix(to, 0)})
+		result = append(result, &deleteCmd)
+
+		derived, err := content.Slice(from, to).ToCandleList().Resample(cmd.CandleLength, target)
+		if err != nil {
+			return []command.CommandContent{}, err
+		}
+		if len(derived) == 0 {
+			continue
+		}
+		insertCmd := command.NewInsertCommand(targetSet, derived.ToTimestampCandleList(), page.ConflictOverwrite)
+		result = append(result, &insertCmd)
+	}
+	return result, nil
+}
+
+// buildDropRollups creates commands dropping the same year of derived sets.
+func (t *TransactionContext) buildDropRollups(cmd *command.DropCommand) []command.CommandContent {
+	targets := t.rollupTargets(cmd.TargetSet().CandleSetWithoutYear)
+	result := make([]command.CommandContent, 0, len(targets))
+	for _, target := range targets {
+		dropCmd := command.NewDropCommand(derivedSet(cmd.TargetSet(), target))
+		result = append(result, &dropCmd)
+	}
+	return result
+}
+
+// buildRenameRollups creates commands moving the same year of derived sets to the destination code.
+func (t *TransactionContext) buildRenameRollups(cmd *command.RenameCommand) []command.CommandContent {
+	targets := t.rollupTargets(cmd.SourceSet().CandleSetWithoutYear)
+	result := make([]command.CommandContent, 0, len(targets))
+	for _, target := range targets {
+		renameCmd := command.NewRenameCommand(derivedSet(cmd.SourceSet(), target), cmd.ToMarketCode, cmd.ToCode)
+		result = append(result, &renameCmd)
+	}
+	return result
+}
+
+// buildRenameAdjustmentsRollups creates commands moving adjustments of derived sets to the destination code.
+// Derived sets without adjustments are skipped.
+func (t *TransactionContext) buildRenameAdjustmentsRollups(cmd *command.RenameAdjustmentsCommand) ([]command.CommandContent, error) {
+	targets := t.rollupTargets(cmd.SourceSet())
+	result := make([]command.CommandContent, 0, len(targets))
+	for _, target := range targets {
+		derived := cmd.SourceSet()
+		derived.CandleLength = target
+		adjustments, err := t.accessor.GetAdjustments(derived, false)
+		if err != nil {
+			return []command.CommandContent{}, errors.Wrapf(err, "failed to read derived adjustments (key '%s')", derived.UniqueKey())
+		}
+		if len(*adjustments) == 0 {
+			continue
+		}
+		renameCmd := command.NewRenameAdjustmentsCommand(derived, cmd.ToMarketCode, cmd.ToCode)
+		result = append(result, &renameCmd)
+	}
+	return result, nil
+}
+
+// buildDropAdjustmentsRollups creates commands dropping adjustments of derived sets.
+// Derived sets without adjustments are skipped.
+func (t *TransactionContext) buildDropAdjustmentsRollups(cmd *command.DropAdjustmentsCommand) ([]command.CommandContent, error) {
+	targets := t.rollupTargets(cmd.TargetSet())
+	result := make([]command.CommandContent, 0, len(targets))
+	for _, target := range targets {
+		derived := cmd.TargetSet()
+		derived.CandleLength = target
+		adjustments, err := t.accessor.GetAdjustments(derived, false)
+		if err != nil {
+			return []command.CommandContent{}, errors.Wrapf(err, "failed to read derived adjustments (key '%s')", derived.UniqueKey())
+		}
+		if len(*adjustments) == 0 {
+			continue
+		}
+		dropCmd := command.NewDropAdjustmentsCommand(derived)
+		result = append(result, &dropCmd)
+	}
+	return result, nil
+}
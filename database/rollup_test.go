@@ -0,0 +1,132 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/page"
+)
+
+func openRollupTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	db := openTestDatabase(t, testConfig(t))
+	if err := db.AddRollup("TEST", 60, 300); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func rollupOf(set page.CandleSetWithoutYear) page.CandleSetWithoutYear {
+	set.CandleLength = 300
+	return set
+}
+
+func expectRollup(t *testing.T, db *Database, set page.CandleSetWithoutYear) {
+	t.Helper()
+	expected, err := readAll(t, db, set).Resample(60, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, readAll(t, db, rollupOf(set)), expected)
+}
+
+func TestWriteUpdatesRollups(t *testing.T) {
+	db := openRollupTestDatabase(t)
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 7, 10)); err != nil {
+		t.Fatal(err)
+	}
+	// Candles written later update the bucket they fall in
+	if _, err := db.Write(set, testCandles(testStart.Add(7*time.Minute), 5, 20)); err != nil {
+		t.Fatal(err)
+	}
+	expectRollup(t, db, set)
+	if got := readAll(t, db, rollupOf(set)); len(got) != 3 {
+		t.Fatalf("expected 3 buckets, got %v", got)
+	}
+}
+
+func TestUpdateLastRecomputesRollups(t *testing.T) {
+	db := openRollupTestDatabase(t)
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+	// The derived candle has extremes no base candle reaches, as if written before the rollup was added
+	stale := common.Candle{Timestamp: testStart, TimelessCandle: common.TimelessCandle{Open: 1, High: 100, Low: 0, Close: 12, Volume: 3}}
+	if _, err := db.Write(rollupOf(set), common.CandleList{stale}); err != nil {
+		t.Fatal(err)
+	}
+
+	update := common.CandleUpdate{Fields: common.UpdateHigh | common.UpdateClose, High: 14, Close: 14}
+	if err := db.UpdateLast(set, testStart.Add(2*time.Minute), update); err != nil {
+		t.Fatal(err)
+	}
+	expectRollup(t, db, set)
+}
+
+func TestDeleteRangeRecomputesRollups(t *testing.T) {
+	db := openRollupTestDatabase(t)
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 15, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removes part of the first bucket and the whole second bucket
+	removed, err := db.DeleteRange(set, common.TimeRange{Start: testStart.Add(3 * time.Minute), End: testStart.Add(10 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 7 {
+		t.Fatalf("expected 7 removed candles, got %d", removed)
+	}
+	expectRollup(t, db, set)
+	if got := readAll(t, db, rollupOf(set)); len(got) != 2 {
+		t.Fatalf("expected 2 buckets, got %v", got)
+	}
+}
+
+func TestDropSetDropsRollups(t *testing.T) {
+	db := openRollupTestDatabase(t)
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 10, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DropSet(set); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, db, rollupOf(set)); len(got) != 0 {
+		t.Fatalf("expected derived set to be dropped, got %v", got)
+	}
+}
+
+func TestRenameMovesRollups(t *testing.T) {
+	db := openRollupTestDatabase(t)
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 10, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Rename(set, "TEST", "B"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, db, rollupOf(set)); len(got) != 0 {
+		t.Fatalf("expected source derived set to be empty, got %v", got)
+	}
+	expectRollup(t, db, testSet("B"))
+	if got := readAll(t, db, rollupOf(testSet("B"))); len(got) != 2 {
+		t.Fatalf("expected 2 moved buckets, got %v", got)
+	}
+}
+
+func TestAddRollupRejectsBucketsLongerThanADay(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	for _, target := range []uint32{7 * 86400, 2 * 86400, 7200 * 7} {
+		if err := db.AddRollup("TEST", 60, target); err == nil {
+			t.Errorf("expected rollup length %d to be rejected", target)
+		}
+	}
+	if err := db.AddRollup("TEST", 60, 86400); err != nil {
+		t.Errorf("expected daily rollups to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+)
+
+func beginTestTx(t *testing.T, db *Database) *Tx {
+	t.Helper()
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func mustInsert(t *testing.T, tx *Tx, set string, candles common.CandleList) {
+	t.Helper()
+	if err := tx.Insert(testSet(set), candles); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustSavepoint(t *testing.T, tx *Tx, name string) {
+	t.Helper()
+	if err := tx.Savepoint(name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustRollbackTo(t *testing.T, tx *Tx, name string) {
+	t.Helper()
+	if err := tx.RollbackTo(name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackToSavepoint(t *testing.T) {
+	config := testConfig(t)
+	db := openTestDatabase(t, config)
+	first := testCandles(testStart, 2, 10)
+	second := testCandles(testStart.Add(time.Hour), 2, 20)
+	third := testCandles(testStart.Add(2*time.Hour), 2, 30)
+
+	tx := beginTestTx(t, db)
+	mustInsert(t, tx, "A", first)
+	mustSavepoint(t, tx, "s1")
+	mustInsert(t, tx, "A", second)
+	// B is written for the first time after the savepoint
+	mustInsert(t, tx, "B", second)
+	mustSavepoint(t, tx, "s2")
+	mustInsert(t, tx, "A", third)
+	mustRollbackTo(t, tx, "s1")
+
+	// The savepoint is kept, and can be rolled back to again
+	mustInsert(t, tx, "A", third)
+	mustRollbackTo(t, tx, "s1")
+	if err := tx.RollbackTo("s2"); err == nil {
+		t.Error("expected savepoints after the rolled back one to be removed")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, readAll(t, db, testSet("A")), first)
+	expectCandles(t, readAll(t, db, testSet("B")), common.CandleList{})
+
+	db = reopenTestDatabase(t, db, config)
+	expectCandles(t, readAll(t, db, testSet("A")), first)
+	expectCandles(t, readAll(t, db, testSet("B")), common.CandleList{})
+}
+
+func TestRollbackToLaterSavepoint(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	first := testCandles(testStart, 1, 10)
+	second := testCandles(testStart.Add(time.Hour), 1, 20)
+	third := testCandles(testStart.Add(2*time.Hour), 1, 30)
+
+	tx := beginTestTx(t, db)
+	mustInsert(t, tx, "A", first)
+	mustSavepoint(t, tx, "s1")
+	mustInsert(t, tx, "A", second)
+	mustSavepoint(t, tx, "s2")
+	mustInsert(t, tx, "A", third)
+	mustInsert(t, tx, "B", third)
+	mustRollbackTo(t, tx, "s2")
+
+	got, err := tx.Read(testSet("A"), common.TimeRange{Start: testStart, End: testStart.AddDate(0, 1, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, got, append(append(common.CandleList{}, first...), second...))
+
+	mustRollbackTo(t, tx, "s1")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, readAll(t, db, testSet("A")), first)
+	expectCandles(t, readAll(t, db, testSet("B")), common.CandleList{})
+}
+
+func TestRollbackToRecoversAbortedTx(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	first := testCandles(testStart, 1, 10)
+
+	tx := beginTestTx(t, db)
+	mustInsert(t, tx, "A", first)
+	mustSavepoint(t, tx, "s1")
+	// A conflict resolved with an unknown mode fails the command, aborting the transaction
+	if _, err := tx.execute(CommandContentFactory{}.InsertToSet(testSet("A"), testCandles(testStart, 1, 10), 9)); err == nil {
+		t.Fatal("expected an unknown conflict mode to fail")
+	}
+	if err := tx.Insert(testSet("A"), first); err == nil {
+		t.Fatal("expected the transaction to be aborted")
+	}
+	mustRollbackTo(t, tx, "s1")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectCandles(t, readAll(t, db, testSet("A")), first)
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// Snapshot returns the candle at t, or the latest one before t, of every code in the market with the candle length.
+// Codes without any candle at or before t are omitted.
+//
+// Codes are listed from the catalog, which is built from the directory layout and resident pages on open,
+// and updated on every commit creating or removing a page. Only an intent lock is taken on the market,
+// so codes may be created while the snapshot runs, and codes created after the listing are not included.
+// Each code is locked before its years are listed and stays locked until the snapshot ends,
+// so a code is never read partway through a transaction writing to it.
+func (d *Database) Snapshot(marketCode string, candleLength uint32, t time.Time) (map[string]common.Candle, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return map[string]common.Candle{}, err
+	}
+	defer tx.RollbackIfActive()
+
+	if err := d.Lock.EnsureLock(tx.ctx, tx.txId, concurrency.NewMarketResourceName(marketCode), concurrency.ISLock); err != nil {
+		return map[string]common.Candle{}, errors.Wrap(err, "failed to lock market")
+	}
+	codes := d.catalog.Codes(marketCode, candleLength)
+	result := make(map[string]common.Candle)
+	for _, code := range codes {
+		set := page.CandleSetWithoutYear{
+			MarketCode:   marketCode,
+			Code:         code,
+			CandleLength: candleLength,
+		}
+		candle, found, err := tx.latestAt(set, t)
+		if err != nil {
+			return map[string]common.Candle{}, errors.Wrapf(err, "failed to read code '%s'", code)
+		}
+		if found {
+			result[code] = candle
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return map[string]common.Candle{}, errors.Wrap(err, "failed to commit")
+	}
+	return result, nil
+}
+
+// latestAt finds the candle at t or the latest one before t, looking back into previous years if needed.
+func (t *TransactionContext) latestAt(set page.CandleSetWithoutYear, at time.Time) (common.Candle, bool, error) {
+	targetYear, err := pageYear(at)
+	if err != nil {
+		return common.Candle{}, false, err
+	}
+	years, err := t.lockCodeAndListYears(set, false)
+	if err != nil {
+		return common.Candle{}, false, err
+	}
+	for i := len(years) - 1; i >= 0; i-- {
+		if years[i] > targetYear {
+			continue
+		}
+		target := page.CandleSet{CandleSetWithoutYear: set, Year: years[i]}
+		if err := t.lockSet(target, false); err != nil {
+			return common.Candle{}, false, err
+		}
+		yearStart := common.GetStartOfYearTimestamp(int(years[i]))
+		offset := uint32(common.GetStartOfYearTimestamp(int(years[i])+1) - yearStart - 1)
+		if years[i] == targetYear {
+			offset = uint32(at.Unix() - yearStart)
+		}
+		block, found, err := t.accessor.Search(target, offset, page.SearchAtOrBefore)
+		if err != nil {
+			return common.Candle{}, false, errors.Wrapf(err, "failed to search (key '%s')", target.UniqueKey())
+		}
+		if found {
+			return block.ToCandle(), true, nil
+		}
+	}
+	return common.Candle{}, false, nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/storage"
+	"github.com/jungnoh/mora/page"
+)
+
+func TestSnapshotAcrossCodes(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	a := testCandles(testStart, 3, 10)
+	b := testCandles(testStart.AddDate(-1, 0, 0), 2, 20)
+	late := testCandles(testStart.Add(time.Hour), 1, 30)
+	if _, err := db.Write(testSet("A"), a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Write(testSet("B"), b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Write(testSet("C"), late); err != nil {
+		t.Fatal(err)
+	}
+	other := page.CandleSetWithoutYear{MarketCode: "TEST", Code: "D", CandleLength: 300}
+	if _, err := db.Write(other, a); err != nil {
+		t.Fatal(err)
+	}
+	// Codes only on disk are found as well as resident ones
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+
+	result, err := db.Snapshot("TEST", 60, a[1].Timestamp.Add(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("expected codes A and B, got %v", result)
+	}
+	// The latest candle before the time, looking back into the previous year if needed
+	expectCandles(t, common.CandleList{result["A"], result["B"]}, common.CandleList{a[1], b[1]})
+}
+
+func TestSnapshotExcludesUncommittedCodes(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	if _, err := db.Write(testSet("A"), testCandles(testStart, 1, 10)); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := tx.Insert(testSet("B"), testCandles(testStart, 1, 20)); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := db.Snapshot("TEST", 60, testStart.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result["B"]; len(result) != 1 || ok {
+		t.Errorf("expected only code A, got %v", result)
+	}
+}
+
+func TestSnapshotRejectsTimeOutOfPageYears(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	if _, err := db.Write(testSet("A"), testCandles(time.Date(2000, 3, 1, 0, 0, 0, 0, time.UTC), 1, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Year 67536 would wrap around to 2000 if truncated to a page year
+	if _, err := db.Snapshot("TEST", 60, time.Date(67536, 3, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatal("expected a snapshot out of page years to fail")
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// SetStat summarizes the candles stored in a set.
+type SetStat struct {
+	FirstTime time.Time
+	LastTime  time.Time
+	Count     uint64
+	YearCount int
+	DiskBytes int64
+}
+
+func (s SetStat) String() string {
+	return fmt.Sprintf("SetStat(First=%s, Last=%s, Count=%d, Years=%d, DiskBytes=%d)", s.FirstTime, s.LastTime, s.Count, s.YearCount, s.DiskBytes)
+}
+
+// Stat summarizes the set from page headers only, without reading candle bodies.
+// Headers of pages resident in memory are used over the ones on disk, as they may not be flushed yet.
+func (d *Database) Stat(set page.CandleSetWithoutYear) (SetStat, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return SetStat{}, err
+	}
+	defer tx.RollbackIfActive()
+
+	years, err := tx.lockCodeAndListYears(set, false)
+	if err != nil {
+		return SetStat{}, err
+	}
+	result := SetStat{}
+	for _, year := range years {
+		target := page.CandleSet{CandleSetWithoutYear: set, Year: year}
+		if err := tx.lockSet(target, false); err != nil {
+			return SetStat{}, err
+		}
+		header, err := tx.accessor.Header(target)
+		if err != nil {
+			return SetStat{}, errors.Wrapf(err, "failed to read header (key '%s')", target.UniqueKey())
+		}
+		size, err := tx.accessor.DiskSize(target)
+		if err != nil {
+			return SetStat{}, err
+		}
+		result.DiskBytes += size
+		if header.IsZero() || header.Count == 0 {
+			continue
+		}
+		if result.YearCount == 0 {
+			result.FirstTime = header.GetFirstTime().UTC()
+		}
+		result.LastTime = header.GetLastTime().UTC()
+		result.Count += uint64(header.Count)
+		result.YearCount++
+	}
+	if err := tx.Commit(); err != nil {
+		return SetStat{}, errors.Wrap(err, "failed to commit")
+	}
+	return result, nil
+}
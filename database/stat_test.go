@@ -0,0 +1,52 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/database/storage"
+)
+
+func TestStat(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	lastYear := testCandles(testStart.AddDate(-1, 0, 0), 2, 10)
+	thisYear := testCandles(testStart, 3, 20)
+	if _, err := db.Write(set, append(lastYear, thisYear...)); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := db.Stat(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Count != 5 || stat.YearCount != 2 || stat.DiskBytes != 0 ||
+		!stat.FirstTime.Equal(lastYear[0].Timestamp) || !stat.LastTime.Equal(thisYear[2].Timestamp) {
+		t.Errorf("unexpected stat of resident pages %s", stat)
+	}
+
+	// Headers on disk are used for evicted pages, and resident ones for pages changed since
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	more := testCandles(thisYear[2].Timestamp.Add(time.Minute), 2, 30)
+	if _, err := db.Write(set, more); err != nil {
+		t.Fatal(err)
+	}
+	stat, err = db.Stat(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Count != 7 || stat.YearCount != 2 || stat.DiskBytes == 0 || !stat.LastTime.Equal(more[1].Timestamp) {
+		t.Errorf("unexpected stat %s", stat)
+	}
+
+	empty, err := db.Stat(testSet("B"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Count != 0 || empty.YearCount != 0 || !empty.FirstTime.IsZero() {
+		t.Errorf("expected an empty stat, got %s", empty)
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"github.com/jungnoh/mora/common"
 	"github.com/jungnoh/mora/database/command"
 	"github.com/jungnoh/mora/database/storage/memory"
 	"github.com/jungnoh/mora/database/storage/wal"
@@ -20,9 +21,43 @@ type StorageAccessor struct {
 	storage    *Storage
 	started    bool
 	finished   bool
+	logged     bool
 
 	readers map[string]*memory.MemoryReader
 	writers map[string]*memory.MemoryWriter
+
+	adjustments map[string]accessorAdjustments
+	savepoints  []accessorSavepoint
+	// renamedSources are source pages of renames, which are pinned in memory on commit
+	renamedSources []page.CandleSet
+	// droppedPages are pages emptied by drops, which are evicted from memory on commit
+	droppedPages []page.CandleSet
+}
+
+// accessorSavepoint holds copies of contents as they were at the savepoint.
+// Contents are copied on their first exclusive access after the savepoint, so unchanged ones are never copied.
+type accessorSavepoint struct {
+	name        string
+	pages       map[string]accessorPageSnapshot
+	adjustments map[string]accessorAdjustmentsSnapshot
+}
+
+// accessorPageSnapshot is a copy of a page, or marks that it was not written yet at the savepoint.
+type accessorPageSnapshot struct {
+	content page.Page
+	written bool
+}
+
+// accessorAdjustmentsSnapshot is a copy of adjustments, or marks that they were not changed yet at the savepoint.
+type accessorAdjustmentsSnapshot struct {
+	adjustments accessorAdjustments
+	changed     bool
+}
+
+// accessorAdjustments is a copy of adjustments changed by the transaction, stored on commit.
+type accessorAdjustments struct {
+	set  page.CandleSetWithoutYear
+	list *common.AdjustmentList
 }
 
 func (s *StorageAccessor) checkUse() {
@@ -59,6 +94,12 @@ func (s *StorageAccessor) addWrite(set page.CandleSet) error {
 	if _, ok := s.writers[key]; ok {
 		return nil
 	}
+	// The page is upgraded from read to write. The shared lock of the reader should be released
+	// first, as the writer waits for it; other writers are kept out by the database lock.
+	if reader, ok := s.readers[key]; ok {
+		reader.Done()
+		delete(s.readers, key)
+	}
 	writer, err := s.storage.write(s.txId, set)
 	if err != nil {
 		return errors.Wrapf(err, "failed to open read for set '%s'", key)
@@ -85,8 +126,17 @@ func (s *StorageAccessor) Start() (txId uint64, err error) {
 
 func (s *StorageAccessor) Execute(cmd command.CommandContent) (interface{}, error) {
 	fullCmd := command.NewCommand(s.txId, cmd)
-	if err := s.walFactory.Write(fullCmd); err != nil {
-		return struct{}{}, err
+	if fullCmd.Type.Logged() {
+		if err := s.walFactory.Write(fullCmd); err != nil {
+			return struct{}{}, err
+		}
+		s.logged = true
+	}
+	switch typed := cmd.(type) {
+	case *command.RenameCommand:
+		s.renamedSources = append(s.renamedSources, typed.SourceSet())
+	case *command.DropCommand:
+		s.droppedPages = append(s.droppedPages, typed.TargetSet())
 	}
 	return fullCmd.Content.Execute(s)
 }
@@ -95,30 +145,51 @@ func (s *StorageAccessor) Commit() error {
 	s.checkUse()
 	log.Debug().Uint64("id", s.txId).Msg("Tx COMMIT")
 	defer s.walFactory.Close()
-	if err := s.execCommit(); err != nil {
+	seq, err := s.execCommit()
+	if err != nil {
+		// Nothing is applied, so pages are unlocked and changes made in place are undone as on rollback
+		s.release()
 		return err
 	}
 	for _, reader := range s.readers {
 		reader.Done()
 	}
+	// Pinned before the pages are unlocked, so they cannot be evicted in between
+	s.storage.pin(s.renamedSources, seq)
 	for _, writer := range s.writers {
-		writer.Commit()
+		writer.Commit(seq)
+	}
+	for _, adjustments := range s.adjustments {
+		s.storage.commitAdjustments(adjustments.set, *adjustments.list)
 	}
+	// Database locks are still held, so no other transaction loads the pages in between
+	s.storage.evictDropped(s.droppedPages)
 	s.finished = true
 	return nil
 }
 
-func (s *StorageAccessor) execCommit() error {
-	if err := s.walFactory.Write(command.NewCommand(s.txId, &command.CommitCommand{})); err != nil {
-		return errors.Wrap(err, "failed to log commit")
+// execCommit logs the commit, returning its commit sequence number.
+func (s *StorageAccessor) execCommit() (uint64, error) {
+	// Nothing to commit if only reads were executed
+	if !s.logged {
+		return 0, nil
 	}
-	return nil
+	seq, err := s.walFactory.Commit(s.txId)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to log commit")
+	}
+	return seq, nil
 }
 
 func (s *StorageAccessor) Rollback() {
 	s.checkUse()
 	log.Debug().Uint64("id", s.txId).Msg("Tx ROLLBACK")
 	defer s.walFactory.Close()
+	s.release()
+}
+
+// release unlocks pages, discarding changes made to them.
+func (s *StorageAccessor) release() {
 	for _, reader := range s.readers {
 		reader.Done()
 	}
@@ -135,12 +206,168 @@ func (s *StorageAccessor) RollbackIfActive() {
 	s.Rollback()
 }
 
+// Savepoint logs a savepoint. Contents are copied on their first change after it, to restore on RollbackTo.
+func (s *StorageAccessor) Savepoint(name string) error {
+	s.checkUse()
+	if _, err := s.Execute(&command.SavepointCommand{Name: name}); err != nil {
+		return errors.Wrapf(err, "failed to log savepoint '%s'", name)
+	}
+	s.savepoints = append(s.savepoints, accessorSavepoint{
+		name:        name,
+		pages:       make(map[string]accessorPageSnapshot),
+		adjustments: make(map[string]accessorAdjustmentsSnapshot),
+	})
+	return nil
+}
+
+// snapshotPage copies the page to the latest savepoint before it is changed for the first time after it.
+func (s *StorageAccessor) snapshotPage(key string) {
+	if len(s.savepoints) == 0 {
+		return
+	}
+	savepoint := &s.savepoints[len(s.savepoints)-1]
+	if _, ok := savepoint.pages[key]; ok {
+		return
+	}
+	snapshot := accessorPageSnapshot{}
+	if writer, ok := s.writers[key]; ok {
+		snapshot = accessorPageSnapshot{content: writer.Snapshot(), written: true}
+	}
+	savepoint.pages[key] = snapshot
+}
+
+// snapshotAdjustments copies the adjustments to the latest savepoint before they are changed for the first time after it.
+func (s *StorageAccessor) snapshotAdjustments(key string) {
+	if len(s.savepoints) == 0 {
+		return
+	}
+	savepoint := &s.savepoints[len(s.savepoints)-1]
+	if _, ok := savepoint.adjustments[key]; ok {
+		return
+	}
+	snapshot := accessorAdjustmentsSnapshot{}
+	if adjustments, ok := s.adjustments[key]; ok {
+		copied := adjustments.list.Copy()
+		snapshot = accessorAdjustmentsSnapshot{adjustments: accessorAdjustments{set: adjustments.set, list: &copied}, changed: true}
+	}
+	savepoint.adjustments[key] = snapshot
+}
+
+// RollbackTo restores written contents to the last savepoint with the name, which is kept.
+// Pages stay locked, and a marker is logged so the WAL flusher discards entries after the savepoint.
+func (s *StorageAccessor) RollbackTo(name string) error {
+	s.checkUse()
+	index := -1
+	for i := len(s.savepoints) - 1; i >= 0; i-- {
+		if s.savepoints[i].name == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return errors.Errorf("savepoint '%s' does not exist", name)
+	}
+	if _, err := s.Execute(&command.RollbackToCommand{Name: name}); err != nil {
+		return errors.Wrapf(err, "failed to log rollback to savepoint '%s'", name)
+	}
+
+	// Contents changed after the savepoint were copied to it or to a later one on their first change.
+	// Later savepoints are restored first, so the copy closest to the savepoint is kept.
+	for i := len(s.savepoints) - 1; i >= index; i-- {
+		for key, snapshot := range s.savepoints[i].pages {
+			writer, ok := s.writers[key]
+			if !ok {
+				continue
+			}
+			if snapshot.written {
+				writer.Restore(snapshot.content)
+			} else {
+				writer.Reset()
+			}
+		}
+		for key, snapshot := range s.savepoints[i].adjustments {
+			if !snapshot.changed {
+				delete(s.adjustments, key)
+				continue
+			}
+			copied := snapshot.adjustments.list.Copy()
+			s.adjustments[key] = accessorAdjustments{set: snapshot.adjustments.set, list: &copied}
+		}
+	}
+	s.savepoints = s.savepoints[:index+1]
+	return nil
+}
+
+// OpenCursor opens a cursor over blocks of the set, starting from the first block at or after fromOffset.
+// Unlike GetPage, the page is not loaded to memory, and the cursor should be closed by the caller.
+func (s *StorageAccessor) OpenCursor(set page.CandleSet, fromOffset uint32) (*PageCursor, error) {
+	s.checkUse()
+	key := set.UniqueKey()
+
+	if dd, ok := s.writers[key]; ok {
+		content := dd.Content()
+		return &PageCursor{
+			blocks: content.Body[content.SearchOffset(fromOffset):],
+		}, nil
+	}
+	if dd, ok := s.readers[key]; ok {
+		content := dd.Get()
+		return &PageCursor{
+			blocks: content.Body[content.SearchOffset(fromOffset):],
+		}, nil
+	}
+	return s.storage.openCursor(s.txId, set, fromOffset), nil
+}
+
+// Search looks up a block of the set by its TimestampOffset.
+// Pages not resident in memory are searched on disk, without being loaded.
+func (s *StorageAccessor) Search(set page.CandleSet, offset uint32, mode page.SearchMode) (page.PageBodyBlock, bool, error) {
+	s.checkUse()
+	key := set.UniqueKey()
+
+	if dd, ok := s.writers[key]; ok {
+		block, found := dd.Content().Search(offset, mode)
+		return block, found, nil
+	}
+	if dd, ok := s.readers[key]; ok {
+		block, found := dd.Get().Search(offset, mode)
+		return block, found, nil
+	}
+	return s.storage.search(s.txId, set, offset, mode)
+}
+
+// Header returns the header of the set, from memory if resident or else from disk.
+// A zero header is returned if the page does not exist.
+func (s *StorageAccessor) Header(set page.CandleSet) (page.PageHeader, error) {
+	s.checkUse()
+	key := set.UniqueKey()
+
+	if dd, ok := s.writers[key]; ok {
+		return dd.Content().Header, nil
+	}
+	if dd, ok := s.readers[key]; ok {
+		return dd.Get().Header, nil
+	}
+	return s.storage.header(s.txId, set)
+}
+
+// DiskSize returns the size of the page file of the set.
+func (s *StorageAccessor) DiskSize(set page.CandleSet) (int64, error) {
+	return s.storage.disk.FileSize(set)
+}
+
 // Methods to implement database.pageAccessor
 func (s *StorageAccessor) GetPage(set page.CandleSet, exclusive bool) (*page.Page, error) {
 	s.checkUse()
 	key := set.UniqueKey()
 
+	if exclusive {
+		s.snapshotPage(key)
+	}
 	if dd, ok := s.writers[key]; ok {
+		if !exclusive {
+			return dd.Content(), nil
+		}
 		return dd.WritableContent(), nil
 	}
 	if dd, ok := s.readers[key]; ok && !exclusive {
@@ -160,6 +387,40 @@ func (s *StorageAccessor) GetPage(set page.CandleSet, exclusive bool) (*page.Pag
 	return s.readers[key].Get(), nil
 }
 
+// UpdateLast applies a partial update to the last block of the set, without copying the page unless it was already.
+func (s *StorageAccessor) UpdateLast(set page.CandleSet, offset uint32, update common.CandleUpdate) error {
+	s.checkUse()
+	key := set.UniqueKey()
+
+	s.snapshotPage(key)
+	if err := s.addWrite(set); err != nil {
+		return errors.Wrap(err, "failed to add write")
+	}
+	return s.writers[key].UpdateLast(offset, update)
+}
+
+// GetAdjustments returns the adjustments of the set.
+// Exclusive access returns a copy kept for the transaction, which is stored on commit.
+func (s *StorageAccessor) GetAdjustments(set page.CandleSetWithoutYear, exclusive bool) (*common.AdjustmentList, error) {
+	s.checkUse()
+	key := adjustmentCacheKey(set)
+
+	if exclusive {
+		s.snapshotAdjustments(key)
+	}
+	if dd, ok := s.adjustments[key]; ok {
+		return dd.list, nil
+	}
+	loaded, err := s.storage.readAdjustments(set)
+	if err != nil {
+		return nil, err
+	}
+	if exclusive {
+		s.adjustments[key] = accessorAdjustments{set: set, list: &loaded}
+	}
+	return &loaded, nil
+}
+
 func (s *StorageAccessor) AcquirePage(set page.CandleSet, exclusive bool) (func(), error) {
 	return func() {}, nil
 }
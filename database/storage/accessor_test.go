@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/page"
+)
+
+func TestFailedCommitRollsBackWriters(t *testing.T) {
+	config := util.Config{
+		Directory:        t.TempDir(),
+		MaxMemoryPages:   100,
+		EvictionInterval: 3600,
+		Durability:       util.DurabilityCommit,
+	}
+	s := NewStorage(&config)
+	defer s.Stop()
+	set := page.CandleSet{Year: 2022, CandleSetWithoutYear: page.CandleSetWithoutYear{MarketCode: "TEST", Code: "A", CandleLength: 60}}
+	start := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	offset := uint32(start.Unix() - common.GetStartOfYearTimestamp(2022))
+
+	execute := func(cmd command.CommandContent) StorageAccessor {
+		t.Helper()
+		accessor, _ := s.Access()
+		if _, err := accessor.Start(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := accessor.Execute(cmd); err != nil {
+			t.Fatal(err)
+		}
+		return accessor
+	}
+	candle := common.Candle{Timestamp: start, TimelessCandle: common.TimelessCandle{Open: 10, High: 11, Low: 9, Close: 10, Volume: 1}}
+	insert := command.NewInsertCommand(set, common.CandleList{candle}.ToTimestampCandleList(), page.ConflictOverwrite)
+	inserted := execute(&insert)
+	if err := inserted.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The update changes the page in place, and the log is closed before it commits
+	update := command.NewUpdateLastCommand(set, offset, common.CandleUpdate{Fields: common.UpdateClose, Close: 20})
+	updated := execute(&update)
+	s.wal.Close()
+	if err := updated.Commit(); err == nil {
+		t.Fatal("expected the commit to fail after the log is closed")
+	}
+
+	found := make(chan page.PageBodyBlock, 1)
+	go func() {
+		accessor, _ := s.Access()
+		accessor.Start()
+		defer accessor.Rollback()
+		if err := accessor.addRead(set); err != nil {
+			t.Error(err)
+		}
+		block, _, _ := accessor.Search(set, offset, page.SearchExact)
+		found <- block
+	}()
+	select {
+	case block := <-found:
+		if block.ToCandle().TimelessCandle != candle.TimelessCandle {
+			t.Fatalf("expected the update to be undone, got %v", block.ToCandle())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("page is still locked by the failed commit")
+	}
+}
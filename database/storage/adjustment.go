@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+func adjustmentCacheKey(set page.CandleSetWithoutYear) string {
+	return set.UniqueKey()
+}
+
+// readAdjustments returns a copy of the adjustments of the set, loading them from disk on first use.
+func (s *Storage) readAdjustments(set page.CandleSetWithoutYear) (common.AdjustmentList, error) {
+	s.adjustmentLock.Lock()
+	defer s.adjustmentLock.Unlock()
+
+	key := adjustmentCacheKey(set)
+	if cached, ok := s.adjustments[key]; ok {
+		return cached.Copy(), nil
+	}
+	loaded, _, err := s.disk.ReadAdjustments(set)
+	if err != nil {
+		return common.AdjustmentList{}, errors.Wrap(err, "failed to load adjustments")
+	}
+	s.adjustments[key] = loaded
+	return loaded.Copy(), nil
+}
+
+// commitAdjustments replaces the cached adjustments with ones changed by a committed transaction.
+// Cached adjustments are never evicted, and only reach disk when the WAL is flushed.
+func (s *Storage) commitAdjustments(set page.CandleSetWithoutYear, adjustments common.AdjustmentList) {
+	s.adjustmentLock.Lock()
+	defer s.adjustmentLock.Unlock()
+
+	s.adjustments[adjustmentCacheKey(set)] = adjustments.Copy()
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// cursorBatchSize is the number of blocks a cursor reads at a time.
+const cursorBatchSize = 1024
+
+// PageCursor iterates blocks of a single year page.
+// Pages not held by the transaction are read in batches, from memory if resident or else decoded from disk.
+// Memory and disk locks are only held while reading a batch, so an open cursor does not block eviction or WAL flushes.
+type PageCursor struct {
+	blocks   page.PageBodyBlockList
+	position int
+
+	// storage is nil if all blocks were read on open
+	storage    *Storage
+	txId       uint64
+	set        page.CandleSet
+	nextOffset uint32
+	exhausted  bool
+}
+
+func (c *PageCursor) Next() (page.PageBodyBlock, bool, error) {
+	if c.position >= len(c.blocks) {
+		if c.storage == nil || c.exhausted {
+			return page.PageBodyBlock{}, false, nil
+		}
+		blocks, err := c.storage.readBlocks(c.txId, c.set, c.nextOffset, cursorBatchSize)
+		if err != nil {
+			return page.PageBodyBlock{}, false, err
+		}
+		c.blocks = blocks
+		c.position = 0
+		c.exhausted = len(blocks) < cursorBatchSize
+		if len(blocks) == 0 {
+			return page.PageBodyBlock{}, false, nil
+		}
+	}
+	block := c.blocks[c.position]
+	c.position++
+	// Batches resume after the last block, as the page may be evicted or flushed in between
+	c.nextOffset = block.TimestampOffset + 1
+	return block, true, nil
+}
+
+func (c *PageCursor) Close() error {
+	c.blocks = nil
+	c.storage = nil
+	return nil
+}
+
+func (s *Storage) openCursor(txId uint64, set page.CandleSet, fromOffset uint32) *PageCursor {
+	return &PageCursor{
+		storage:    s,
+		txId:       txId,
+		set:        set,
+		nextOffset: fromOffset,
+	}
+}
+
+// readBlocks reads up to n blocks of the set, starting from the first block at or after fromOffset.
+func (s *Storage) readBlocks(txId uint64, set page.CandleSet, fromOffset uint32, n int) (page.PageBodyBlockList, error) {
+	if reader, ok := s.memory.Read(txId, set); ok {
+		defer reader.Done()
+		content := reader.Get()
+		blocks := content.Body[content.SearchOffset(fromOffset):]
+		if len(blocks) > n {
+			blocks = blocks[:n]
+		}
+		// Copied, as the page may be changed once unlocked
+		result := make(page.PageBodyBlockList, len(blocks))
+		copy(result, blocks)
+		return result, nil
+	}
+	blocks, err := s.disk.ReadBlocks(set, fromOffset, n)
+	if err != nil {
+		return page.PageBodyBlockList{}, errors.Wrapf(err, "failed to read page (key '%s')", set.UniqueKey())
+	}
+	return blocks, nil
+}
@@ -62,6 +62,13 @@ func (s *Storage) processDiskLoad(req *diskLoadRequest) diskLoadResponse {
 }
 
 func (s *Storage) processDiskStore(req *diskStoreRequest) diskStoreResponse {
+	// Empty pages are kept on disk only to shadow older contents until the WAL is flushed, which deletes the file.
+	if req.Content.Header.Count == 0 {
+		_, err := s.disk.WriteIfExists(*req.Content)
+		return diskStoreResponse{
+			Error: err,
+		}
+	}
 	err := s.disk.Write(*req.Content)
 	return diskStoreResponse{
 		Error: err,
@@ -0,0 +1,113 @@
+package disk
+
+import (
+	"encoding/binary"
+	"os"
+	"path"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+const adjustmentFileName string = "adjustments.adj"
+
+func adjustmentKey(set page.CandleSetWithoutYear) string {
+	return "adj^" + set.UniqueKey()
+}
+
+// ReadAdjustments reads the adjustments of the set and the commit sequence number of the last transaction applied to them.
+// An empty list is returned if there are none.
+func (d *Disk) ReadAdjustments(set page.CandleSetWithoutYear) (common.AdjustmentList, uint64, error) {
+	key := adjustmentKey(set)
+	unlock := d.lockS(key)
+	defer unlock()
+
+	return d.readAdjustments(set)
+}
+
+func (d *Disk) readAdjustments(set page.CandleSetWithoutYear) (common.AdjustmentList, uint64, error) {
+	key := adjustmentKey(set)
+	f, err := os.Open(path.Join(d.filePath.FolderFromSetWithoutYear(set), adjustmentFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return common.AdjustmentList{}, 0, nil
+		}
+		return common.AdjustmentList{}, 0, errors.Wrapf(err, "adjustment read fail (key '%s')", key)
+	}
+	defer f.Close()
+
+	var head struct {
+		LastSeq uint64
+		Count   uint32
+	}
+	if err := binary.Read(f, binary.LittleEndian, &head); err != nil {
+		return common.AdjustmentList{}, 0, errors.Wrapf(err, "adjustment read fail (key '%s')", key)
+	}
+	result := make(common.AdjustmentList, head.Count)
+	for i := range result {
+		if err := result[i].Read(common.AdjustmentSize, f); err != nil {
+			return common.AdjustmentList{}, 0, errors.Wrapf(err, "adjustment read fail (key '%s')", key)
+		}
+	}
+	return result, head.LastSeq, nil
+}
+
+// WriteAdjustments replaces the adjustments of the set, unless the file already has changes of lastSeq or later.
+func (d *Disk) WriteAdjustments(set page.CandleSetWithoutYear, adjustments common.AdjustmentList, lastSeq uint64) error {
+	key := adjustmentKey(set)
+	unlock := d.lockX(key)
+	defer unlock()
+	d.dirLock.RLock()
+	defer d.dirLock.RUnlock()
+
+	_, existingSeq, err := d.readAdjustments(set)
+	if err != nil {
+		return err
+	}
+	if existingSeq >= lastSeq {
+		return nil
+	}
+
+	filePath := path.Join(d.filePath.FolderFromSetWithoutYear(set), adjustmentFileName)
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return errors.Wrapf(err, "folder preparing fail (key '%s')", key)
+	}
+	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0755)
+	if err != nil {
+		return errors.Wrapf(err, "open fail (key '%s')", key)
+	}
+	defer f.Close()
+	if err := binary.Write(f, binary.LittleEndian, lastSeq); err != nil {
+		return errors.Wrapf(err, "adjustment write fail (key '%s')", key)
+	}
+	if err := binary.Write(f, binary.LittleEndian, uint32(len(adjustments))); err != nil {
+		return errors.Wrapf(err, "adjustment write fail (key '%s')", key)
+	}
+	for _, adjustment := range adjustments {
+		if err := adjustment.Write(f); err != nil {
+			return errors.Wrapf(err, "adjustment write fail (key '%s')", key)
+		}
+	}
+	return nil
+}
+
+// DeleteAdjustmentsIfNotNewer deletes the adjustment file of the set unless it has changes later than lastSeq,
+// and then the folders of the set if they are empty.
+func (d *Disk) DeleteAdjustmentsIfNotNewer(set page.CandleSetWithoutYear, lastSeq uint64) error {
+	key := adjustmentKey(set)
+	unlock := d.lockX(key)
+	defer unlock()
+
+	_, existingSeq, err := d.readAdjustments(set)
+	if err != nil {
+		return err
+	}
+	if existingSeq > lastSeq {
+		return nil
+	}
+	if err := os.Remove(path.Join(d.filePath.FolderFromSetWithoutYear(set), adjustmentFileName)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "delete fail (key '%s')", key)
+	}
+	return d.pruneFolders(set)
+}
@@ -2,6 +2,9 @@ package disk
 
 import (
 	"os"
+	"path"
+	"strconv"
+	"sync"
 
 	"github.com/jungnoh/mora/database/util"
 	"github.com/jungnoh/mora/page"
@@ -11,12 +14,15 @@ import (
 type Disk struct {
 	filePath   filePathResolver
 	accessLock util.RWMutexMap
+	// dirLock keeps directories from being pruned while a file is being created in them
+	dirLock *sync.RWMutex
 }
 
 func NewDisk(config *util.Config) Disk {
 	return Disk{
 		filePath:   filePathResolver{config: config},
 		accessLock: util.NewRWMutexMap(),
+		dirLock:    &sync.RWMutex{},
 	}
 }
 
@@ -25,6 +31,11 @@ func (d *Disk) ReadHeader(set page.CandleSet) (page.PageHeader, error) {
 	unlock := d.lockS(key)
 	defer unlock()
 
+	return d.readHeader(set)
+}
+
+func (d *Disk) readHeader(set page.CandleSet) (page.PageHeader, error) {
+	key := set.UniqueKey()
 	path := d.filePath.FileFromSet(set)
 	f, err := os.Open(path)
 	if err != nil {
@@ -67,6 +78,47 @@ func (d *Disk) Write(content page.Page) error {
 	unlock := d.lockX(key)
 	defer unlock()
 
+	return d.write(content)
+}
+
+// WriteIfExists writes the page only if its file already exists, returning if it was written.
+// Empty pages are written back this way so a file deleted by Delete is not created again.
+func (d *Disk) WriteIfExists(content page.Page) (bool, error) {
+	key := content.UniqueKey()
+	unlock := d.lockX(key)
+	defer unlock()
+
+	if _, err := os.Stat(d.filePath.FileFromHeader(content.Header)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "stat fail (key '%s')", key)
+	}
+	return true, d.write(content)
+}
+
+// WriteIfNewer writes the page unless the stored page has a later commit, returning if it was written.
+// Pages replayed from the WAL are written back this way, so pages written by memory eviction in the meantime are kept.
+func (d *Disk) WriteIfNewer(content page.Page) (bool, error) {
+	key := content.UniqueKey()
+	unlock := d.lockX(key)
+	defer unlock()
+
+	header, err := d.readHeader(content.Header.ToCandleSet())
+	if err != nil {
+		return false, err
+	}
+	if header.LastSeq > content.Header.LastSeq {
+		return false, nil
+	}
+	return true, d.write(content)
+}
+
+func (d *Disk) write(content page.Page) error {
+	key := content.UniqueKey()
+	d.dirLock.RLock()
+	defer d.dirLock.RUnlock()
+
 	path := d.filePath.FileFromHeader(content.Header)
 	if err := util.EnsureDirectoryOfFile(path); err != nil {
 		return errors.Wrapf(err, "folder preparing fail (key '%s')", key)
@@ -84,3 +136,163 @@ func (d *Disk) Write(content page.Page) error {
 	}
 	return nil
 }
+
+// Delete removes the page file of the set, and then the code, candle length and market folders if they are empty.
+// Deleting a page without a file is not an error.
+func (d *Disk) Delete(set page.CandleSet) error {
+	key := set.UniqueKey()
+	unlock := d.lockX(key)
+	defer unlock()
+
+	return d.delete(set)
+}
+
+// DeleteIfNotNewer deletes the page unless the stored page has a commit later than lastSeq.
+func (d *Disk) DeleteIfNotNewer(set page.CandleSet, lastSeq uint64) error {
+	key := set.UniqueKey()
+	unlock := d.lockX(key)
+	defer unlock()
+
+	header, err := d.readHeader(set)
+	if err != nil {
+		return err
+	}
+	if header.LastSeq > lastSeq {
+		return nil
+	}
+	return d.delete(set)
+}
+
+func (d *Disk) delete(set page.CandleSet) error {
+	key := set.UniqueKey()
+	if err := os.Remove(d.filePath.FileFromSet(set)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "delete fail (key '%s')", key)
+	}
+	return d.pruneFolders(set.CandleSetWithoutYear)
+}
+
+// pruneFolders removes the code, candle length and market folders of the set if they are empty.
+func (d *Disk) pruneFolders(set page.CandleSetWithoutYear) error {
+	d.dirLock.Lock()
+	defer d.dirLock.Unlock()
+	folders := []string{
+		d.filePath.FolderFromSetWithoutYear(set),
+		d.filePath.CandleFolder(set.MarketCode, set.CandleLength),
+		path.Join(d.filePath.config.Directory, set.MarketCode),
+	}
+	for _, folder := range folders {
+		entries, err := os.ReadDir(folder)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to list folder '%s'", folder)
+		}
+		if len(entries) > 0 {
+			break
+		}
+		if err := os.Remove(folder); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove folder '%s'", folder)
+		}
+	}
+	return nil
+}
+
+// Years lists the years of pages stored on disk for the set, in ascending order.
+func (d *Disk) Years(set page.CandleSetWithoutYear) ([]uint16, error) {
+	entries, err := os.ReadDir(d.filePath.FolderFromSetWithoutYear(set))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []uint16{}, nil
+		}
+		return []uint16{}, errors.Wrap(err, "failed to list pages")
+	}
+	result := make([]uint16, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if year, ok := d.filePath.YearFromFilename(entry.Name()); ok {
+			result = append(result, year)
+		}
+	}
+	return result, nil
+}
+
+// Codes lists the codes stored on disk under the market and candle length.
+func (d *Disk) Codes(marketCode string, candleLength uint32) ([]string, error) {
+	result, err := listDirectories(d.filePath.CandleFolder(marketCode, candleLength))
+	if err != nil {
+		return []string{}, errors.Wrap(err, "failed to list codes")
+	}
+	return result, nil
+}
+
+// Sets lists all sets stored on disk by walking the directory layout.
+func (d *Disk) Sets() ([]page.CandleSet, error) {
+	result := make([]page.CandleSet, 0)
+	markets, err := listDirectories(d.filePath.config.Directory)
+	if err != nil {
+		return result, errors.Wrap(err, "failed to list markets")
+	}
+	for _, marketCode := range markets {
+		lengths, err := listDirectories(path.Join(d.filePath.config.Directory, marketCode))
+		if err != nil {
+			return result, errors.Wrapf(err, "failed to list candle lengths of '%s'", marketCode)
+		}
+		for _, lengthName := range lengths {
+			candleLength, err := strconv.ParseUint(lengthName, 10, 32)
+			if err != nil {
+				continue
+			}
+			codes, err := d.Codes(marketCode, uint32(candleLength))
+			if err != nil {
+				return result, err
+			}
+			for _, code := range codes {
+				set := page.CandleSetWithoutYear{
+					MarketCode:   marketCode,
+					Code:         code,
+					CandleLength: uint32(candleLength),
+				}
+				years, err := d.Years(set)
+				if err != nil {
+					return result, err
+				}
+				for _, year := range years {
+					result = append(result, page.CandleSet{CandleSetWithoutYear: set, Year: year})
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+func listDirectories(folder string) ([]string, error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return []string{}, err
+	}
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			result = append(result, entry.Name())
+		}
+	}
+	return result, nil
+}
+
+// FileSize returns the size of the page file of the set, or 0 if it does not exist.
+func (d *Disk) FileSize(set page.CandleSet) (int64, error) {
+	info, err := os.Stat(d.filePath.FileFromSet(set))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "stat fail (key '%s')", set.UniqueKey())
+	}
+	return info.Size(), nil
+}
@@ -18,10 +18,10 @@ func (d *Disk) lockS(key string) UnlockFunc {
 func (d *Disk) lockX(key string) UnlockFunc {
 	log.Debug().Str("key", key).Str("set", "disk").Str("mode", "X").Msg("Trying to lock")
 	lock := d.accessLock.Get(key)
-	lock.RLock()
+	lock.Lock()
 	log.Debug().Str("key", key).Str("set", "disk").Str("mode", "X").Msg("Locked")
 	return func() {
 		log.Debug().Str("key", key).Str("set", "disk").Str("mode", "X").Msg("Unlocking")
-		lock.RUnlock()
+		lock.Unlock()
 	}
 }
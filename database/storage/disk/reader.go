@@ -0,0 +1,127 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// BlockReader decodes blocks of a page file one by one, without loading the whole body.
+// The file is locked in shared mode until Close is called.
+type BlockReader struct {
+	header   page.PageHeader
+	fd       *os.File
+	reader   *bufio.Reader
+	position uint32
+	unlock   UnlockFunc
+}
+
+// OpenBlockReader opens the page file of the set, positioned at the first block with a TimestampOffset
+// not less than fromOffset. A reader of a page that does not exist yields no blocks.
+func (d *Disk) OpenBlockReader(set page.CandleSet, fromOffset uint32) (*BlockReader, error) {
+	key := set.UniqueKey()
+	unlock := d.lockS(key)
+
+	f, err := os.Open(d.filePath.FileFromSet(set))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &BlockReader{unlock: unlock}, nil
+		}
+		unlock()
+		return nil, errors.Wrapf(err, "block reader open fail (key '%s')", key)
+	}
+	result := BlockReader{fd: f, unlock: unlock}
+	if err := result.header.Read(0, f); err != nil {
+		result.Close()
+		return nil, errors.Wrapf(err, "block reader header read fail (key '%s')", key)
+	}
+	result.position, _ = result.header.Index.DayBounds(int(fromOffset/86400), result.header.Count)
+	if _, err := f.Seek(page.DATA_OFFSET+int64(result.position)*int64(page.BLOCK_WIDTH), io.SeekStart); err != nil {
+		result.Close()
+		return nil, errors.Wrapf(err, "block reader seek fail (key '%s')", key)
+	}
+	result.reader = bufio.NewReader(f)
+
+	for {
+		block, ok, err := result.Peek()
+		if err != nil {
+			result.Close()
+			return nil, errors.Wrapf(err, "block reader read fail (key '%s')", key)
+		}
+		if !ok || block.TimestampOffset >= fromOffset {
+			break
+		}
+		result.Next()
+	}
+	return &result, nil
+}
+
+// Peek decodes the next block without advancing the reader.
+func (b *BlockReader) Peek() (block page.PageBodyBlock, ok bool, err error) {
+	if b.reader == nil || b.position >= b.header.Count {
+		return
+	}
+	blockBin, err := b.reader.Peek(page.BLOCK_WIDTH)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read block %d", b.position)
+		return
+	}
+	if err = block.Read(0, bytes.NewReader(blockBin)); err != nil {
+		return
+	}
+	block.SetYear(b.header.Year)
+	ok = true
+	return
+}
+
+// Next decodes the next block and advances the reader.
+func (b *BlockReader) Next() (block page.PageBodyBlock, ok bool, err error) {
+	block, ok, err = b.Peek()
+	if !ok || err != nil {
+		return
+	}
+	if _, err = b.reader.Discard(page.BLOCK_WIDTH); err != nil {
+		ok = false
+		return
+	}
+	b.position++
+	return
+}
+
+func (b *BlockReader) Close() error {
+	var err error
+	if b.fd != nil {
+		err = b.fd.Close()
+		b.fd = nil
+	}
+	b.reader = nil
+	b.unlock()
+	b.unlock = func() {}
+	return err
+}
+
+// ReadBlocks decodes up to n blocks of the page file, starting from the first block with a TimestampOffset
+// not less than fromOffset. The file is locked only while reading.
+func (d *Disk) ReadBlocks(set page.CandleSet, fromOffset uint32, n int) (page.PageBodyBlockList, error) {
+	reader, err := d.OpenBlockReader(set, fromOffset)
+	if err != nil {
+		return page.PageBodyBlockList{}, err
+	}
+	defer reader.Close()
+	result := make(page.PageBodyBlockList, 0, n)
+	for len(result) < n {
+		block, ok, err := reader.Next()
+		if err != nil {
+			return page.PageBodyBlockList{}, errors.Wrapf(err, "block read fail (key '%s')", set.UniqueKey())
+		}
+		if !ok {
+			break
+		}
+		result = append(result, block)
+	}
+	return result, nil
+}
@@ -3,17 +3,21 @@ package disk
 import (
 	"fmt"
 	"path"
+	"strconv"
+	"strings"
 
 	"github.com/jungnoh/mora/database/util"
 	"github.com/jungnoh/mora/page"
 )
 
+const pageFileSuffix string = ".ysf"
+
 type filePathResolver struct {
 	config *util.Config
 }
 
 func (f filePathResolver) buildFile(marketCode, code string, length uint32, year uint16) string {
-	return path.Join(f.config.Directory, fmt.Sprintf("%s/%d/%s/%05d.ysf", marketCode, length, code, year))
+	return path.Join(f.config.Directory, fmt.Sprintf("%s/%d/%s/%05d%s", marketCode, length, code, year, pageFileSuffix))
 }
 
 func (f filePathResolver) buildFolder(marketCode, code string, length uint32) string {
@@ -39,3 +43,19 @@ func (f filePathResolver) FileFromSet(set page.CandleSet) string {
 func (f filePathResolver) FileFromHeader(header page.PageHeader) string {
 	return f.buildFile(header.MarketCode, header.Code, header.CandleLength, header.Year)
 }
+
+func (f filePathResolver) FolderFromSetWithoutYear(set page.CandleSetWithoutYear) string {
+	return f.buildFolder(set.MarketCode, set.Code, set.CandleLength)
+}
+
+// YearFromFilename parses the year from a page filename, returning false if it's not a page file.
+func (f filePathResolver) YearFromFilename(name string) (uint16, bool) {
+	if !strings.HasSuffix(name, pageFileSuffix) {
+		return 0, false
+	}
+	year, err := strconv.ParseUint(strings.TrimSuffix(name, pageFileSuffix), 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(year), true
+}
@@ -0,0 +1,93 @@
+package disk
+
+import (
+	"bytes"
+	"os"
+	"sort"
+
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// SearchBlock looks up a block by its TimestampOffset from the page file.
+// Only the header and blocks of a single day are read, using the page index to narrow down the search.
+func (d *Disk) SearchBlock(set page.CandleSet, offset uint32, mode page.SearchMode) (block page.PageBodyBlock, found bool, err error) {
+	key := set.UniqueKey()
+	unlock := d.lockS(key)
+	defer unlock()
+
+	f, err := os.Open(d.filePath.FileFromSet(set))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return page.PageBodyBlock{}, false, nil
+		}
+		return page.PageBodyBlock{}, false, errors.Wrapf(err, "search fail (key '%s')", key)
+	}
+	defer f.Close()
+	header := page.PageHeader{}
+	if err := header.Read(0, f); err != nil {
+		return page.PageBodyBlock{}, false, errors.Wrapf(err, "search fail (key '%s')", key)
+	}
+
+	if mode == page.SearchAtOrBefore {
+		position, err := searchFile(f, header, offset+1)
+		if err != nil {
+			return page.PageBodyBlock{}, false, errors.Wrapf(err, "search fail (key '%s')", key)
+		}
+		if position == 0 {
+			return page.PageBodyBlock{}, false, nil
+		}
+		block, err = readBlockAt(f, header, position-1)
+		if err != nil {
+			return page.PageBodyBlock{}, false, errors.Wrapf(err, "search fail (key '%s')", key)
+		}
+		return block, true, nil
+	}
+
+	position, err := searchFile(f, header, offset)
+	if err != nil {
+		return page.PageBodyBlock{}, false, errors.Wrapf(err, "search fail (key '%s')", key)
+	}
+	if position >= header.Count {
+		return page.PageBodyBlock{}, false, nil
+	}
+	block, err = readBlockAt(f, header, position)
+	if err != nil {
+		return page.PageBodyBlock{}, false, errors.Wrapf(err, "search fail (key '%s')", key)
+	}
+	return block, block.TimestampOffset == offset, nil
+}
+
+// searchFile returns the position of the first block whose TimestampOffset is not less than offset.
+func searchFile(f *os.File, header page.PageHeader, offset uint32) (uint32, error) {
+	start, end := header.Index.DayBounds(int(offset/86400), header.Count)
+	var searchErr error
+	position := sort.Search(int(end-start), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		block, err := readBlockAt(f, header, start+uint32(i))
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return block.TimestampOffset >= offset
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+	return start + uint32(position), nil
+}
+
+func readBlockAt(f *os.File, header page.PageHeader, position uint32) (page.PageBodyBlock, error) {
+	blockBin := make([]byte, page.BLOCK_WIDTH)
+	if _, err := f.ReadAt(blockBin, page.DATA_OFFSET+int64(position)*int64(page.BLOCK_WIDTH)); err != nil {
+		return page.PageBodyBlock{}, errors.Wrapf(err, "failed to read block %d", position)
+	}
+	block := page.PageBodyBlock{}
+	if err := block.Read(0, bytes.NewReader(blockBin)); err != nil {
+		return page.PageBodyBlock{}, errors.Wrapf(err, "failed to read block %d", position)
+	}
+	block.SetYear(header.Year)
+	return block, nil
+}
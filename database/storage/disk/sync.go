@@ -0,0 +1,55 @@
+package disk
+
+import (
+	"os"
+	"path"
+
+	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+// Sync syncs page and adjustment files of the sets along with the folders containing them,
+// so files written or deleted so far survive power failure. Files which do not exist are skipped.
+func (d *Disk) Sync(sets []page.CandleSet, adjustmentSets []page.CandleSetWithoutYear) error {
+	files := make([]string, 0, len(sets)+len(adjustmentSets))
+	for _, set := range sets {
+		files = append(files, d.filePath.FileFromSet(set))
+	}
+	for _, set := range adjustmentSets {
+		files = append(files, path.Join(d.filePath.FolderFromSetWithoutYear(set), adjustmentFileName))
+	}
+
+	root := path.Clean(d.filePath.config.Directory)
+	folders := make(map[string]bool)
+	for _, file := range files {
+		if err := syncFile(file); err != nil {
+			return errors.Wrapf(err, "failed to sync '%s'", file)
+		}
+		// Folders of deleted files may be removed too, so the nearest existing parent has to be synced
+		for folder := path.Dir(file); len(folder) >= len(root); folder = path.Dir(folder) {
+			folders[folder] = true
+		}
+	}
+
+	d.dirLock.RLock()
+	defer d.dirLock.RUnlock()
+	for folder := range folders {
+		if err := util.SyncDirectory(folder); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to sync folder '%s'", folder)
+		}
+	}
+	return nil
+}
+
+func syncFile(file string) error {
+	f, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,50 @@
+package disk
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/page"
+)
+
+func testPage(t *testing.T, set page.CandleSet) page.Page {
+	t.Helper()
+	p := page.NewPage(set)
+	candle := common.Candle{Timestamp: time.Date(int(set.Year), 3, 1, 0, 0, 0, 0, time.UTC)}
+	if err := p.Add(common.CandleList{candle}, page.ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSyncWrittenAndDeleted(t *testing.T) {
+	d := NewDisk(&util.Config{Directory: t.TempDir()})
+	set := page.CandleSet{Year: 2022, CandleSetWithoutYear: page.CandleSetWithoutYear{MarketCode: "X", Code: "A", CandleLength: 60}}
+	if err := d.Write(testPage(t, set)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteAdjustments(set.CandleSetWithoutYear, common.AdjustmentList{}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Sync([]page.CandleSet{set}, []page.CandleSetWithoutYear{set.CandleSetWithoutYear}); err != nil {
+		t.Fatalf("failed to sync written files: %v", err)
+	}
+
+	// Syncing deleted files, whose folders are removed as well, syncs the remaining parents
+	if err := os.Remove(path.Join(d.filePath.FolderFromSet(set), adjustmentFileName)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(set); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(d.filePath.FolderFromSet(set)); !os.IsNotExist(err) {
+		t.Fatalf("expected the folder to be removed, got %v", err)
+	}
+	if err := d.Sync([]page.CandleSet{set}, []page.CandleSetWithoutYear{set.CandleSetWithoutYear}); err != nil {
+		t.Fatalf("failed to sync deleted files: %v", err)
+	}
+}
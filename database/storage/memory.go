@@ -30,13 +30,17 @@ func (s *Storage) EvictMemory(reason MemoryEvictionReason) MemoryEvictionResult
 			return
 		}
 
-		shouldEvict = hitCount <= thresholdHitCount
+		if s.isPinned(content.Header.ToCandleSet()) {
+			return
+		}
+		// Empty pages, such as dropped ones, are always evicted
+		shouldEvict = hitCount <= thresholdHitCount || content.Header.Count == 0
 		if shouldEvict {
 			evictedCount++
 			result.EvictedCount++
 		}
 		if shouldEvict && dirty {
-			if evictErr := s.evictPage(content); err != nil {
+			if evictErr := s.evictPage(content); evictErr != nil {
 				err = errors.Wrap(evictErr, "failed to write page to disk")
 			}
 		}
@@ -55,7 +59,10 @@ func (s *Storage) evictPage(content *page.Page) error {
 	if loadHeaderErr != nil {
 		return errors.Wrap(loadHeaderErr, "failed to load disk header")
 	}
-	if exists && header.LastTxId >= content.Header.LastTxId {
+	if exists && header.LastSeq >= content.Header.LastSeq {
+		return nil
+	}
+	if !exists && content.Header.Count == 0 {
 		return nil
 	}
 	if err := s.diskStore(set, content); err != nil {
@@ -64,6 +71,59 @@ func (s *Storage) evictPage(content *page.Page) error {
 	return nil
 }
 
+// evictDropped evicts pages emptied by drops, instead of waiting for the eviction policy.
+// The transaction is already committed, so failures are only logged and the pages are left to the eviction policy.
+func (s *Storage) evictDropped(sets []page.CandleSet) {
+	for _, set := range sets {
+		if s.isPinned(set) {
+			continue
+		}
+		_, err := s.memory.Evict(set, func(dirty bool, content *page.Page) (bool, error) {
+			// Pages filled again after the drop are left to the eviction policy
+			if content.Header.Count > 0 {
+				return false, nil
+			}
+			if dirty {
+				if err := s.evictPage(content); err != nil {
+					return false, errors.Wrap(err, "failed to write page to disk")
+				}
+			}
+			return true, nil
+		})
+		if err != nil {
+			log.Warn().Err(err).Str("key", set.UniqueKey()).Msg("Failed to evict dropped page")
+		}
+	}
+}
+
+// pin keeps pages in memory until the WAL is flushed past seq.
+// Replaying a rename reads its source page on disk, so the emptied source page should not be written back before then.
+func (s *Storage) pin(sets []page.CandleSet, seq uint64) {
+	s.pinLock.Lock()
+	defer s.pinLock.Unlock()
+	for _, set := range sets {
+		key := set.UniqueKey()
+		if s.pins[key] < seq {
+			s.pins[key] = seq
+		}
+	}
+}
+
+func (s *Storage) isPinned(set page.CandleSet) bool {
+	s.pinLock.Lock()
+	defer s.pinLock.Unlock()
+	key := set.UniqueKey()
+	seq, ok := s.pins[key]
+	if !ok {
+		return false
+	}
+	if seq <= s.wal.FlushedSeq() {
+		delete(s.pins, key)
+		return false
+	}
+	return true
+}
+
 func (s *Storage) runPeriodicalEviction() {
 	ticker := time.NewTicker(time.Duration(s.config.EvictionInterval) * time.Second)
 	for {
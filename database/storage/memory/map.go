@@ -32,6 +32,7 @@ func (p *pageMap) AddIfNew(set common.UniqueKeyable, content *page.Page) (added
 	}
 	copied := content.Copy()
 	loadedPage, loaded := p.data.LoadOrStore(set.UniqueKey(), &memoryPage{
+		set:     copied.Header.ToCandleSet(),
 		content: &copied,
 	})
 	added = !loaded
@@ -45,6 +46,7 @@ func (p *pageMap) AddIfNew(set common.UniqueKeyable, content *page.Page) (added
 func (p *pageMap) InitIfNew(set page.CandleSet) (added bool) {
 	newPage := page.NewPage(set)
 	_, loaded := p.data.LoadOrStore(set.UniqueKey(), &memoryPage{
+		set:     set,
 		content: &newPage,
 	})
 	added = !loaded
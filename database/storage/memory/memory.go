@@ -22,8 +22,12 @@ func (m *Memory) HasPage(set common.UniqueKeyable) bool {
 	return m.data.Has(set)
 }
 
-func (m *Memory) StartWrite(txId uint64, set common.UniqueKeyable) MemoryWriter {
-	page, _ := m.data.Get(set)
+// StartWrite locks the page for writing, returning false if the page is not in memory.
+func (m *Memory) StartWrite(txId uint64, set common.UniqueKeyable) (writer MemoryWriter, ok bool) {
+	page, ok := m.data.Get(set)
+	if !ok {
+		return MemoryWriter{}, false
+	}
 	return newMemoryWriter(txId, page)
 }
 
@@ -38,9 +42,7 @@ func (m *Memory) Read(txId uint64, set common.UniqueKeyable) (reader MemoryReade
 		ok = false
 		return
 	}
-	reader = newMemoryReader(txId, page)
-	ok = true
-	return
+	return newMemoryReader(txId, page)
 }
 
 func (m *Memory) Init(set page.CandleSet) {
@@ -73,12 +75,34 @@ func (m *Memory) RangeForEviction(fn EvictionFunc) {
 			return false
 		}
 		if shouldEvict {
+			pg.evicted = true
 			m.data.Delete(pg.content)
 		}
 		return !quit
 	})
 }
 
+// Evict removes the page of the set from memory if fn returns true, returning if the page was removed.
+// Like RangeForEviction, fn should write back the page if needed.
+func (m *Memory) Evict(set common.UniqueKeyable, fn func(dirty bool, content *page.Page) (shouldEvict bool, err error)) (bool, error) {
+	pg, ok := m.data.Get(set)
+	if !ok {
+		return false, nil
+	}
+	unlock := pg.lockForFlush()
+	defer unlock()
+	if pg.evicted {
+		return false, nil
+	}
+	shouldEvict, err := fn(pg.dirty, pg.content)
+	if err != nil || !shouldEvict {
+		return false, err
+	}
+	pg.evicted = true
+	m.data.Delete(pg.content)
+	return true, nil
+}
+
 func (m *Memory) StatsForEviction(maxPages int) (pageCount int, thresholdHitCount int) {
 	h := make(MaxHeap, 0)
 	heap.Init(&h)
@@ -99,3 +123,16 @@ func (m *Memory) StatsForEviction(maxPages int) (pageCount int, thresholdHitCoun
 	}
 	return
 }
+
+// Sets lists sets of resident pages holding candles, which match the filter.
+// Pages currently locked for writing are included as they may hold candles after commit.
+func (m *Memory) Sets(filter func(set page.CandleSet) bool) []page.CandleSet {
+	result := make([]page.CandleSet, 0)
+	m.data.Range(func(pg *memoryPage) bool {
+		if filter(pg.set) && pg.holdsCandles() {
+			result = append(result, pg.set)
+		}
+		return true
+	})
+	return result
+}
@@ -11,10 +11,14 @@ import (
 type UnlockFunc func()
 
 type memoryPage struct {
+	set        page.CandleSet
 	accessLock sync.RWMutex
 	dirty      bool
 	hitCount   int
 	content    *page.Page
+	// evicted is set when the page is removed from memory.
+	// Transactions which got the page before its removal should load it again after locking.
+	evicted bool
 }
 
 func (d *memoryPage) contentKey() string {
@@ -87,3 +91,13 @@ func (d *memoryPage) lockForFlush() UnlockFunc {
 		d.accessLock.Unlock()
 	}
 }
+
+// holdsCandles returns if the page has any candles.
+// Pages locked for writing are assumed to hold candles, not to wait for the writer.
+func (d *memoryPage) holdsCandles() bool {
+	if !d.accessLock.TryRLock() {
+		return true
+	}
+	defer d.accessLock.RUnlock()
+	return d.content != nil && d.content.Header.Count > 0
+}
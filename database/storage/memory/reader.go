@@ -7,13 +7,18 @@ type MemoryReader struct {
 	unlockFn UnlockFunc
 }
 
-func newMemoryReader(txId uint64, ptr *memoryPage) MemoryReader {
+// newMemoryReader locks the page for reading, returning false if the page was evicted while waiting for the lock.
+func newMemoryReader(txId uint64, ptr *memoryPage) (MemoryReader, bool) {
 	unlock := ptr.lockS(txId)
+	if ptr.evicted {
+		unlock()
+		return MemoryReader{}, false
+	}
 	r := MemoryReader{
 		pg:       ptr,
 		unlockFn: unlock,
 	}
-	return r
+	return r, true
 }
 
 func (r *MemoryReader) Get() *page.Page {
@@ -1,26 +1,41 @@
 package memory
 
-import "github.com/jungnoh/mora/page"
+import (
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/page"
+)
 
+// MemoryWriter holds a page locked for writing. Changes are made to a copy of the page, taken on the first change,
+// except for UpdateLast which changes the page in place and keeps what is needed to undo it.
 type MemoryWriter struct {
 	original *memoryPage
 	temp     *page.Page
+	undo     *writerUndo
 	txId     uint64
 	unlockFn UnlockFunc
 }
 
-func newMemoryWriter(txId uint64, ptr *memoryPage) MemoryWriter {
+// writerUndo holds the parts of the page changed in place. Only the last block and blocks after it are changed.
+type writerUndo struct {
+	header  page.PageHeader
+	length  int
+	last    page.PageBodyBlock
+	hasLast bool
+}
+
+// newMemoryWriter locks the page for writing, returning false if the page was evicted while waiting for the lock.
+func newMemoryWriter(txId uint64, ptr *memoryPage) (MemoryWriter, bool) {
 	unlock := ptr.lockX(txId)
+	if ptr.evicted {
+		unlock()
+		return MemoryWriter{}, false
+	}
 	w := MemoryWriter{
 		original: ptr,
 		txId:     txId,
 		unlockFn: unlock,
 	}
-	if ptr.content != nil {
-		copied := ptr.content.Copy()
-		w.temp = &copied
-	}
-	return w
+	return w, true
 }
 
 func (m *MemoryWriter) unlock() {
@@ -28,21 +43,90 @@ func (m *MemoryWriter) unlock() {
 	m.unlockFn = func() {}
 	m.original = nil
 	m.temp = nil
+	m.undo = nil
+}
+
+// Content returns the page with changes made so far, which should not be changed.
+func (m *MemoryWriter) Content() *page.Page {
+	if m.temp != nil {
+		return m.temp
+	}
+	return m.original.content
 }
 
+// WritableContent returns a copy of the page to change, which replaces the page on commit.
 func (m *MemoryWriter) WritableContent() *page.Page {
+	if m.temp == nil {
+		copied := m.original.content.Copy()
+		m.temp = &copied
+		m.revertInPlace()
+	}
 	return m.temp
 }
 
+// UpdateLast applies Page.UpdateLast. The page is changed in place unless it was already copied.
+func (m *MemoryWriter) UpdateLast(offset uint32, update common.CandleUpdate) error {
+	if m.temp != nil {
+		return m.temp.UpdateLast(offset, update)
+	}
+	content := m.original.content
+	if m.undo == nil {
+		undo := &writerUndo{header: content.Header.Copy(), length: len(content.Body)}
+		if len(content.Body) > 0 {
+			undo.last = content.Body[len(content.Body)-1]
+			undo.hasLast = true
+		}
+		m.undo = undo
+	}
+	return content.UpdateLast(offset, update)
+}
+
+// revertInPlace undoes changes made in place by UpdateLast.
+func (m *MemoryWriter) revertInPlace() {
+	if m.undo == nil {
+		return
+	}
+	content := m.original.content
+	content.Header = m.undo.header
+	content.Body = content.Body[:m.undo.length]
+	if m.undo.hasLast {
+		content.Body[m.undo.length-1] = m.undo.last
+	}
+	m.undo = nil
+}
+
+// Snapshot returns a copy of the written content.
+func (m *MemoryWriter) Snapshot() page.Page {
+	return m.Content().Copy()
+}
+
+// Restore replaces the written content with a copy of a snapshot.
+func (m *MemoryWriter) Restore(snapshot page.Page) {
+	m.revertInPlace()
+	copied := snapshot.Copy()
+	m.temp = &copied
+}
+
+// Reset discards all changes, keeping the page locked.
+func (m *MemoryWriter) Reset() {
+	m.revertInPlace()
+	m.temp = nil
+}
+
 func (m *MemoryWriter) Rollback() {
+	m.revertInPlace()
 	m.unlock()
 }
 
-func (m *MemoryWriter) Commit() {
-	m.original.content.Header = m.temp.Header
-	m.original.content.Body = m.temp.Body
-	if m.original.content.Header.LastTxId < m.txId {
-		m.original.content.Header.LastTxId = m.txId
+// Commit replaces the page with the written content. seq is the commit sequence number of the transaction,
+// or 0 if nothing was logged.
+func (m *MemoryWriter) Commit(seq uint64) {
+	if m.temp != nil {
+		m.original.content.Header = m.temp.Header
+		m.original.content.Body = m.temp.Body
+	}
+	if m.original.content.Header.LastSeq < seq {
+		m.original.content.Header.LastSeq = seq
 	}
 	m.unlock()
 }
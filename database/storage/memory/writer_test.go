@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/page"
+)
+
+var testSet = page.CandleSet{Year: 2022, CandleSetWithoutYear: page.CandleSetWithoutYear{MarketCode: "TEST", Code: "A", CandleLength: 60}}
+
+func newTestPage(t *testing.T, n int) *memoryPage {
+	t.Helper()
+	content := page.NewPage(testSet)
+	candles := make(common.CandleList, 0, n)
+	for i := 0; i < n; i++ {
+		v := float64(10 + i)
+		candles = append(candles, common.Candle{
+			Timestamp:      time.Date(2022, 3, 1, 0, i, 0, 0, time.UTC),
+			TimelessCandle: common.TimelessCandle{Open: v, High: v, Low: v, Close: v, Volume: 1},
+		})
+	}
+	if err := content.Add(candles, page.ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	return &memoryPage{set: testSet, content: &content}
+}
+
+func offsetOf(minute int) uint32 {
+	return uint32(time.Date(2022, 3, 1, 0, minute, 0, 0, time.UTC).Unix() - common.GetStartOfYearTimestamp(2022))
+}
+
+func closeUpdate(v float64) common.CandleUpdate {
+	return common.CandleUpdate{Fields: common.UpdateClose, Close: v}
+}
+
+func expectPage(t *testing.T, got *page.Page, expected page.Page) {
+	t.Helper()
+	if got.Header.Count != expected.Header.Count || got.Header.EndOffset != expected.Header.EndOffset || len(got.Body) != len(expected.Body) {
+		t.Fatalf("expected %d candles until %d, got %d until %d", expected.Header.Count, expected.Header.EndOffset, got.Header.Count, got.Header.EndOffset)
+	}
+	for i := range expected.Body {
+		if got.Body[i] != expected.Body[i] {
+			t.Fatalf("block %d: expected %+v, got %+v", i, expected.Body[i], got.Body[i])
+		}
+	}
+	for i := range expected.Header.Index {
+		if got.Header.Index[i] != expected.Header.Index[i] {
+			t.Fatalf("index %d: expected %d, got %d", i, expected.Header.Index[i], got.Header.Index[i])
+		}
+	}
+}
+
+func TestWriterUpdateLastInPlace(t *testing.T) {
+	pg := newTestPage(t, 3)
+	before := pg.content.Copy()
+
+	w, _ := newMemoryWriter(1, pg)
+	if err := w.UpdateLast(offsetOf(2), closeUpdate(30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.UpdateLast(offsetOf(3), closeUpdate(40)); err != nil {
+		t.Fatal(err)
+	}
+	if w.temp != nil {
+		t.Fatal("expected the page not to be copied")
+	}
+	if got := w.Content(); got.Header.Count != 4 || got.Body[2].Close != 30 || got.Body[3].Close != 40 {
+		t.Fatalf("unexpected content %+v", got.Body)
+	}
+
+	w.Rollback()
+	expectPage(t, pg.content, before)
+}
+
+func TestWriterUpdateLastCommit(t *testing.T) {
+	pg := newTestPage(t, 3)
+	w, _ := newMemoryWriter(1, pg)
+	if err := w.UpdateLast(offsetOf(3), closeUpdate(40)); err != nil {
+		t.Fatal(err)
+	}
+	w.Commit(7)
+	if pg.content.Header.Count != 4 || pg.content.Body[3].Close != 40 || pg.content.Header.LastSeq != 7 {
+		t.Fatalf("unexpected page %+v", pg.content.Header)
+	}
+}
+
+func TestWriterCopyAfterUpdateLast(t *testing.T) {
+	pg := newTestPage(t, 3)
+	before := pg.content.Copy()
+
+	w, _ := newMemoryWriter(1, pg)
+	if err := w.UpdateLast(offsetOf(3), closeUpdate(40)); err != nil {
+		t.Fatal(err)
+	}
+	// Copying moves the change to the copy, leaving the page as it was
+	writable := w.WritableContent()
+	expectPage(t, pg.content, before)
+	if writable.Header.Count != 4 || writable.Body[3].Close != 40 {
+		t.Fatalf("expected the copy to have the update, got %+v", writable.Body)
+	}
+	if err := w.UpdateLast(offsetOf(3), closeUpdate(50)); err != nil {
+		t.Fatal(err)
+	}
+	expectPage(t, pg.content, before)
+
+	w.Rollback()
+	expectPage(t, pg.content, before)
+}
+
+func TestWriterRestoreAfterUpdateLast(t *testing.T) {
+	pg := newTestPage(t, 3)
+	before := pg.content.Copy()
+
+	w, _ := newMemoryWriter(1, pg)
+	if err := w.UpdateLast(offsetOf(3), closeUpdate(40)); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := w.Snapshot()
+	if err := w.UpdateLast(offsetOf(4), closeUpdate(50)); err != nil {
+		t.Fatal(err)
+	}
+	w.Restore(snapshot)
+	expectPage(t, pg.content, before)
+	expectPage(t, w.Content(), snapshot)
+
+	w.Reset()
+	expectPage(t, w.Content(), before)
+	w.Rollback()
+	expectPage(t, pg.content, before)
+}
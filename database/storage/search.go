@@ -0,0 +1,21 @@
+package storage
+
+import "github.com/jungnoh/mora/page"
+
+func (s *Storage) search(txId uint64, set page.CandleSet, offset uint32, mode page.SearchMode) (page.PageBodyBlock, bool, error) {
+	if reader, ok := s.memory.Read(txId, set); ok {
+		defer reader.Done()
+		block, found := reader.Get().Search(offset, mode)
+		return block, found, nil
+	}
+	return s.disk.SearchBlock(set, offset, mode)
+}
+
+func (s *Storage) header(txId uint64, set page.CandleSet) (page.PageHeader, error) {
+	if reader, ok := s.memory.Read(txId, set); ok {
+		defer reader.Done()
+		return reader.Get().Header, nil
+	}
+	header, _, err := s.diskLoadHeader(set)
+	return header, err
+}
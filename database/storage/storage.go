@@ -2,7 +2,9 @@ package storage
 
 import (
 	"context"
+	"sync"
 
+	"github.com/jungnoh/mora/common"
 	diskImpl "github.com/jungnoh/mora/database/storage/disk"
 	memImpl "github.com/jungnoh/mora/database/storage/memory"
 	walImpl "github.com/jungnoh/mora/database/storage/wal"
@@ -21,6 +23,12 @@ type Storage struct {
 	txLock   *util.RWMutexSet
 	loadLock *util.MutexSet
 
+	adjustmentLock sync.Mutex
+	adjustments    map[string]common.AdjustmentList
+
+	pinLock sync.Mutex
+	pins    map[string]uint64
+
 	ctx               context.Context
 	ctxCancel         context.CancelFunc
 	diskLoadChan      chan diskLoadRequest
@@ -37,6 +45,8 @@ func NewStorage(config *util.Config) *Storage {
 		loadLock:          util.NewMutexSet("load"),
 		disk:              diskImpl.NewDisk(config),
 		memory:            memImpl.Memory{},
+		adjustments:       make(map[string]common.AdjustmentList),
+		pins:              make(map[string]uint64),
 		ctx:               ctx,
 		ctxCancel:         ctxCancel,
 		diskLoadChan:      make(chan diskLoadRequest),
@@ -71,6 +81,8 @@ func (s *Storage) Access() (StorageAccessor, error) {
 		finished: false,
 		readers:  make(map[string]*memImpl.MemoryReader),
 		writers:  make(map[string]*memImpl.MemoryWriter),
+
+		adjustments: make(map[string]accessorAdjustments),
 	}
 	return accessor, nil
 }
@@ -95,23 +107,46 @@ func (s *Storage) checkAndLoad(set page.CandleSet) error {
 	return nil
 }
 
+// read locks the page for reading, loading it again if it was evicted while waiting for the lock.
 func (s *Storage) read(txId uint64, set page.CandleSet) (memImpl.MemoryReader, error) {
-	err := s.checkAndLoad(set)
-	if err != nil {
-		return memImpl.MemoryReader{}, nil
-	}
-	reader, ok := s.memory.Read(txId, set)
-	if !ok {
-		return memImpl.MemoryReader{}, errors.New("could not load memory page")
+	for {
+		if err := s.checkAndLoad(set); err != nil {
+			return memImpl.MemoryReader{}, errors.Wrap(err, "could not load memory page")
+		}
+		if reader, ok := s.memory.Read(txId, set); ok {
+			return reader, nil
+		}
 	}
-	return reader, nil
 }
 
+// write locks the page for writing, loading it again if it was evicted while waiting for the lock.
 func (s *Storage) write(txId uint64, set page.CandleSet) (memImpl.MemoryWriter, error) {
-	err := s.checkAndLoad(set)
+	for {
+		if err := s.checkAndLoad(set); err != nil {
+			return memImpl.MemoryWriter{}, errors.Wrap(err, "could not load memory page")
+		}
+		if writer, ok := s.memory.StartWrite(txId, set); ok {
+			return writer, nil
+		}
+	}
+}
+
+// ListSets lists all sets having candles on disk or in memory.
+// Page files without candles, which are kept when a page is emptied while evicted, are skipped.
+func (s *Storage) ListSets() ([]page.CandleSet, error) {
+	sets, err := s.disk.Sets()
 	if err != nil {
-		return memImpl.MemoryWriter{}, nil
+		return []page.CandleSet{}, err
+	}
+	result := make([]page.CandleSet, 0, len(sets))
+	for _, set := range sets {
+		header, err := s.disk.ReadHeader(set)
+		if err != nil {
+			return []page.CandleSet{}, errors.Wrapf(err, "failed to read header (key '%s')", set.UniqueKey())
+		}
+		if header.Count > 0 {
+			result = append(result, set)
+		}
 	}
-	writer := s.memory.StartWrite(txId, set)
-	return writer, nil
+	return append(result, s.memory.Sets(func(page.CandleSet) bool { return true })...), nil
 }
@@ -1,5 +1,17 @@
 package storage
 
+import walImpl "github.com/jungnoh/mora/database/storage/wal"
+
 func (s *Storage) FlushWal() {
 	s.wal.Flush()
 }
+
+// RecoveryReport describes the logs left by a previous run, which were replayed on startup.
+func (s *Storage) RecoveryReport() walImpl.RecoveryReport {
+	return s.wal.RecoveryReport()
+}
+
+// GroupCommitStats describes batches of commits synced together in the commit durability mode.
+func (s *Storage) GroupCommitStats() walImpl.GroupCommitStats {
+	return s.wal.GroupCommitStats()
+}
@@ -68,6 +68,21 @@ func (w *WalCounter) Next() (uint64, error) {
 	return nextValue, nil
 }
 
+// EnsureAtLeast raises the counter to value, so ids found in existing logs are not reused.
+func (w *WalCounter) EnsureAtLeast(value uint64) error {
+	w.accessLock.Lock()
+	defer w.accessLock.Unlock()
+
+	if w.counter >= value {
+		return nil
+	}
+	if err := w.writeFile(value); err != nil {
+		return err
+	}
+	w.counter = value
+	return nil
+}
+
 func (w *WalCounter) readFile() (uint64, error) {
 	if _, err := w.fd.Seek(0, io.SeekStart); err != nil {
 		return 0, err
@@ -1,24 +1,57 @@
 package wal
 
 import (
+	"encoding/binary"
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/jungnoh/mora/database/command"
 	"github.com/pkg/errors"
 )
 
+// Logs start with a header of magic(4) | version(4), followed by records.
+// Logs without the header were written before records had magic and checksums.
+const logFileMagic uint32 = 0x474f4c4d
+const logFileVersion uint32 = 1
+const logFileHeaderSize = 8
+
+// ErrLogFailed is returned by a log that failed to sync. Records written before the failure may or may not
+// be on disk, so nothing more is written to the log.
+var ErrLogFailed = errors.New("log failed to sync")
+
+// syncFile syncs a log to disk. Tests replace it to inject sync failures.
+var syncFile = (*os.File).Sync
+
+// writeLogFileHeader writes the header of a new log.
+func writeLogFileHeader(w io.Writer) error {
+	header := make([]byte, logFileHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:4], logFileMagic)
+	binary.LittleEndian.PutUint32(header[4:8], logFileVersion)
+	_, err := w.Write(header)
+	return err
+}
+
 type WalWriteFile struct {
 	fd       *os.File
 	filename string
 	fileLock sync.Mutex
+	// dirty is set if records were written after the last sync
+	dirty bool
+	// failed is set once a sync fails, after which the log refuses writes and syncs
+	failed  bool
+	size    int64
+	created time.Time
 }
 
+// NewWalWriteFile wraps a log created by WalFileResolver.NewFile, which already has its header written.
 func NewWalWriteFile(fd *os.File, filename string) WalWriteFile {
 	return WalWriteFile{
 		fd:       fd,
 		filename: filename,
+		size:     logFileHeaderSize,
+		created:  time.Now(),
 	}
 }
 
@@ -37,6 +70,9 @@ func (w *WalWriteFile) Open(file string) error {
 func (w *WalWriteFile) Write(e command.Command) error {
 	w.fileLock.Lock()
 	defer w.fileLock.Unlock()
+	if w.failed {
+		return errors.Wrapf(ErrLogFailed, "log '%s'", w.filename)
+	}
 
 	if _, err := w.fd.Seek(0, io.SeekEnd); err != nil {
 		return errors.Wrap(err, "failed to seek wal page")
@@ -44,9 +80,88 @@ func (w *WalWriteFile) Write(e command.Command) error {
 	if err := e.Write(w.fd); err != nil {
 		return errors.Wrap(err, "failed to seek wal page")
 	}
+	w.dirty = true
+	w.size += int64(e.BinarySize())
 	return nil
 }
 
+// WriteRaw appends encoded records with a single write.
+func (w *WalWriteFile) WriteRaw(records []byte) error {
+	w.fileLock.Lock()
+	defer w.fileLock.Unlock()
+	if w.failed {
+		return errors.Wrapf(ErrLogFailed, "log '%s'", w.filename)
+	}
+
+	if _, err := w.fd.Seek(0, io.SeekEnd); err != nil {
+		return errors.Wrap(err, "failed to seek wal page")
+	}
+	if _, err := w.fd.Write(records); err != nil {
+		return errors.Wrap(err, "failed to write wal page")
+	}
+	w.dirty = true
+	w.size += int64(len(records))
+	return nil
+}
+
+// Sync syncs records written so far to disk.
+// A failed sync is not retried, as a later sync may succeed without the records being written.
+func (w *WalWriteFile) Sync() error {
+	w.fileLock.Lock()
+	defer w.fileLock.Unlock()
+	if w.failed {
+		return errors.Wrapf(ErrLogFailed, "log '%s'", w.filename)
+	}
+	if w.fd == nil || !w.dirty {
+		return nil
+	}
+	if err := syncFile(w.fd); err != nil {
+		w.failed = true
+		return errors.Wrapf(err, "failed to sync log '%s'", w.filename)
+	}
+	w.dirty = false
+	return nil
+}
+
+// Truncate removes records after size from a failed log, so records which were reported as failed
+// are not replayed if they reach the disk anyway.
+func (w *WalWriteFile) Truncate(size int64) error {
+	w.fileLock.Lock()
+	defer w.fileLock.Unlock()
+	if err := w.fd.Truncate(size); err != nil {
+		return errors.Wrapf(err, "failed to truncate log '%s'", w.filename)
+	}
+	w.size = size
+	if err := syncFile(w.fd); err != nil {
+		return errors.Wrapf(err, "failed to sync truncated log '%s'", w.filename)
+	}
+	return nil
+}
+
+// Failed returns whether the log failed to sync.
+func (w *WalWriteFile) Failed() bool {
+	w.fileLock.Lock()
+	defer w.fileLock.Unlock()
+	return w.failed
+}
+
+// Size returns the number of bytes written to the log.
+func (w *WalWriteFile) Size() int64 {
+	w.fileLock.Lock()
+	defer w.fileLock.Unlock()
+	return w.size
+}
+
+// Empty returns whether no records were written to the log.
+func (w *WalWriteFile) Empty() bool {
+	return w.Size() <= logFileHeaderSize
+}
+
+// Age returns the time since the log was created.
+func (w *WalWriteFile) Age() time.Duration {
+	return time.Since(w.created)
+}
+
 func (w *WalWriteFile) Close() error {
 	w.fileLock.Lock()
 	defer w.fileLock.Unlock()
@@ -6,6 +6,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/jungnoh/mora/common"
 	"github.com/jungnoh/mora/database/command"
 	"github.com/jungnoh/mora/database/storage/disk"
 	"github.com/jungnoh/mora/database/util"
@@ -15,17 +16,36 @@ import (
 
 type flusherTransaction struct {
 	TxId      uint64
+	Seq       uint64
 	Committed bool
 	Entries   []command.Command
 }
 
 func (f *flusherTransaction) AddEntry(e command.Command) {
+	if rollback, ok := e.Content.(*command.RollbackToCommand); ok {
+		f.rollbackTo(rollback.Name)
+		return
+	}
 	f.Entries = append(f.Entries, e)
 }
 
+// rollbackTo discards entries after the last savepoint with the name, keeping the savepoint.
+func (f *flusherTransaction) rollbackTo(name string) {
+	for i := len(f.Entries) - 1; i >= 0; i-- {
+		if savepoint, ok := f.Entries[i].Content.(*command.SavepointCommand); ok && savepoint.Name == name {
+			f.Entries = f.Entries[:i+1]
+			return
+		}
+	}
+	log.Warn().Uint64("tx", f.TxId).Str("savepoint", name).Msg("Rollback to unknown savepoint in WAL, ignoring")
+}
+
+// flusherAccessor replays a committed transaction. seq is its commit sequence number,
+// which is compared against pages on disk as transaction ids do not follow commit order.
 type flusherAccessor struct {
 	f    *WalFlusher
 	txId uint64
+	seq  uint64
 }
 
 func (a *flusherAccessor) AcquirePage(set page.CandleSet, exclusive bool) (func(), error) {
@@ -43,15 +63,61 @@ func (a *flusherAccessor) AcquirePage(set page.CandleSet, exclusive bool) (func(
 			loadedPage = page.NewPage(set)
 		}
 		a.f.loadedPages[pageKey] = &loadedPage
+		a.f.diskSeqs[pageKey] = loadedPage.Header.LastSeq
 	}
-	if a.f.loadedPages[pageKey].Header.LastTxId < a.txId {
-		a.f.loadedPages[pageKey].Header.LastTxId = a.txId
+	if a.f.loadedPages[pageKey].Header.LastSeq < a.seq {
+		a.f.loadedPages[pageKey].Header.LastSeq = a.seq
 	}
 	return func() {}, nil
 }
 
 func (a *flusherAccessor) GetPage(set page.CandleSet, exclusive bool) (*page.Page, error) {
-	return a.f.loadedPages[set.UniqueKey()], nil
+	pageKey := set.UniqueKey()
+	// Pages written back to disk by memory eviction already contain this transaction.
+	// Replaying it would not be idempotent for commands such as deletes, so changes go to a scratch copy.
+	if a.seq <= a.f.diskSeqs[pageKey] {
+		scratch := a.f.loadedPages[pageKey].Copy()
+		return &scratch, nil
+	}
+	return a.f.loadedPages[pageKey], nil
+}
+
+func (a *flusherAccessor) UpdateLast(set page.CandleSet, offset uint32, update common.CandleUpdate) error {
+	content, err := a.GetPage(set, true)
+	if err != nil {
+		return err
+	}
+	return content.UpdateLast(offset, update)
+}
+
+// GetAdjustments loads adjustments of the set from disk.
+// Like pages, adjustments already containing this transaction are returned as a scratch copy.
+func (a *flusherAccessor) GetAdjustments(set page.CandleSetWithoutYear, exclusive bool) (*common.AdjustmentList, error) {
+	key := set.UniqueKey()
+	loaded, ok := a.f.loadedAdjustments[key]
+	if !ok {
+		adjustments, lastSeq, err := a.f.Disk.ReadAdjustments(set)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load adjustments with key '%s' (tx=%d)", key, a.txId)
+		}
+		loaded = &flusherAdjustments{set: set, list: adjustments, diskSeq: lastSeq}
+		a.f.loadedAdjustments[key] = loaded
+	}
+	if a.seq <= loaded.diskSeq {
+		scratch := loaded.list.Copy()
+		return &scratch, nil
+	}
+	if loaded.lastSeq < a.seq {
+		loaded.lastSeq = a.seq
+	}
+	return &loaded.list, nil
+}
+
+type flusherAdjustments struct {
+	set     page.CandleSetWithoutYear
+	list    common.AdjustmentList
+	diskSeq uint64
+	lastSeq uint64
 }
 
 type WalFlusher struct {
@@ -60,6 +126,16 @@ type WalFlusher struct {
 
 	loadedPagesLock util.MutexMap
 	loadedPages     map[string]*page.Page
+	diskSeqs        map[string]uint64
+
+	loadedAdjustments map[string]*flusherAdjustments
+
+	// renamedPages and renamedAdjustments are keys of rename sources, which are written after other changes
+	renamedPages       map[string]bool
+	renamedAdjustments map[string]bool
+
+	// Report describes the last call to FlushWal.
+	Report RecoveryReport
 }
 
 func NewWalFlusher(resolver *WalFileResolver, disk *disk.Disk) WalFlusher {
@@ -68,14 +144,26 @@ func NewWalFlusher(resolver *WalFileResolver, disk *disk.Disk) WalFlusher {
 		Disk:            disk,
 		loadedPagesLock: util.NewMutexMap(),
 		loadedPages:     make(map[string]*page.Page),
+		diskSeqs:        make(map[string]uint64),
+
+		loadedAdjustments: make(map[string]*flusherAdjustments),
+
+		renamedPages:       make(map[string]bool),
+		renamedAdjustments: make(map[string]bool),
 	}
 }
 
 func (w *WalFlusher) FlushWal(files []string) error {
+	// Pages are kept across files, as they are written to disk only after all files are processed
+	w.loadedPages = make(map[string]*page.Page)
+	w.diskSeqs = make(map[string]uint64)
+	w.loadedAdjustments = make(map[string]*flusherAdjustments)
+	w.renamedPages = make(map[string]bool)
+	w.renamedAdjustments = make(map[string]bool)
+	w.loadedPagesLock = util.NewMutexMap()
+	w.Report = RecoveryReport{Files: files, TornTails: []TornTail{}}
 	for _, file := range files {
 		log.Debug().Str("file", file).Msg("Flushing WAL log")
-		w.loadedPages = make(map[string]*page.Page)
-		w.loadedPagesLock = util.NewMutexMap()
 		if err := w.processFromDisk(file); err != nil {
 			return errors.Wrapf(err, "failed to process log: %s", file)
 		}
@@ -96,44 +184,96 @@ func (w *WalFlusher) processFromDisk(file string) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to open file")
 	}
-	reader := WalLogReader{fd: fd}
+	defer fd.Close()
+	reader, err := NewWalLogReader(fd)
+	if err != nil {
+		return err
+	}
+	if reader.legacy {
+		log.Info().Str("file", file).Msg("Reading log written before record checksums")
+	}
 	for {
 		e, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			if err := w.truncateTornTail(file, reader, err); err != nil {
+				return err
+			}
+			break
+		}
+		if e.TxID > w.Report.MaxSeq {
+			w.Report.MaxSeq = e.TxID
+		}
 		if _, ok := readResult[e.TxID]; !ok {
 			readResult[e.TxID] = &flusherTransaction{
 				TxId: e.TxID,
 			}
 		}
 		if e.Type == command.CommitCommandType {
+			seq := e.Content.(*command.CommitCommand).Seq
+			// Commits logged without a sequence number fall back to the transaction id
+			if seq == 0 {
+				seq = e.TxID
+			}
+			if seq > w.Report.MaxSeq {
+				w.Report.MaxSeq = seq
+			}
 			readResult[e.TxID].Committed = true
-			log.Debug().Uint64("tx", e.TxID).Msg("Committing log")
+			readResult[e.TxID].Seq = seq
+			log.Debug().Uint64("tx", e.TxID).Uint64("seq", seq).Msg("Committing log")
 			if err := w.flushToMemory(readResult[e.TxID]); err != nil {
 				return err
 			}
+			w.Report.CommittedTxs++
 			delete(readResult, e.TxID)
 		} else {
 			readResult[e.TxID].AddEntry(e)
 		}
 	}
 
+	// Transactions are not split across logs, so ones without a commit record were never committed
 	for _, value := range readResult {
-		if value.Committed {
-			if err := w.flushToMemory(value); err != nil {
-				return err
-			}
-		}
+		log.Debug().Uint64("tx", value.TxId).Msg("Discarding uncommitted log")
+		w.Report.DiscardedTxs++
 	}
+	return nil
+}
 
+// truncateTornTail truncates a log ending with a partially written record, which is expected if the process crashed
+// while appending. Damaged records elsewhere are reported as corruption, as committed transactions may be lost.
+func (w *WalFlusher) truncateTornTail(file string, reader *WalLogReader, readErr error) error {
+	torn, err := reader.IsTornTail(readErr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to inspect damaged record at offset %d", reader.Offset())
+	}
+	if !torn {
+		return errors.Wrapf(readErr, "corrupted WAL record in '%s' at offset %d", file, reader.Offset())
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return errors.Wrap(err, "failed to stat file")
+	}
+	if err := os.Truncate(file, reader.Offset()); err != nil {
+		return errors.Wrapf(err, "failed to truncate torn record at offset %d", reader.Offset())
+	}
+	tail := TornTail{File: file, Offset: reader.Offset(), Truncated: info.Size() - reader.Offset()}
+	log.Warn().Err(readErr).Str("file", file).Int64("offset", tail.Offset).Int64("truncated", tail.Truncated).Msg("Truncated torn WAL record")
+	w.Report.TornTails = append(w.Report.TornTails, tail)
 	return nil
 }
 
 func (w *WalFlusher) flushToMemory(tx *flusherTransaction) error {
 	for _, entry := range tx.Entries {
+		switch content := entry.Content.(type) {
+		case *command.RenameCommand:
+			w.renamedPages[content.SourceSet().UniqueKey()] = true
+		case *command.RenameAdjustmentsCommand:
+			w.renamedAdjustments[content.SourceSet().UniqueKey()] = true
+		}
 		// TODO: Skip if possible
-		if _, err := entry.Content.Execute(&flusherAccessor{f: w, txId: tx.TxId}); err != nil {
+		if _, err := entry.Content.Execute(&flusherAccessor{f: w, txId: tx.TxId, seq: tx.Seq}); err != nil {
 			return errors.Wrapf(err, "failed to persist (tx=%d)", tx.TxId)
 		}
 	}
@@ -141,10 +281,76 @@ func (w *WalFlusher) flushToMemory(tx *flusherTransaction) error {
 }
 
 func (w *WalFlusher) flushToDisk() error {
+	if err := w.writeToDisk(false); err != nil {
+		return err
+	}
+	// Replaying a rename reads its source on disk, so sources are emptied only after destinations are synced.
+	// Otherwise a crash in between would replay the rename from an emptied source.
+	if len(w.renamedPages) > 0 || len(w.renamedAdjustments) > 0 {
+		if err := w.syncToDisk(); err != nil {
+			return err
+		}
+		if err := w.writeToDisk(true); err != nil {
+			return err
+		}
+	}
+	return w.syncToDisk()
+}
+
+// writeToDisk writes loaded pages and adjustments, either the sources of renames or the others.
+func (w *WalFlusher) writeToDisk(renamed bool) error {
+	for key, adjustments := range w.loadedAdjustments {
+		if adjustments.lastSeq == 0 || w.renamedAdjustments[key] != renamed {
+			continue
+		}
+		// Like emptied pages, files of emptied adjustments are no longer needed
+		if len(adjustments.list) == 0 {
+			if err := w.Disk.DeleteAdjustmentsIfNotNewer(adjustments.set, adjustments.lastSeq); err != nil {
+				return errors.Wrapf(err, "failed to delete adjustments: key '%s'", key)
+			}
+			continue
+		}
+		if err := w.Disk.WriteAdjustments(adjustments.set, adjustments.list, adjustments.lastSeq); err != nil {
+			return errors.Wrapf(err, "failed to write adjustments: key '%s'", key)
+		}
+	}
 	for key, page := range w.loadedPages {
-		if err := w.Disk.Write(*page); err != nil {
+		if w.renamedPages[key] != renamed {
+			continue
+		}
+		// All transactions up to the flushed logs are applied, so files of emptied pages are no longer needed
+		// Pages evicted from memory while flushing contain later transactions, and are kept
+		if page.Header.Count == 0 {
+			if err := w.Disk.DeleteIfNotNewer(page.Header.ToCandleSet(), page.Header.LastSeq); err != nil {
+				return errors.Wrapf(err, "failed to delete page: key '%s'", key)
+			}
+			continue
+		}
+		if _, err := w.Disk.WriteIfNewer(*page); err != nil {
 			return errors.Wrapf(err, "failed to write page: key '%s'", key)
 		}
 	}
 	return nil
 }
+
+// syncToDisk syncs flushed pages and adjustments, as their logs are deleted afterwards.
+func (w *WalFlusher) syncToDisk() error {
+	if len(w.loadedPages) == 0 && len(w.loadedAdjustments) == 0 {
+		return nil
+	}
+	if w.FileResolver.Config.WalDurability() == util.DurabilityNone {
+		return nil
+	}
+	sets := make([]page.CandleSet, 0, len(w.loadedPages))
+	for _, page := range w.loadedPages {
+		sets = append(sets, page.Header.ToCandleSet())
+	}
+	adjustmentSets := make([]page.CandleSetWithoutYear, 0, len(w.loadedAdjustments))
+	for _, adjustments := range w.loadedAdjustments {
+		adjustmentSets = append(adjustmentSets, adjustments.set)
+	}
+	if err := w.Disk.Sync(sets, adjustmentSets); err != nil {
+		return errors.Wrap(err, "failed to sync")
+	}
+	return nil
+}
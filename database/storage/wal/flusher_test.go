@@ -0,0 +1,155 @@
+package wal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/storage/disk"
+	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/page"
+)
+
+func testFlusher(t *testing.T) (WalFlusher, *disk.Disk) {
+	t.Helper()
+	config := &util.Config{Directory: t.TempDir()}
+	d := disk.NewDisk(config)
+	return NewWalFlusher(&WalFileResolver{Config: config}, &d), &d
+}
+
+func testCandleSet(code string) page.CandleSet {
+	return page.CandleSet{Year: 2022, CandleSetWithoutYear: page.CandleSetWithoutYear{MarketCode: "X", Code: code, CandleLength: 60}}
+}
+
+func writeTestPage(t *testing.T, d *disk.Disk, set page.CandleSet, seq uint64, n int) {
+	t.Helper()
+	p := page.NewPage(set)
+	candles := make(common.CandleList, n)
+	for i := range candles {
+		candles[i] = common.Candle{Timestamp: time.Date(2022, 3, 1, 0, i, 0, 0, time.UTC)}
+	}
+	if err := p.Add(candles, page.ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	p.Header.LastSeq = seq
+	if err := d.Write(p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestPage(t *testing.T, d *disk.Disk, set page.CandleSet) page.Page {
+	t.Helper()
+	p, err := d.Read(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func renameLog(t *testing.T, from, to page.CandleSet, seq uint64) string {
+	t.Helper()
+	rename := command.NewRenameCommand(from, to.MarketCode, to.Code)
+	renameAdjustments := command.NewRenameAdjustmentsCommand(from.CandleSetWithoutYear, to.MarketCode, to.Code)
+	file, _ := writeLog(t,
+		command.NewCommand(2, &rename),
+		command.NewCommand(2, &renameAdjustments),
+		command.NewCommand(2, &command.CommitCommand{Seq: seq}),
+	)
+	return file
+}
+
+func TestFlushReplaysRenameMarker(t *testing.T) {
+	flusher, d := testFlusher(t)
+	from, to := testCandleSet("A"), testCandleSet("B")
+	writeTestPage(t, d, from, 1, 3)
+	adjustments := common.AdjustmentList{{EffectiveTime: 100, PriceFactor: 2, VolumeFactor: 1}}
+	if err := d.WriteAdjustments(from.CandleSetWithoutYear, adjustments, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := flusher.FlushWal([]string{renameLog(t, from, to, 3)}); err != nil {
+		t.Fatal(err)
+	}
+	if p := readTestPage(t, d, from); !p.IsZero() {
+		t.Errorf("expected the source page to be deleted, got %d candles", p.Header.Count)
+	}
+	if p := readTestPage(t, d, to); p.Header.Count != 3 || p.Header.Code != "B" {
+		t.Errorf("expected 3 candles moved to B, got %d in '%s'", p.Header.Count, p.Header.Code)
+	}
+	moved, _, err := d.ReadAdjustments(to.CandleSetWithoutYear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 1 || moved[0] != adjustments[0] {
+		t.Errorf("expected adjustments to be moved, got %v", moved)
+	}
+	left, _, err := d.ReadAdjustments(from.CandleSetWithoutYear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("expected source adjustments to be emptied, got %v", left)
+	}
+}
+
+func TestFlushSkipsRenameOfEvictedDestination(t *testing.T) {
+	flusher, d := testFlusher(t)
+	from, to := testCandleSet("A"), testCandleSet("B")
+	// The source is kept in memory until the flush, while the destination was evicted after the rename
+	writeTestPage(t, d, from, 1, 3)
+	writeTestPage(t, d, to, 4, 5)
+
+	if err := flusher.FlushWal([]string{renameLog(t, from, to, 3)}); err != nil {
+		t.Fatal(err)
+	}
+	if p := readTestPage(t, d, to); p.Header.Count != 5 || p.Header.LastSeq != 4 {
+		t.Errorf("expected the newer destination to be kept, got %d candles with seq %d", p.Header.Count, p.Header.LastSeq)
+	}
+	if p := readTestPage(t, d, from); !p.IsZero() {
+		t.Errorf("expected the source page to be deleted, got %d candles", p.Header.Count)
+	}
+}
+
+func TestFlushOrdersTransactionsByCommitSeq(t *testing.T) {
+	flusher, d := testFlusher(t)
+	set := testCandleSet("A")
+	// Transaction 3 committed first with seq 4, and its page was evicted
+	writeTestPage(t, d, set, 4, 3)
+
+	// Transaction 2 started earlier, but committed after it with seq 6
+	candle := common.Candle{Timestamp: time.Date(2022, 3, 1, 0, 5, 0, 0, time.UTC)}
+	insert := command.NewInsertCommand(set, common.CandleList{candle}.ToTimestampCandleList(), page.ConflictOverwrite)
+	file, _ := writeLog(t,
+		command.NewCommand(2, &insert),
+		command.NewCommand(2, &command.CommitCommand{Seq: 6}),
+	)
+	if err := flusher.FlushWal([]string{file}); err != nil {
+		t.Fatal(err)
+	}
+	if p := readTestPage(t, d, set); p.Header.Count != 4 || p.Header.LastSeq != 6 {
+		t.Errorf("expected the later commit to be applied, got %d candles with seq %d", p.Header.Count, p.Header.LastSeq)
+	}
+}
+
+func TestFlushSkipsChangesAlreadyOnDisk(t *testing.T) {
+	flusher, d := testFlusher(t)
+	set := testCandleSet("A")
+	// Candles deleted with seq 3 were inserted again with seq 5, whose log is not flushed yet
+	writeTestPage(t, d, set, 5, 3)
+
+	deleteRange := command.NewDeleteRangeCommand(set, common.TimeRange{
+		Start: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2022, 3, 1, 0, 3, 0, 0, time.UTC),
+	})
+	file, _ := writeLog(t,
+		command.NewCommand(2, &deleteRange),
+		command.NewCommand(2, &command.CommitCommand{Seq: 3}),
+	)
+	if err := flusher.FlushWal([]string{file}); err != nil {
+		t.Fatal(err)
+	}
+	if p := readTestPage(t, d, set); p.Header.Count != 3 || p.Header.LastSeq != 5 {
+		t.Errorf("expected the page on disk to be kept, got %d candles with seq %d", p.Header.Count, p.Header.LastSeq)
+	}
+}
@@ -0,0 +1,149 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jungnoh/mora/database/command"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrWalClosed = errors.New("write ahead log is closed")
+
+// GroupCommitStats describes the batches synced by group commit.
+type GroupCommitStats struct {
+	// Batches is the number of syncs done.
+	Batches uint64
+	// Commits is the number of commit records written.
+	Commits uint64
+	// LargestBatch is the largest number of commits synced at once.
+	LargestBatch int
+}
+
+// AverageBatchSize returns the average number of commits synced at once.
+func (g GroupCommitStats) AverageBatchSize() float64 {
+	if g.Batches == 0 {
+		return 0
+	}
+	return float64(g.Commits) / float64(g.Batches)
+}
+
+type groupCommitRequest struct {
+	record command.Command
+	done   chan error
+}
+
+// groupCommitter writes commit records of concurrent transactions together, so the log is synced once per batch.
+// Transactions waiting for their commit hold the current log, so the log is not rotated while a batch is written.
+type groupCommitter struct {
+	persister *WalPersister
+	maxBatch  int
+	maxWait   time.Duration
+	requests  chan groupCommitRequest
+
+	statsLock sync.Mutex
+	stats     GroupCommitStats
+}
+
+func newGroupCommitter(persister *WalPersister) *groupCommitter {
+	return &groupCommitter{
+		persister: persister,
+		maxBatch:  persister.Config.WalGroupCommitMaxBatch(),
+		maxWait:   persister.Config.WalGroupCommitMaxWait(),
+		requests:  make(chan groupCommitRequest),
+	}
+}
+
+// Commit queues the commit record, returning after it is written and synced.
+func (g *groupCommitter) Commit(ctx context.Context, record command.Command) error {
+	request := groupCommitRequest{record: record, done: make(chan error, 1)}
+	select {
+	case g.requests <- request:
+	case <-ctx.Done():
+		return ErrWalClosed
+	}
+	return <-request.done
+}
+
+func (g *groupCommitter) Stats() GroupCommitStats {
+	g.statsLock.Lock()
+	defer g.statsLock.Unlock()
+	return g.stats
+}
+
+func (g *groupCommitter) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case first := <-g.requests:
+			batch := g.collect(first)
+			err := g.writeBatch(batch)
+			for _, request := range batch {
+				request.done <- err
+			}
+		}
+	}
+}
+
+// collect adds requests queued after first to the batch, until the batch is full or maxWait has passed.
+// Without maxWait, only requests already waiting are added.
+func (g *groupCommitter) collect(first groupCommitRequest) []groupCommitRequest {
+	batch := []groupCommitRequest{first}
+	if g.maxWait <= 0 {
+		for len(batch) < g.maxBatch {
+			select {
+			case request := <-g.requests:
+				batch = append(batch, request)
+			default:
+				return batch
+			}
+		}
+		return batch
+	}
+	timer := time.NewTimer(g.maxWait)
+	defer timer.Stop()
+	for len(batch) < g.maxBatch {
+		select {
+		case request := <-g.requests:
+			batch = append(batch, request)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (g *groupCommitter) writeBatch(batch []groupCommitRequest) error {
+	buf := bytes.Buffer{}
+	for _, request := range batch {
+		if err := request.record.Write(&buf); err != nil {
+			return errors.Wrapf(err, "failed to encode commit (tx=%d)", request.record.TxID)
+		}
+	}
+	// Records of transactions committing later may be written after the batch, but they can no longer commit
+	// once the log failed, so the log is truncated back to where the batch started.
+	offset := g.persister.currentLog.Size()
+	if err := g.persister.currentLog.WriteRaw(buf.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to write commits")
+	}
+	if err := g.persister.currentLog.Sync(); err != nil {
+		if truncateErr := g.persister.currentLog.Truncate(offset); truncateErr != nil {
+			log.Error().Err(truncateErr).Msg("Failed to remove commits of a batch which failed to sync")
+		}
+		return err
+	}
+
+	g.statsLock.Lock()
+	g.stats.Batches++
+	g.stats.Commits += uint64(len(batch))
+	if len(batch) > g.stats.LargestBatch {
+		g.stats.LargestBatch = len(batch)
+	}
+	g.statsLock.Unlock()
+	log.Debug().Int("size", len(batch)).Msg("Group commit synced")
+	return nil
+}
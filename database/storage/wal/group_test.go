@@ -0,0 +1,154 @@
+package wal
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/storage/disk"
+	"github.com/jungnoh/mora/database/util"
+	"github.com/pkg/errors"
+)
+
+func testPersister(t *testing.T, config *util.Config) *WalPersister {
+	t.Helper()
+	resolver := &WalFileResolver{Config: config}
+	counter := &WalCounter{}
+	if err := counter.Open(resolver.Counter()); err != nil {
+		t.Fatal(err)
+	}
+	persister := &WalPersister{Config: config, FileResolver: resolver, Counter: counter}
+	if err := persister.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(persister.Close)
+	return persister
+}
+
+func openLog(t *testing.T, file string) *WalLogReader {
+	t.Helper()
+	fd, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fd.Close() })
+	reader, err := NewWalLogReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+// commitTx logs a transaction with a single record, returning its commit sequence number.
+func commitTx(t *testing.T, persister *WalPersister, txId uint64, record command.CommandContent) uint64 {
+	runner, err := persister.StartBuilder()
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	defer runner.Close()
+	if err := runner.Write(command.NewCommand(txId, record)); err != nil {
+		t.Error(err)
+		return 0
+	}
+	seq, err := runner.Commit(txId)
+	if err != nil {
+		t.Error(err)
+	}
+	return seq
+}
+
+func TestGroupCommitBatchesConcurrentCommits(t *testing.T) {
+	config := &util.Config{
+		Directory:           t.TempDir(),
+		Durability:          util.DurabilityCommit,
+		GroupCommitMaxBatch: 4,
+		GroupCommitMaxWait:  200,
+	}
+	persister := testPersister(t, config)
+	filename := persister.FileResolver.FullPath(persister.currentLog.filename)
+
+	const count = 8
+	seqs := make([]uint64, count)
+	wg := sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			seqs[i] = commitTx(t, persister, uint64(i+1), &command.SavepointCommand{Name: "a"})
+		}(i)
+	}
+	wg.Wait()
+
+	stats := persister.committer.Stats()
+	if stats.Commits != count || stats.LargestBatch > 4 || stats.Batches < 2 || stats.Batches == count {
+		t.Errorf("expected %d commits synced in batches of up to 4, got %+v", count, stats)
+	}
+	found := make(map[uint64]bool)
+	for _, seq := range seqs {
+		if seq == 0 || found[seq] {
+			t.Fatalf("expected distinct sequence numbers, got %v", seqs)
+		}
+		found[seq] = true
+	}
+
+	// Every commit record is written once
+	commits := 0
+	reader := openLog(t, filename)
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			break
+		}
+		if record.Type == command.CommitCommandType {
+			commits++
+		}
+	}
+	if commits != count {
+		t.Errorf("expected %d commit records, got %d", count, commits)
+	}
+}
+
+func TestGroupCommitSyncFailure(t *testing.T) {
+	config := &util.Config{Directory: t.TempDir(), Durability: util.DurabilityCommit}
+	persister := testPersister(t, config)
+	filename := persister.FileResolver.FullPath(persister.currentLog.filename)
+	commitTx(t, persister, 1, &command.SavepointCommand{Name: "a"})
+
+	syncFile = func(*os.File) error { return errors.New("injected sync failure") }
+	t.Cleanup(func() { syncFile = (*os.File).Sync })
+
+	runner, err := persister.StartBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Write(command.NewCommand(2, &command.SavepointCommand{Name: "a"})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Commit(2); err == nil {
+		t.Fatal("expected commit to fail when the log cannot be synced")
+	}
+	// The log is unusable after the failure, even if syncs would succeed again
+	syncFile = (*os.File).Sync
+	runner, err = persister.StartBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Write(command.NewCommand(3, &command.SavepointCommand{Name: "a"})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Commit(3); !errors.Is(err, ErrLogFailed) {
+		t.Fatalf("expected ErrLogFailed, got %v", err)
+	}
+
+	// Recovery applies only the transaction committed before the failure
+	d := disk.NewDisk(config)
+	flusher := NewWalFlusher(persister.FileResolver, &d)
+	if err := flusher.FlushWal([]string{filename}); err != nil {
+		t.Fatal(err)
+	}
+	if flusher.Report.CommittedTxs != 1 {
+		t.Errorf("expected 1 committed transaction, got %+v", flusher.Report)
+	}
+}
@@ -1,19 +1,21 @@
 package wal
 
 import (
+	"bytes"
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jungnoh/mora/database/command"
 	"github.com/jungnoh/mora/database/storage/disk"
+	"github.com/jungnoh/mora/database/util"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 )
 
-// TODO: Move to config
-const MAX_COMMITTED_PAGES int = 256
-
 type WalPersister struct {
+	Config       *util.Config
 	Disk         *disk.Disk
 	FileResolver *WalFileResolver
 	Counter      *WalCounter
@@ -21,77 +23,152 @@ type WalPersister struct {
 	currentLog     WalWriteFile
 	currentLogLock sync.RWMutex
 	changeLogLock  sync.Mutex
-	writtenCount   int
+	writtenCount   int64
 	rotateChan     chan string
 	flushChan      chan bool
+	committer      *groupCommitter
+	ctx            context.Context
 	ctxCancel      context.CancelFunc
 }
 
 func (w *WalPersister) Setup() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.ctx = ctx
+	w.ctxCancel = cancel
+	w.rotateChan = make(chan string, 1)
+	w.flushChan = make(chan bool, 1)
 	if err := w.RotateFile(); err != nil {
+		cancel()
 		return errors.Wrap(err, "WAL rotation failed!")
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	w.ctxCancel = cancel
-	w.flushChan = make(chan bool)
+	w.committer = newGroupCommitter(w)
 	go w.watchRotateChan(ctx)
+	go w.committer.run(ctx)
+	if w.Config.WalDurability() == util.DurabilityInterval {
+		go w.syncPeriodically(ctx)
+	}
 	return nil
 }
 
 func (w *WalPersister) Close() {
+	// Cancel first, so a pending rotation does not signal flushChan after it is closed
+	w.ctxCancel()
 	w.currentLogLock.Lock()
 	defer w.currentLogLock.Unlock()
 
+	if w.Config.WalDurability() != util.DurabilityNone {
+		if err := w.currentLog.Sync(); err != nil {
+			log.Warn().Err(err).Msg("Failed to sync WAL log on close")
+		}
+	}
 	w.currentLog.Close()
 	close(w.flushChan)
-	w.ctxCancel()
 }
 
+// StartBuilder starts logging a transaction. The log is not held until the transaction commits,
+// so an open transaction does not block rotation.
 func (w *WalPersister) StartBuilder() (PersistRunner, error) {
-	w.currentLogLock.RLock()
 	return PersistRunner{
 		persister: w,
 	}, nil
 }
 
 func (w *WalPersister) watchRotateChan(ctx context.Context) {
+	// Logs are checked at a quarter of the max age, so none outlives it by more than that
+	var ageCheck <-chan time.Time
+	if maxAge := w.Config.WalRotateAge(); maxAge > 0 {
+		ticker := time.NewTicker(maxAge / 4)
+		defer ticker.Stop()
+		ageCheck = ticker.C
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case file := <-w.rotateChan:
-			if w.currentLog.filename == file {
+			if w.currentLog.filename != file {
 				continue
 			}
-			err := w.RotateFile()
+		case <-ageCheck:
+			if w.currentLog.Age() < w.Config.WalRotateAge() {
+				continue
+			}
+		}
+		// A failed log stays the current log, so it is not flushed and later commits are refused
+		if w.currentLog.Failed() {
+			continue
+		}
+		// Empty logs are kept, so a quiet system does not create a log for every check
+		if w.currentLog.Empty() {
+			continue
+		}
+		if err := w.RotateFile(); err != nil {
+			if err == ErrWalClosed {
+				return
+			}
+			log.Panic().Err(err).Msg("WAL rotation failed!")
+		}
+	}
+}
+
+// syncPeriodically syncs the current log in the interval durability mode.
+func (w *WalPersister) syncPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(w.Config.WalSyncInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.currentLogLock.RLock()
+			err := w.currentLog.Sync()
+			w.currentLogLock.RUnlock()
 			if err != nil {
-				log.Panic().Err(err).Msg("WAL rotation failed!")
+				log.Warn().Err(err).Msg("Failed to sync WAL log")
 			}
 		}
 	}
 }
 
+// addWrittenCount counts a committed transaction, requesting rotation if the log is over its limits.
+// It should be called while the log is held, so the count and size are of the log the transaction was written to.
 func (w *WalPersister) addWrittenCount() {
-	w.writtenCount++
-	if w.writtenCount >= MAX_COMMITTED_PAGES {
-		w.rotateChan <- w.currentLog.filename
+	count := atomic.AddInt64(&w.writtenCount, 1)
+	if count < int64(w.Config.WalRotateTransactions()) && w.currentLog.Size() < w.Config.WalRotateBytes() {
+		return
+	}
+	select {
+	case w.rotateChan <- w.currentLog.filename:
+	default:
+		// Rotation is already requested
 	}
 }
 
+// RotateFile starts a new log, signalling flushChan so the previous logs can be flushed.
 func (w *WalPersister) RotateFile() error {
 	w.currentLogLock.Lock()
 	defer w.currentLogLock.Unlock()
 	w.changeLogLock.Lock()
 	defer w.changeLogLock.Unlock()
+	if w.ctx.Err() != nil {
+		return ErrWalClosed
+	}
 
 	fd, filename, err := w.FileResolver.NewFile(w.Counter.Now())
 	if err != nil {
 		return err
 	}
+	// Records of the previous log may not be synced yet in the interval mode
+	if w.Config.WalDurability() != util.DurabilityNone {
+		if err := w.currentLog.Sync(); err != nil {
+			fd.Close()
+			return err
+		}
+	}
 	w.currentLog.Close()
 
 	w.currentLog = NewWalWriteFile(fd, filename)
-	w.writtenCount = 0
+	atomic.StoreInt64(&w.writtenCount, 0)
 
 	select {
 	case w.flushChan <- true:
@@ -102,21 +179,60 @@ func (w *WalPersister) RotateFile() error {
 	return nil
 }
 
+// PersistRunner logs a transaction. Records are kept until the transaction commits,
+// when they are written together with the commit record, so a transaction is never split across logs.
 type PersistRunner struct {
 	persister *WalPersister
+	records   bytes.Buffer
 	closed    bool
 }
 
 func (w *PersistRunner) Write(e command.Command) error {
-	return w.persister.currentLog.Write(e)
+	if err := e.Write(&w.records); err != nil {
+		return errors.Wrapf(err, "failed to encode record (tx=%d)", e.TxID)
+	}
+	return nil
+}
+
+// Commit writes the records and the commit record of the transaction, returning its commit sequence number.
+// Sequence numbers are taken while the transaction still holds its pages, so they follow the order
+// changes to each page are committed in. If commits should be durable once they return,
+// the commit record is synced together with commits of other transactions.
+func (w *PersistRunner) Commit(txId uint64) (uint64, error) {
+	w.persister.currentLogLock.RLock()
+	defer w.persister.currentLogLock.RUnlock()
+
+	seq, err := w.persister.Counter.Next()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to assign commit sequence")
+	}
+	e := command.NewCommand(txId, &command.CommitCommand{Seq: seq})
+	if w.persister.Config.WalDurability() != util.DurabilityCommit {
+		if err := w.Write(e); err != nil {
+			return 0, err
+		}
+		if err := w.persister.currentLog.WriteRaw(w.records.Bytes()); err != nil {
+			return 0, errors.Wrapf(err, "failed to write records (tx=%d)", txId)
+		}
+	} else {
+		if err := w.persister.currentLog.WriteRaw(w.records.Bytes()); err != nil {
+			return 0, errors.Wrapf(err, "failed to write records (tx=%d)", txId)
+		}
+		if err := w.persister.committer.Commit(w.persister.ctx, e); err != nil {
+			return 0, err
+		}
+	}
+	w.records.Reset()
+	w.persister.addWrittenCount()
+	return seq, nil
 }
 
+// Close discards records of a transaction which was not committed.
 func (w *PersistRunner) Close() error {
 	if w.closed {
 		return nil
 	}
 	w.closed = true
-	w.persister.currentLogLock.RUnlock()
-	w.persister.addWrittenCount()
+	w.records.Reset()
 	return nil
 }
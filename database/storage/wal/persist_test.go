@@ -0,0 +1,209 @@
+package wal
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/storage/disk"
+	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/page"
+)
+
+// waitForLogs waits until the number of logs is n.
+func waitForLogs(t *testing.T, resolver *WalFileResolver, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		files, err := resolver.AllFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == n {
+			return files
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d logs, got %v", n, files)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRotateByTransactions(t *testing.T) {
+	config := &util.Config{Directory: t.TempDir(), WalMaxTransactions: 3}
+	persister := testPersister(t, config)
+	first := persister.currentLog.filename
+
+	for txId := uint64(1); txId <= 2; txId++ {
+		commitTx(t, persister, txId, &command.SavepointCommand{Name: "a"})
+	}
+	waitForLogs(t, persister.FileResolver, 1)
+	commitTx(t, persister, 3, &command.SavepointCommand{Name: "a"})
+	files := waitForLogs(t, persister.FileResolver, 2)
+	if files[0] != first {
+		t.Errorf("expected '%s' to be rotated, got %v", first, files)
+	}
+}
+
+func TestRotateByBytes(t *testing.T) {
+	config := &util.Config{Directory: t.TempDir(), WalMaxBytes: 256}
+	persister := testPersister(t, config)
+
+	candles := make(common.TimestampCandleList, 8)
+	for i := range candles {
+		candles[i] = common.TimestampCandle{Timestamp: int64(1646092800 + 60*i)}
+	}
+	insert := command.NewInsertCommand(testCandleSet("A"), candles, page.ConflictOverwrite)
+	commitTx(t, persister, 1, &insert)
+	waitForLogs(t, persister.FileResolver, 2)
+}
+
+func TestAutoFlushAfterRotation(t *testing.T) {
+	config := &util.Config{Directory: t.TempDir(), WalMaxTransactions: 1, WalAutoFlush: true}
+	d := disk.NewDisk(config)
+	wal, err := NewWriteAheadLog(config, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(wal.Close)
+
+	set := testCandleSet("A")
+	insert := command.NewInsertCommand(set, common.TimestampCandleList{{Timestamp: 1646092800}}, page.ConflictOverwrite)
+	txId, runner, err := wal.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Write(command.NewCommand(txId, &insert)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Commit(txId); err != nil {
+		t.Fatal(err)
+	}
+	runner.Close()
+
+	// FlushDoneChan is only signalled to a waiting receiver, so the flushed sequence number is polled instead
+	deadline := time.Now().Add(5 * time.Second)
+	for wal.FlushedSeq() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("rotated log was not flushed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitForLogs(t, &wal.resolver, 1)
+	if p := readTestPage(t, &d, set); p.Header.Count != 1 {
+		t.Errorf("expected the insert to be flushed to disk, got %d candles", p.Header.Count)
+	}
+}
+
+func TestRotateWhileTransactionOpen(t *testing.T) {
+	config := &util.Config{Directory: t.TempDir()}
+	persister := testPersister(t, config)
+	first := persister.FileResolver.FullPath(persister.currentLog.filename)
+
+	runner, err := persister.StartBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	if err := runner.Write(command.NewCommand(1, &command.SavepointCommand{Name: "a"})); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := make(chan error, 1)
+	go func() { rotated <- persister.RotateFile() }()
+	select {
+	case err := <-rotated:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("rotation is blocked by an open transaction")
+	}
+	second := persister.FileResolver.FullPath(persister.currentLog.filename)
+	if _, err := runner.Commit(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The transaction is written as a whole to the log current at its commit
+	if record, err := openLog(t, first).Read(); err == nil {
+		t.Errorf("expected the rotated log to be empty, got %s", record.String())
+	}
+	reader := openLog(t, second)
+	for _, expected := range []command.CommandType{command.SavepointCommandType, command.CommitCommandType} {
+		record, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Type != expected || record.TxID != 1 {
+			t.Errorf("expected record of type %d, got %s", expected, record.String())
+		}
+	}
+}
+
+func TestReadOnlyTransactionsDoNotRotate(t *testing.T) {
+	config := &util.Config{Directory: t.TempDir(), WalMaxTransactions: 2}
+	persister := testPersister(t, config)
+
+	// Read-only transactions log nothing and never commit
+	for i := 0; i < 10; i++ {
+		runner, err := persister.StartBuilder()
+		if err != nil {
+			t.Fatal(err)
+		}
+		runner.Close()
+	}
+	if count := atomic.LoadInt64(&persister.writtenCount); count != 0 {
+		t.Errorf("expected no transactions to be counted, got %d", count)
+	}
+	time.Sleep(50 * time.Millisecond)
+	waitForLogs(t, persister.FileResolver, 1)
+}
+
+func TestRecordsAreLoggedOnlyOnCommit(t *testing.T) {
+	config := &util.Config{Directory: t.TempDir()}
+	persister := testPersister(t, config)
+	file := persister.FileResolver.FullPath(persister.currentLog.filename)
+
+	committed, err := persister.StartBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rolledBack, err := persister.StartBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Records of both transactions are written in turns
+	for _, name := range []string{"a", "b"} {
+		if err := committed.Write(command.NewCommand(1, &command.SavepointCommand{Name: name})); err != nil {
+			t.Fatal(err)
+		}
+		if err := rolledBack.Write(command.NewCommand(2, &command.SavepointCommand{Name: name})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if record, err := openLog(t, file).Read(); err == nil {
+		t.Fatalf("expected nothing to be logged before commit, got %s", record.String())
+	}
+	rolledBack.Close()
+	if _, err := committed.Commit(1); err != nil {
+		t.Fatal(err)
+	}
+	committed.Close()
+
+	// Only the committed transaction is logged, with its records next to each other
+	reader := openLog(t, file)
+	for _, expected := range []command.CommandType{command.SavepointCommandType, command.SavepointCommandType, command.CommitCommandType} {
+		record, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Type != expected || record.TxID != 1 {
+			t.Errorf("expected record of type %d, got %s", expected, record.String())
+		}
+	}
+	if record, err := reader.Read(); err == nil {
+		t.Errorf("expected nothing else to be logged, got %s", record.String())
+	}
+}
@@ -1,10 +1,13 @@
 package wal
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io"
 	"os"
 
 	"github.com/jungnoh/mora/database/command"
+	"github.com/pkg/errors"
 )
 
 type WalEntryMap map[uint64]*WalReadResult
@@ -23,16 +26,41 @@ func (w *WalReadResult) SetAsCommitted() {
 }
 
 type WalLogReader struct {
-	fd *os.File
+	fd     *os.File
+	offset int64
+	// start is the offset of the first record
+	start int64
+	// legacy is set for logs without a file header, which were written before records had magic and checksums
+	legacy bool
+}
+
+// NewWalLogReader reads the file header of the log, positioning the reader at the first record.
+// Logs without a file header are read as legacy logs.
+func NewWalLogReader(fd *os.File) (*WalLogReader, error) {
+	reader := &WalLogReader{fd: fd}
+	header := make([]byte, logFileHeaderSize)
+	n, err := io.ReadFull(fd, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, errors.Wrap(err, "failed to read log header")
+	}
+	if n < logFileHeaderSize || binary.LittleEndian.Uint32(header[0:4]) != logFileMagic {
+		reader.legacy = true
+		return reader, reader.SeekToStart()
+	}
+	if version := binary.LittleEndian.Uint32(header[4:8]); version != logFileVersion {
+		return nil, errors.Errorf("unsupported log version %d", version)
+	}
+	reader.start = logFileHeaderSize
+	reader.offset = logFileHeaderSize
+	return reader, nil
 }
 
 func (w WalLogReader) ReadAll(result *WalEntryMap) error {
-	if _, err := w.fd.Seek(0, io.SeekStart); err != nil {
+	if err := w.SeekToStart(); err != nil {
 		return err
 	}
 	for {
-		newEntry := command.Command{}
-		err := newEntry.Read(0, w.fd)
+		newEntry, err := w.Read()
 		if err == io.EOF {
 			break
 		}
@@ -53,13 +81,12 @@ func (w WalLogReader) ReadAll(result *WalEntryMap) error {
 }
 
 func (w WalLogReader) ListCommittedAll() (map[uint64]bool, error) {
-	if _, err := w.fd.Seek(0, io.SeekStart); err != nil {
+	if err := w.SeekToStart(); err != nil {
 		return map[uint64]bool{}, err
 	}
 	result := make(map[uint64]bool)
 	for {
-		newEntry := command.Command{}
-		err := newEntry.ReadHeader(0, w.fd)
+		newEntry, err := w.Read()
 		if err == io.EOF {
 			break
 		}
@@ -74,12 +101,57 @@ func (w WalLogReader) ListCommittedAll() (map[uint64]bool, error) {
 	return result, nil
 }
 
-func (w WalLogReader) SeekToStart() error {
-	_, err := w.fd.Seek(0, io.SeekStart)
+func (w *WalLogReader) SeekToStart() error {
+	_, err := w.fd.Seek(w.start, io.SeekStart)
+	w.offset = w.start
 	return err
 }
 
-func (w WalLogReader) Read() (e command.Command, err error) {
-	err = e.Read(0, w.fd)
+// Read reads the next record. Offset is only advanced if the record was read successfully.
+func (w *WalLogReader) Read() (e command.Command, err error) {
+	if w.legacy {
+		err = e.ReadLegacy(w.fd)
+	} else {
+		err = e.Read(0, w.fd)
+	}
+	if err != nil {
+		return
+	}
+	w.offset, err = w.fd.Seek(0, io.SeekCurrent)
 	return
 }
+
+// Offset returns the end of the last record read successfully.
+func (w *WalLogReader) Offset() int64 {
+	return w.offset
+}
+
+// IsTornTail returns if the read error is from a record partially written at the end of the log.
+// As records are only appended, a damaged record is torn only if no valid record follows it.
+// Legacy logs have no checksums, so only records ending with the log are torn.
+func (w *WalLogReader) IsTornTail(readErr error) (bool, error) {
+	cause := errors.Cause(readErr)
+	if cause != command.ErrTornRecord && cause != command.ErrBadMagic && cause != command.ErrChecksumMismatch {
+		return false, nil
+	}
+	if w.legacy {
+		return cause == command.ErrTornRecord, nil
+	}
+	if _, err := w.fd.Seek(w.offset, io.SeekStart); err != nil {
+		return false, err
+	}
+	rest, err := io.ReadAll(w.fd)
+	if err != nil {
+		return false, err
+	}
+	for i := 1; i+4 <= len(rest); i++ {
+		if binary.LittleEndian.Uint32(rest[i:i+4]) != command.RecordMagic {
+			continue
+		}
+		next := command.Command{}
+		if err := next.Read(0, bytes.NewReader(rest[i:])); err == nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
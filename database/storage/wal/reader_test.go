@@ -0,0 +1,220 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jungnoh/mora/database/command"
+)
+
+func savepoint(txId uint64, name string) command.Command {
+	return command.NewCommand(txId, &command.SavepointCommand{Name: name})
+}
+
+// writeLog writes a log with the file header and records, returning the offsets records end at.
+func writeLog(t *testing.T, records ...command.Command) (string, []int64) {
+	t.Helper()
+	buf := bytes.Buffer{}
+	if err := writeLogFileHeader(&buf); err != nil {
+		t.Fatal(err)
+	}
+	ends := make([]int64, 0, len(records))
+	for _, record := range records {
+		if err := record.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		ends = append(ends, int64(buf.Len()))
+	}
+	file := path.Join(t.TempDir(), "wal.test.log")
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file, ends
+}
+
+func modifyLog(t *testing.T, file string, modify func([]byte) []byte) {
+	t.Helper()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, modify(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readUntilError reads records until an error, returning the number of records read and the error.
+func readUntilError(t *testing.T, file string) (*WalLogReader, int, error) {
+	t.Helper()
+	fd, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fd.Close() })
+	reader, err := NewWalLogReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for {
+		if _, err := reader.Read(); err != nil {
+			return reader, count, err
+		}
+		count++
+	}
+}
+
+func TestReadLog(t *testing.T) {
+	file, ends := writeLog(t, savepoint(1, "a"), savepoint(2, "b"))
+	reader, count, err := readUntilError(t, file)
+	if err != io.EOF || count != 2 {
+		t.Fatalf("expected 2 records and EOF, got %d and %v", count, err)
+	}
+	if reader.Offset() != ends[1] {
+		t.Errorf("expected offset %d, got %d", ends[1], reader.Offset())
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(content []byte, ends []int64) []byte
+	}{
+		{"partial record", func(content []byte, ends []int64) []byte {
+			return content[:len(content)-3]
+		}},
+		{"partial header", func(content []byte, ends []int64) []byte {
+			return content[:ends[0]+6]
+		}},
+		{"checksum mismatch", func(content []byte, ends []int64) []byte {
+			content[len(content)-1] ^= 0xff
+			return content
+		}},
+		{"zeroed tail", func(content []byte, ends []int64) []byte {
+			return append(content[:ends[0]], make([]byte, 64)...)
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file, ends := writeLog(t, savepoint(1, "a"), savepoint(2, "b"))
+			modifyLog(t, file, func(content []byte) []byte { return c.modify(content, ends) })
+
+			reader, count, err := readUntilError(t, file)
+			if count != 1 || err == io.EOF {
+				t.Fatalf("expected 1 record and a read error, got %d and %v", count, err)
+			}
+			torn, inspectErr := reader.IsTornTail(err)
+			if inspectErr != nil {
+				t.Fatal(inspectErr)
+			}
+			if !torn {
+				t.Errorf("expected torn tail for %v", err)
+			}
+			if reader.Offset() != ends[0] {
+				t.Errorf("expected offset %d, got %d", ends[0], reader.Offset())
+			}
+		})
+	}
+}
+
+func TestCorruptionBeforeValidRecord(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(content []byte, ends []int64) []byte
+	}{
+		{"size past end of log", func(content []byte, ends []int64) []byte {
+			binary.LittleEndian.PutUint32(content[ends[0]+4:], 1<<20)
+			return content
+		}},
+		{"checksum mismatch", func(content []byte, ends []int64) []byte {
+			content[ends[1]-1] ^= 0xff
+			return content
+		}},
+		{"bad magic", func(content []byte, ends []int64) []byte {
+			content[ends[0]] ^= 0xff
+			return content
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file, ends := writeLog(t, savepoint(1, "a"), savepoint(2, "b"), savepoint(3, "c"))
+			modifyLog(t, file, func(content []byte) []byte { return c.modify(content, ends) })
+
+			reader, count, err := readUntilError(t, file)
+			if count != 1 || err == io.EOF {
+				t.Fatalf("expected 1 record and a read error, got %d and %v", count, err)
+			}
+			torn, inspectErr := reader.IsTornTail(err)
+			if inspectErr != nil {
+				t.Fatal(inspectErr)
+			}
+			if torn {
+				t.Errorf("expected corruption for %v, as a valid record follows", err)
+			}
+		})
+	}
+}
+
+func TestFlushTruncatesTornTail(t *testing.T) {
+	file, ends := writeLog(t, savepoint(1, "a"), savepoint(2, "b"))
+	modifyLog(t, file, func(content []byte) []byte { return content[:len(content)-3] })
+
+	flusher := WalFlusher{}
+	if err := flusher.FlushWal([]string{file}); err != nil {
+		t.Fatal(err)
+	}
+	if len(flusher.Report.TornTails) != 1 {
+		t.Fatalf("expected a torn tail, got %+v", flusher.Report.TornTails)
+	}
+	tail := flusher.Report.TornTails[0]
+	if tail.Offset != ends[0] || tail.Truncated != ends[1]-ends[0]-3 {
+		t.Errorf("unexpected torn tail %+v", tail)
+	}
+	if flusher.Report.DiscardedTxs != 1 {
+		t.Errorf("expected 1 discarded transaction, got %d", flusher.Report.DiscardedTxs)
+	}
+}
+
+func TestFlushRejectsCorruption(t *testing.T) {
+	file, ends := writeLog(t, savepoint(1, "a"), savepoint(2, "b"), savepoint(3, "c"))
+	modifyLog(t, file, func(content []byte) []byte {
+		binary.LittleEndian.PutUint32(content[ends[0]+4:], 1<<20)
+		return content
+	})
+
+	flusher := WalFlusher{}
+	if err := flusher.FlushWal([]string{file}); err == nil {
+		t.Fatal("expected corruption to fail the flush")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("expected the log to be kept: %v", err)
+	}
+}
+
+func TestReadLegacyLog(t *testing.T) {
+	buf := bytes.Buffer{}
+	for _, txId := range []uint64{4, 5} {
+		binary.Write(&buf, binary.LittleEndian, uint32(0))
+		binary.Write(&buf, binary.LittleEndian, txId)
+		binary.Write(&buf, binary.LittleEndian, command.CommitCommandType)
+	}
+	file := path.Join(t.TempDir(), "wal.legacy.log")
+	if err := os.WriteFile(file, buf.Bytes()[:buf.Len()-2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, count, err := readUntilError(t, file)
+	if !reader.legacy {
+		t.Fatal("expected a legacy log")
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 record, got %d", count)
+	}
+	if torn, _ := reader.IsTornTail(err); !torn {
+		t.Errorf("expected torn tail for %v", err)
+	}
+}
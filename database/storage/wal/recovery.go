@@ -0,0 +1,23 @@
+package wal
+
+// RecoveryReport describes what was found in the logs replayed by a flush.
+type RecoveryReport struct {
+	Files []string
+	// CommittedTxs is the number of transactions applied to disk.
+	CommittedTxs int
+	// DiscardedTxs is the number of transactions without a commit record, which were ignored.
+	DiscardedTxs int
+	// TornTails lists logs that ended with a partially written record.
+	TornTails []TornTail
+	// MaxSeq is the largest transaction id or commit sequence number found in the logs.
+	MaxSeq uint64
+}
+
+// TornTail is a partially written record at the end of a log, which was truncated.
+type TornTail struct {
+	File string
+	// Offset is the end of the last complete record, which the log was truncated to.
+	Offset int64
+	// Truncated is the number of bytes removed.
+	Truncated int64
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/jungnoh/mora/database/util"
+	"github.com/pkg/errors"
 )
 
 const walFilePrefix string = "wal."
@@ -37,13 +38,27 @@ func (w WalFileResolver) AllFiles() ([]string, error) {
 	return result, nil
 }
 
+// NewFile creates a new log with its file header written.
 func (w WalFileResolver) NewFile(txid uint64) (*os.File, string, error) {
 	filename, err := w.ensureNewFile(txid)
 	if err != nil {
 		return nil, "", err
 	}
 	fd, err := os.Create(path.Join(w.dir(), filename))
-	return fd, filename, err
+	if err != nil {
+		return nil, "", err
+	}
+	if err := writeLogFileHeader(fd); err != nil {
+		fd.Close()
+		return nil, "", errors.Wrap(err, "failed to write log header")
+	}
+	if w.Config.WalDurability() != util.DurabilityNone {
+		if err := util.SyncDirectory(w.dir()); err != nil {
+			fd.Close()
+			return nil, "", errors.Wrap(err, "failed to sync log directory")
+		}
+	}
+	return fd, filename, nil
 }
 
 func (w WalFileResolver) FullPath(filename string) string {
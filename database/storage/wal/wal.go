@@ -21,7 +21,11 @@ type WriteAheadLog struct {
 	flushChan     chan bool
 	FlushDoneChan chan bool
 
+	recoveryReport RecoveryReport
+
 	isFlushRunning bool
+	// flushedSeq is the largest commit sequence number in flushed logs
+	flushedSeq uint64
 }
 
 func NewWriteAheadLog(config *util.Config, disk *disk.Disk) (*WriteAheadLog, error) {
@@ -30,7 +34,14 @@ func NewWriteAheadLog(config *util.Config, disk *disk.Disk) (*WriteAheadLog, err
 	if err := counter.Open(resolver.Counter()); err != nil {
 		return &WriteAheadLog{}, err
 	}
+	flusher := NewWalFlusher(&resolver, disk)
+	report, err := recoverLogs(&resolver, &counter, &flusher)
+	if err != nil {
+		return &WriteAheadLog{}, errors.Wrap(err, "failed to recover from WAL")
+	}
+
 	persister := WalPersister{
+		Config:       config,
 		Disk:         disk,
 		FileResolver: &resolver,
 		Counter:      &counter,
@@ -39,8 +50,6 @@ func NewWriteAheadLog(config *util.Config, disk *disk.Disk) (*WriteAheadLog, err
 		return &WriteAheadLog{}, err
 	}
 
-	flusher := NewWalFlusher(&resolver, disk)
-
 	wal := WriteAheadLog{
 		config:        config,
 		disk:          disk,
@@ -50,11 +59,59 @@ func NewWriteAheadLog(config *util.Config, disk *disk.Disk) (*WriteAheadLog, err
 		resolver:      resolver,
 		flushChan:     make(chan bool),
 		FlushDoneChan: make(chan bool),
+
+		recoveryReport: report,
+		flushedSeq:     report.MaxSeq,
 	}
 	go wal.listenToFlush()
+	if config.WalAutoFlush {
+		go wal.listenToRotation()
+	}
 	return &wal, nil
 }
 
+// recoverLogs replays logs left by a previous run, which may have crashed before flushing them.
+// Committed transactions are written to disk, and the counter is moved past every transaction in the logs.
+func recoverLogs(resolver *WalFileResolver, counter *WalCounter, flusher *WalFlusher) (RecoveryReport, error) {
+	files, err := resolver.AllFiles()
+	if err != nil {
+		return RecoveryReport{}, errors.Wrap(err, "failed to list logs")
+	}
+	if len(files) == 0 {
+		return RecoveryReport{Files: []string{}, TornTails: []TornTail{}}, nil
+	}
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = resolver.FullPath(file)
+	}
+	log.Info().Int("files", len(paths)).Msg("Recovering from WAL logs")
+	if err := flusher.FlushWal(paths); err != nil {
+		return RecoveryReport{}, err
+	}
+	report := flusher.Report
+	if err := counter.EnsureAtLeast(report.MaxSeq); err != nil {
+		return RecoveryReport{}, errors.Wrap(err, "failed to restore counter")
+	}
+	log.Info().
+		Int("files", len(report.Files)).
+		Int("committed", report.CommittedTxs).
+		Int("discarded", report.DiscardedTxs).
+		Int("tornTails", len(report.TornTails)).
+		Uint64("maxSeq", report.MaxSeq).
+		Msg("Recovered from WAL logs")
+	return report, nil
+}
+
+// GroupCommitStats describes batches of commits synced together.
+func (w *WriteAheadLog) GroupCommitStats() GroupCommitStats {
+	return w.persister.committer.Stats()
+}
+
+// RecoveryReport describes the logs replayed when the WAL was opened.
+func (w *WriteAheadLog) RecoveryReport() RecoveryReport {
+	return w.recoveryReport
+}
+
 func (w *WriteAheadLog) Close() {
 	w.persister.Close()
 }
@@ -78,6 +135,14 @@ func (w *WriteAheadLog) Begin() (uint64, PersistRunner, error) {
 	return txId, builder, err
 }
 
+// listenToRotation flushes logs whenever a log is rotated.
+func (w *WriteAheadLog) listenToRotation() {
+	// channel is closed when the persister is closed
+	for range w.persister.flushChan {
+		w.Flush()
+	}
+}
+
 func (w *WriteAheadLog) listenToFlush() {
 	// channel should close when WriteAheadLog is closed; no context is needed
 	for range w.flushChan {
@@ -112,10 +177,21 @@ func (w *WriteAheadLog) execFlush() error {
 
 	w.accessLock.Lock()
 	w.isFlushRunning = false
+	if err == nil && w.flusher.Report.MaxSeq > w.flushedSeq {
+		w.flushedSeq = w.flusher.Report.MaxSeq
+	}
 	w.accessLock.Unlock()
 	return err
 }
 
+// FlushedSeq returns the largest commit sequence number in flushed logs.
+// Transactions are not split across logs, so every transaction committed with a smaller number is flushed as well.
+func (w *WriteAheadLog) FlushedSeq() uint64 {
+	w.accessLock.Lock()
+	defer w.accessLock.Unlock()
+	return w.flushedSeq
+}
+
 func (w *WriteAheadLog) listFlushTargets() ([]string, error) {
 	files, err := w.resolver.AllFiles()
 	if err != nil {
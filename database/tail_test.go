@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+)
+
+func TestTailWaitsForYearsBeingCreated(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	nextYear := testCandles(testStart.AddDate(1, 0, 0), 2, 20)
+	if err := tx.Insert(set, nextYear); err != nil {
+		t.Fatal(err)
+	}
+
+	type tailResult struct {
+		candles common.CandleList
+		err     error
+	}
+	tailed := make(chan tailResult, 1)
+	go func() {
+		candles, err := db.Tail(set, 2)
+		tailed <- tailResult{candles, err}
+	}()
+	select {
+	case result := <-tailed:
+		t.Fatalf("expected tail to wait for the transaction creating a year, got %v (%v)", result.candles, result.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case result := <-tailed:
+		if result.err != nil {
+			t.Fatal(result.err)
+		}
+		expectCandles(t, result.candles, nextYear)
+	case <-time.After(5 * time.Second):
+		t.Fatal("tail is still blocked after commit")
+	}
+}
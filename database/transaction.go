@@ -1,24 +1,46 @@
 package database
 
 import (
+	"context"
 	"sort"
+	"time"
 
 	errSlice "github.com/carlmjohnson/errors"
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/catalog"
 	"github.com/jungnoh/mora/database/command"
 	"github.com/jungnoh/mora/database/concurrency"
 	"github.com/jungnoh/mora/database/storage"
+	"github.com/jungnoh/mora/database/validation"
+	"github.com/jungnoh/mora/page"
 	"github.com/pkg/errors"
 )
 
 type TransactionContext struct {
-	accessor *storage.StorageAccessor
-	dbLock   *concurrency.DatabaseLock
-	txId     concurrency.TransactionId
-	finished bool
+	// ctx bounds waits for locks held by other transactions
+	ctx       context.Context
+	accessor  *storage.StorageAccessor
+	dbLock    *concurrency.DatabaseLock
+	rollups   *rollupRegistry
+	catalog   *catalog.Catalog
+	validator *validation.Validator
+	txId      concurrency.TransactionId
+	finished  bool
+
+	insertedSets []page.CandleSet
+	droppedSets  []page.CandleSet
+	savepoints   []transactionSavepoint
+}
+
+type transactionSavepoint struct {
+	name         string
+	insertedSets []page.CandleSet
+	droppedSets  []page.CandleSet
 }
 
 func NewTransactionContext(accessor *storage.StorageAccessor, dbLock *concurrency.DatabaseLock) TransactionContext {
 	ctx := TransactionContext{
+		ctx:      context.Background(),
 		accessor: accessor,
 		dbLock:   dbLock,
 	}
@@ -32,28 +54,196 @@ func (t *TransactionContext) Start() error {
 }
 
 func (t *TransactionContext) Execute(cmd command.CommandContent) (interface{}, error) {
-	plan := cmd.Plan()
-	sort.Sort(plan.NeededLocks)
-	for _, lock := range plan.NeededLocks {
-		lockType := concurrency.SLock
-		if lock.Exclusive {
-			lockType = concurrency.XLock
+	// Inserts are validated before they are logged, so invalid candles and modes never reach the WAL
+	if insertCmd, ok := cmd.(*command.InsertCommand); ok {
+		if err := insertCmd.Mode.Validate(); err != nil {
+			return struct{}{}, err
+		}
+		if t.validator != nil {
+			if err := t.validator.Validate(insertCmd.TargetSet().CandleSetWithoutYear, common.TimestampCandleList(insertCmd.Candles).ToCandleList()); err != nil {
+				return struct{}{}, err
+			}
 		}
-		if err := t.dbLock.EnsureLock(t.txId, lock.Lock, lockType); err != nil {
-			return struct{}{}, errors.Wrapf(err, "failed to lock")
+	}
+	plan := cmd.Plan()
+	if err := t.ensureLocks(plan.NeededLocks); err != nil {
+		return struct{}{}, err
+	}
+	if updateCmd, ok := cmd.(*command.UpdateLastCommand); ok && t.validator != nil {
+		if err := t.validateUpdateLast(updateCmd); err != nil {
+			return struct{}{}, err
 		}
 	}
 	result, err := t.accessor.Execute(cmd)
 	if err != nil {
 		return result, errors.Wrapf(err, "failed to execute command '%s'", cmd.String())
 	}
+	switch typed := cmd.(type) {
+	case *command.InsertCommand:
+		t.markInserted(typed.TargetSet())
+	case *command.UpdateLastCommand:
+		t.markInserted(typed.TargetSet())
+	case *command.DeleteRangeCommand:
+		// Years emptied by the delete are no longer listed, as their page files are deleted on flush
+		header, err := t.accessor.Header(typed.TargetSet())
+		if err != nil {
+			return result, errors.Wrapf(err, "failed to read header of '%s'", cmd.String())
+		}
+		if header.Count == 0 {
+			t.markDropped(typed.TargetSet())
+		}
+	case *command.DropCommand:
+		t.markDropped(typed.TargetSet())
+	case *command.RenameCommand:
+		t.markDropped(typed.SourceSet())
+		if moved, ok := result.(int); ok && moved > 0 {
+			t.markInserted(typed.TargetSet())
+		}
+	}
+	rollups, err := t.buildRollupsOf(cmd, result)
+	if err != nil {
+		return result, errors.Wrapf(err, "failed to build rollups of '%s'", cmd.String())
+	}
+	if err := t.executeRollups(rollups); err != nil {
+		return result, err
+	}
 	return result, nil
 }
 
+// validateUpdateLast validates the candle the update results in, which depends on the candle at its offset.
+// The set is locked by then, so the candle can not change before the update is executed.
+func (t *TransactionContext) validateUpdateLast(cmd *command.UpdateLastCommand) error {
+	target := cmd.TargetSet()
+	block, found, err := t.accessor.Search(target, cmd.TimestampOffset, page.SearchExact)
+	if err != nil {
+		return errors.Wrapf(err, "failed to search (key '%s')", target.UniqueKey())
+	}
+	var candle common.Candle
+	if found {
+		candle = block.ToCandle()
+		candle.TimelessCandle = cmd.Update.Apply(candle.TimelessCandle)
+	} else {
+		timeless, ok := cmd.Update.NewCandle()
+		if !ok {
+			// The update fails when executed, as a new candle needs a close
+			return nil
+		}
+		ts := common.GetStartOfYearTimestamp(int(target.Year)) + int64(cmd.TimestampOffset)
+		candle = common.Candle{Timestamp: time.Unix(ts, 0), TimelessCandle: timeless}
+	}
+	return t.validator.Validate(target.CandleSetWithoutYear, common.CandleList{candle})
+}
+
+func (t *TransactionContext) executeRollups(rollups []command.CommandContent) error {
+	for _, rollup := range rollups {
+		if _, err := t.Execute(rollup); err != nil {
+			return errors.Wrap(err, "failed to update rollup")
+		}
+	}
+	return nil
+}
+
+// executeAndCommit executes the commands and commits, returning results of the commands.
+func (t *TransactionContext) executeAndCommit(commands []command.CommandContent) ([]interface{}, error) {
+	result := make([]interface{}, 0, len(commands))
+	for _, cmd := range commands {
+		cmdResult, err := t.Execute(cmd)
+		if err != nil {
+			return []interface{}{}, errors.Wrapf(err, "failed to execute command '%s'", cmd.String())
+		}
+		result = append(result, cmdResult)
+	}
+	if err := t.Commit(); err != nil {
+		return []interface{}{}, errors.Wrap(err, "failed to commit")
+	}
+	return result, nil
+}
+
+// Savepoint marks a point the transaction can be partially rolled back to.
+func (t *TransactionContext) Savepoint(name string) error {
+	if err := t.accessor.Savepoint(name); err != nil {
+		return err
+	}
+	t.savepoints = append(t.savepoints, transactionSavepoint{
+		name:         name,
+		insertedSets: append([]page.CandleSet{}, t.insertedSets...),
+		droppedSets:  append([]page.CandleSet{}, t.droppedSets...),
+	})
+	return nil
+}
+
+// RollbackTo discards changes made after the last savepoint with the name. Locks are kept.
+func (t *TransactionContext) RollbackTo(name string) error {
+	if err := t.accessor.RollbackTo(name); err != nil {
+		return err
+	}
+	for i := len(t.savepoints) - 1; i >= 0; i-- {
+		if t.savepoints[i].name == name {
+			t.insertedSets = append([]page.CandleSet{}, t.savepoints[i].insertedSets...)
+			t.droppedSets = append([]page.CandleSet{}, t.savepoints[i].droppedSets...)
+			t.savepoints = t.savepoints[:i+1]
+			break
+		}
+	}
+	return nil
+}
+
+// markInserted records a set created by the transaction, to be added to the catalog on commit.
+func (t *TransactionContext) markInserted(set page.CandleSet) {
+	t.droppedSets = removeSet(t.droppedSets, set)
+	t.insertedSets = append(t.insertedSets, set)
+}
+
+// markDropped records a set dropped by the transaction, to be removed from the catalog on commit.
+func (t *TransactionContext) markDropped(set page.CandleSet) {
+	t.insertedSets = removeSet(t.insertedSets, set)
+	t.droppedSets = append(t.droppedSets, set)
+}
+
+func removeSet(sets []page.CandleSet, set page.CandleSet) []page.CandleSet {
+	result := sets[:0]
+	for _, s := range sets {
+		if s != set {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (t *TransactionContext) lockSet(set page.CandleSet, exclusive bool) error {
+	return t.ensureLocks(command.NeededLockSlice{{
+		Lock:      concurrency.NewSetResourceName(set),
+		Exclusive: exclusive,
+	}})
+}
+
+func (t *TransactionContext) unlockSet(set page.CandleSet) error {
+	return t.dbLock.Release(t.txId, concurrency.NewSetResourceName(set))
+}
+
+func (t *TransactionContext) ensureLocks(locks command.NeededLockSlice) error {
+	sort.Sort(locks)
+	for _, lock := range locks {
+		lockType := concurrency.SLock
+		if lock.Exclusive {
+			lockType = concurrency.XLock
+		}
+		if err := t.dbLock.EnsureLock(t.ctx, t.txId, lock.Lock, lockType); err != nil {
+			return errors.Wrapf(err, "failed to lock")
+		}
+	}
+	return nil
+}
+
 func (t *TransactionContext) Commit() error {
 	t.finished = true
 	var errs errSlice.Slice
-	errs.Push(t.accessor.Commit())
+	commitErr := t.accessor.Commit()
+	if commitErr == nil && t.catalog != nil {
+		t.catalog.Remove(t.droppedSets...)
+		t.catalog.Add(t.insertedSets...)
+	}
+	errs.Push(commitErr)
 	errs.Push(t.dbLock.Free(t.txId))
 	return errs.Merge()
 }
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/concurrency"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrTxFinished is returned when using a transaction after Commit or Rollback.
+	ErrTxFinished = errors.New("transaction is already finished")
+	// ErrTxAborted is returned when using a transaction after one of its commands failed.
+	ErrTxAborted = errors.New("transaction is aborted by a failed command")
+)
+
+// Tx is an interactive transaction, holding its locks until Commit or Rollback.
+// A failed command aborts the transaction, so it can only be rolled back afterwards.
+type Tx struct {
+	ctx        context.Context
+	tx         *TransactionContext
+	factory    CommandContentFactory
+	accessLock sync.Mutex
+	finished   bool
+	aborted    error
+	// done is closed once the transaction is finished
+	done chan struct{}
+}
+
+// Begin starts an interactive transaction. The context is checked before every operation,
+// and the transaction is rolled back once it is done, after the running operation returns if there is one.
+func (d *Database) Begin(ctx context.Context) (*Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tx, err := d.begin()
+	if err != nil {
+		return nil, err
+	}
+	// Lock waits end once the context is done, so watchContext can roll back a blocked transaction
+	tx.ctx = ctx
+	t := &Tx{
+		ctx:     ctx,
+		tx:      tx,
+		factory: CommandContentFactory{},
+		done:    make(chan struct{}),
+	}
+	go t.watchContext()
+	return t, nil
+}
+
+// watchContext rolls back the transaction once its context is done,
+// so an abandoned transaction does not hold its locks and log forever.
+func (t *Tx) watchContext() {
+	select {
+	case <-t.ctx.Done():
+		t.accessLock.Lock()
+		defer t.accessLock.Unlock()
+		if !t.finished {
+			if err := t.rollback(); err != nil {
+				log.Warn().Err(err).Msg("Failed to roll back transaction of a done context")
+			}
+		}
+	case <-t.done:
+	}
+}
+
+// checkUse returns an error if the transaction can not run commands, rolling back if the context is done.
+func (t *Tx) checkUse() error {
+	if t.finished {
+		return ErrTxFinished
+	}
+	if t.aborted != nil {
+		return errors.Wrap(ErrTxAborted, t.aborted.Error())
+	}
+	if err := t.ctx.Err(); err != nil {
+		t.rollback()
+		return err
+	}
+	return nil
+}
+
+// isLockFailure returns whether err is from waiting for a lock, which ended with a deadlock or a done context.
+func isLockFailure(err error) bool {
+	return errors.Is(err, concurrency.ErrDeadlock) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (t *Tx) execute(commands []command.CommandContent) ([]interface{}, error) {
+	results := make([]interface{}, 0, len(commands))
+	for _, cmd := range commands {
+		result, err := t.tx.Execute(cmd)
+		if err != nil {
+			// Commands are logged before they run, so the transaction can not be committed anymore
+			t.aborted = err
+			return []interface{}{}, errors.Wrapf(err, "failed to execute command '%s'", cmd.String())
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Insert writes candles to the set, overwriting candles with the same timestamps.
+func (t *Tx) Insert(set page.CandleSetWithoutYear, candles common.CandleList) error {
+	return t.InsertWithMode(set, candles, page.ConflictOverwrite)
+}
+
+// InsertWithMode writes candles to the set, resolving existing timestamps with the mode.
+func (t *Tx) InsertWithMode(set page.CandleSetWithoutYear, candles common.CandleList, mode page.ConflictMode) error {
+	if err := mode.Validate(); err != nil {
+		return err
+	}
+	t.accessLock.Lock()
+	defer t.accessLock.Unlock()
+	if err := t.checkUse(); err != nil {
+		return err
+	}
+	_, err := t.execute(t.factory.InsertToSet(set, candles, mode))
+	return err
+}
+
+// Read reads candles of the set in [r.Start, r.End), including changes made by this transaction.
+func (t *Tx) Read(set page.CandleSetWithoutYear, r common.TimeRange, opts ...ReadOption) (common.CandleList, error) {
+	t.accessLock.Lock()
+	defer t.accessLock.Unlock()
+	if err := t.checkUse(); err != nil {
+		return common.CandleList{}, err
+	}
+	options := newReadOptions(opts)
+	commands, err := t.tx.readCommands(set, r, options)
+	if err != nil {
+		if isLockFailure(err) {
+			t.aborted = err
+		}
+		return common.CandleList{}, err
+	}
+	results, err := t.execute(commands)
+	if err != nil {
+		return common.CandleList{}, err
+	}
+	return options.collect(results), nil
+}
+
+// Delete removes candles of the set in [r.Start, r.End), returning the number of removed candles.
+func (t *Tx) Delete(set page.CandleSetWithoutYear, r common.TimeRange) (int, error) {
+	t.accessLock.Lock()
+	defer t.accessLock.Unlock()
+	if err := t.checkUse(); err != nil {
+		return 0, err
+	}
+	years, err := t.tx.lockYears(set, r, true)
+	if err != nil {
+		if isLockFailure(err) {
+			t.aborted = err
+		}
+		return 0, err
+	}
+	results, err := t.execute(CommandContentFactory{}.DeleteFromSet(set, years, r))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, result := range results {
+		removed += result.(int)
+	}
+	return removed, nil
+}
+
+// Savepoint marks a point the transaction can be rolled back to with RollbackTo.
+// Names may be reused, in which case the latest savepoint with the name is used.
+func (t *Tx) Savepoint(name string) error {
+	t.accessLock.Lock()
+	defer t.accessLock.Unlock()
+	if err := t.checkUse(); err != nil {
+		return err
+	}
+	if err := t.tx.Savepoint(name); err != nil {
+		t.aborted = err
+		return err
+	}
+	return nil
+}
+
+// RollbackTo discards changes made after the savepoint, which is kept for later use.
+// A transaction aborted by a failed command becomes usable again, as the command is discarded as well.
+// Aborts by a deadlock or a done context are kept, as locks taken after the savepoint are not released.
+func (t *Tx) RollbackTo(name string) error {
+	t.accessLock.Lock()
+	defer t.accessLock.Unlock()
+	if t.finished {
+		return ErrTxFinished
+	}
+	if err := t.ctx.Err(); err != nil {
+		t.rollback()
+		return err
+	}
+	if t.aborted != nil && isLockFailure(t.aborted) {
+		return errors.Wrap(ErrTxAborted, t.aborted.Error())
+	}
+	if err := t.tx.RollbackTo(name); err != nil {
+		return err
+	}
+	t.aborted = nil
+	return nil
+}
+
+// Commit commits the transaction. An aborted transaction is rolled back instead, returning an error.
+func (t *Tx) Commit() error {
+	t.accessLock.Lock()
+	defer t.accessLock.Unlock()
+	if t.finished {
+		return ErrTxFinished
+	}
+	if t.aborted != nil {
+		t.rollback()
+		return errors.Wrap(ErrTxAborted, t.aborted.Error())
+	}
+	if err := t.ctx.Err(); err != nil {
+		t.rollback()
+		return err
+	}
+	t.finish()
+	if err := t.tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit")
+	}
+	return nil
+}
+
+// Rollback discards all changes of the transaction.
+func (t *Tx) Rollback() error {
+	t.accessLock.Lock()
+	defer t.accessLock.Unlock()
+	if t.finished {
+		return ErrTxFinished
+	}
+	return t.rollback()
+}
+
+func (t *Tx) rollback() error {
+	t.finish()
+	return t.tx.Rollback()
+}
+
+func (t *Tx) finish() {
+	t.finished = true
+	close(t.done)
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/concurrency"
+)
+
+func TestTxRolledBackWhenContextDone(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(set, testCandles(testStart, 2, 10)); err != nil {
+		t.Fatal(err)
+	}
+	// The transaction is abandoned without Commit or Rollback
+	cancel()
+
+	written := make(chan error, 1)
+	candles := testCandles(testStart.Add(time.Hour), 1, 20)
+	go func() {
+		_, err := db.Write(set, candles)
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write is blocked by the abandoned transaction")
+	}
+	expectCandles(t, readAll(t, db, set), candles)
+
+	if err := tx.Commit(); err != ErrTxFinished {
+		t.Errorf("expected the transaction to be finished, got %v", err)
+	}
+}
+
+func TestTxCommitStopsWatchingContext(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candles := testCandles(testStart, 2, 10)
+	if err := tx.Insert(set, candles); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	expectCandles(t, readAll(t, db, set), candles)
+}
+
+func TestTxConcurrentReadThenInsertFailsOneWithDeadlock(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 2, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	txs := make([]*Tx, 2)
+	for i := range txs {
+		tx, err := db.Begin(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Read(set, common.TimeRange{Start: testStart, End: testStart.AddDate(0, 0, 1)}); err != nil {
+			t.Fatal(err)
+		}
+		txs[i] = tx
+	}
+
+	// Both transactions hold S on the code and need X for the insert, so one has to fail.
+	// Rolling back the failed transaction lets the other one continue.
+	inserted := make(chan error, len(txs))
+	for i, tx := range txs {
+		go func(tx *Tx, price float64) {
+			err := tx.Insert(set, testCandles(testStart.Add(time.Hour), 1, price))
+			if err != nil {
+				tx.Rollback()
+			}
+			inserted <- err
+		}(tx, float64(20+i))
+	}
+	deadlocks := 0
+	for range txs {
+		select {
+		case err := <-inserted:
+			if errors.Is(err, concurrency.ErrDeadlock) {
+				deadlocks++
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("inserts are blocked on each other")
+		}
+	}
+	if deadlocks != 1 {
+		t.Errorf("expected one deadlock error, got %d", deadlocks)
+	}
+}
+
+func TestTxRollbackToKeepsDeadlockAbort(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 2, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	txs := make([]*Tx, 2)
+	for i := range txs {
+		tx, err := db.Begin(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Read(set, common.TimeRange{Start: testStart, End: testStart.AddDate(0, 0, 1)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Savepoint("s"); err != nil {
+			t.Fatal(err)
+		}
+		txs[i] = tx
+	}
+
+	// Rolling back to the savepoint keeps the S lock the other transaction waits on, so the abort is kept
+	rolledBack := make(chan error, len(txs))
+	for i, tx := range txs {
+		go func(tx *Tx, price float64) {
+			err := tx.Insert(set, testCandles(testStart.Add(time.Hour), 1, price))
+			if errors.Is(err, concurrency.ErrDeadlock) {
+				err = tx.RollbackTo("s")
+				tx.Rollback()
+			}
+			rolledBack <- err
+		}(tx, float64(20+i))
+	}
+	aborted := 0
+	for range txs {
+		select {
+		case err := <-rolledBack:
+			if errors.Is(err, ErrTxAborted) {
+				aborted++
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("inserts are blocked on each other")
+		}
+	}
+	if aborted != 1 {
+		t.Errorf("expected rollback to the savepoint to fail for the deadlocked transaction, got %d", aborted)
+	}
+}
+
+func TestTxLockWaitEndsWithContext(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+
+	holder, err := db.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Rollback()
+	if err := holder.Insert(set, testCandles(testStart, 2, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	waiter, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := make(chan error, 1)
+	go func() {
+		_, err := waiter.Read(set, common.TimeRange{Start: testStart, End: testStart.AddDate(0, 0, 1)})
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the deadline to end the wait, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read is still waiting after the deadline")
+	}
+
+	// The waiting transaction is rolled back, and the holder is unaffected
+	time.Sleep(10 * time.Millisecond)
+	if err := waiter.Commit(); err != ErrTxFinished {
+		t.Errorf("expected the transaction to be finished, got %v", err)
+	}
+	if err := holder.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
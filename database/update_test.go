@@ -0,0 +1,135 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/storage"
+	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/database/validation"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+func tick(v float64, volume float64) common.CandleUpdate {
+	return common.CandleUpdate{
+		Fields: common.UpdateHigh | common.UpdateLow | common.UpdateClose | common.UpdateVolume,
+		High:   v, Low: v, Close: v, Volume: volume,
+	}
+}
+
+func TestUpdateLastRolledBack(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	candles := testCandles(testStart, 3, 10)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+
+	last := candles[2].Timestamp
+	offset := uint32(last.Unix() - common.GetStartOfYearTimestamp(2022))
+	update := command.NewUpdateLastCommand(page.CandleSet{Year: 2022, CandleSetWithoutYear: set}, offset, tick(100, 5))
+	next := command.NewUpdateLastCommand(page.CandleSet{Year: 2022, CandleSetWithoutYear: set}, offset+60, tick(100, 5))
+	// Updating before the last candle fails, rolling back the updates applied in place
+	failing := command.NewUpdateLastCommand(page.CandleSet{Year: 2022, CandleSetWithoutYear: set}, offset, tick(100, 5))
+	if _, err := db.Execute([]command.CommandContent{&update, &next, &failing}); err == nil {
+		t.Fatal("expected the update before the last candle to fail")
+	}
+	expectCandles(t, readAll(t, db, set), candles)
+}
+
+func TestUpdateLastUpdatesRollups(t *testing.T) {
+	config := testConfig(t)
+	config.MaxMemoryPages = 0
+	db := openTestDatabase(t, config)
+	if err := db.AddRollup("TEST", 60, 300); err != nil {
+		t.Fatal(err)
+	}
+	set := testSet("A")
+	if _, err := db.Write(set, testCandles(testStart, 3, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := []struct {
+		t      time.Time
+		update common.CandleUpdate
+	}{
+		{testStart.Add(2 * time.Minute), tick(20, 3)},
+		{testStart.Add(3 * time.Minute), tick(5, 1)},
+		{testStart.Add(5 * time.Minute), tick(30, 2)},
+		{testStart.Add(5 * time.Minute), tick(31, 4)},
+	}
+	for _, u := range updates {
+		if err := db.UpdateLast(set, u.t, u.update); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rollupSet := set
+	rollupSet.CandleLength = 300
+	expected, err := readAll(t, db, set).Resample(60, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) != 2 {
+		t.Fatalf("expected 2 buckets, got %v", expected)
+	}
+	expectCandles(t, readAll(t, db, rollupSet), expected)
+
+	// Pages written back by eviction keep the updates
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	db.Storage.EvictMemory(storage.UserTriggerEvictionReason)
+	expectCandles(t, readAll(t, db, rollupSet), expected)
+}
+
+func TestUpdateLastRejectsTimeOutOfPageYears(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+
+	// Year 67536 would wrap around to 2000 if truncated to a page year
+	outOfRange := time.Date(67536, 3, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.UpdateLast(set, outOfRange, tick(10, 1)); err == nil {
+		t.Fatal("expected an update out of page years to fail")
+	}
+	if years := db.ListYears(set); len(years) != 0 {
+		t.Fatalf("expected nothing to be written, got years %v", years)
+	}
+}
+
+func TestUpdateLastRejectsUnalignedTime(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+
+	if err := db.UpdateLast(set, testStart.Add(30*time.Second), tick(10, 1)); err == nil {
+		t.Fatal("expected an update not aligned to the candle length to fail")
+	}
+	if got := readAll(t, db, set); len(got) != 0 {
+		t.Fatalf("expected nothing to be written, got %v", got)
+	}
+}
+
+func TestUpdateLastValidatesResultingCandle(t *testing.T) {
+	config := testConfig(t)
+	config.Validation = util.ValidationStrict
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	candles := testCandles(testStart, 2, 10)
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatal(err)
+	}
+
+	var validationErr *validation.ValidationError
+	// A new candle with a negative volume
+	err := db.UpdateLast(set, testStart.Add(2*time.Minute), tick(20, -1))
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error for the new candle, got %v", err)
+	}
+	// An update in place leaving the candle with a negative volume
+	err = db.UpdateLast(set, candles[1].Timestamp, common.CandleUpdate{Fields: common.UpdateVolume, Volume: -1})
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error for the updated candle, got %v", err)
+	}
+	expectCandles(t, readAll(t, db, set), candles)
+}
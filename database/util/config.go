@@ -1,7 +1,150 @@
 package util
 
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 type Config struct {
 	Directory        string `json:"directory" yaml:"directory"`
 	MaxMemoryPages   int    `json:"max_memory_pages" yaml:"max_memory_pages"`
 	EvictionInterval int    `json:"eviction_interval" yaml:"eviction_interval"`
+
+	// Validation is the validation mode of markets not in MarketValidation. Defaults to off.
+	Validation       ValidationMode            `json:"validation" yaml:"validation"`
+	MarketValidation map[string]ValidationMode `json:"market_validation" yaml:"market_validation"`
+
+	// Durability decides when WAL logs are synced to disk. Defaults to none, which never syncs like before it was added.
+	// Except in the none mode, pages flushed from logs are also synced before the logs are deleted.
+	Durability DurabilityMode `json:"durability" yaml:"durability"`
+	// DurabilityInterval is the sync interval in milliseconds of the interval mode. Defaults to 100.
+	DurabilityInterval int `json:"durability_interval" yaml:"durability_interval"`
+	// GroupCommitMaxBatch is the maximum number of commits synced at once in the commit mode. Defaults to 128.
+	GroupCommitMaxBatch int `json:"group_commit_max_batch" yaml:"group_commit_max_batch"`
+	// GroupCommitMaxWait is the time in milliseconds to wait for more commits before syncing.
+	// Defaults to 0, where only commits queued while the previous sync was running are batched.
+	GroupCommitMaxWait int `json:"group_commit_max_wait" yaml:"group_commit_max_wait"`
+
+	// WalMaxBytes is the size in bytes a log is rotated at. Defaults to 64MiB.
+	WalMaxBytes int64 `json:"wal_max_bytes" yaml:"wal_max_bytes"`
+	// WalMaxTransactions is the number of transactions a log is rotated at. Defaults to 256.
+	WalMaxTransactions int `json:"wal_max_transactions" yaml:"wal_max_transactions"`
+	// WalMaxAge is the age in seconds a log with records is rotated at. Defaults to 0, which disables it.
+	WalMaxAge int `json:"wal_max_age" yaml:"wal_max_age"`
+	// WalAutoFlush flushes rotated logs to disk after every rotation.
+	WalAutoFlush bool `json:"wal_auto_flush" yaml:"wal_auto_flush"`
+}
+
+// Validate returns an error if the config has modes which are not known.
+func (c *Config) Validate() error {
+	switch c.WalDurability() {
+	case DurabilityNone, DurabilityCommit, DurabilityInterval:
+	default:
+		return errors.Errorf("unknown durability mode '%s'", c.Durability)
+	}
+	if !c.ValidationModeOf("").known() {
+		return errors.Errorf("unknown validation mode '%s'", c.Validation)
+	}
+	for marketCode := range c.MarketValidation {
+		if mode := c.ValidationModeOf(marketCode); !mode.known() {
+			return errors.Errorf("unknown validation mode '%s' for market '%s'", mode, marketCode)
+		}
+	}
+	return nil
+}
+
+// ValidationMode decides how invalid candles are handled on write.
+type ValidationMode string
+
+const (
+	// ValidationStrict rejects the write
+	ValidationStrict ValidationMode = "strict"
+	// ValidationWarn logs invalid candles and writes them anyway
+	ValidationWarn ValidationMode = "warn"
+	// ValidationOff skips validation
+	ValidationOff ValidationMode = "off"
+)
+
+func (m ValidationMode) known() bool {
+	return m == ValidationStrict || m == ValidationWarn || m == ValidationOff
+}
+
+// ValidationModeOf returns the validation mode of the market.
+func (c *Config) ValidationModeOf(marketCode string) ValidationMode {
+	if mode, ok := c.MarketValidation[marketCode]; ok && mode != "" {
+		return mode
+	}
+	if c.Validation == "" {
+		return ValidationOff
+	}
+	return c.Validation
+}
+
+// DurabilityMode decides when WAL logs are synced to disk.
+type DurabilityMode string
+
+const (
+	// DurabilityNone leaves syncing to the OS, so committed transactions may be lost on power failure
+	DurabilityNone DurabilityMode = "none"
+	// DurabilityCommit syncs the log before commits return
+	DurabilityCommit DurabilityMode = "commit"
+	// DurabilityInterval syncs the log periodically, so transactions committed since the last sync may be lost
+	DurabilityInterval DurabilityMode = "interval"
+)
+
+// WalDurability returns the durability mode of WAL logs.
+func (c *Config) WalDurability() DurabilityMode {
+	if c.Durability == "" {
+		return DurabilityNone
+	}
+	return c.Durability
+}
+
+// WalSyncInterval returns the sync interval of the interval durability mode.
+func (c *Config) WalSyncInterval() time.Duration {
+	if c.DurabilityInterval <= 0 {
+		return 100 * time.Millisecond
+	}
+	return time.Duration(c.DurabilityInterval) * time.Millisecond
+}
+
+// WalGroupCommitMaxBatch returns the maximum number of commits synced at once.
+func (c *Config) WalGroupCommitMaxBatch() int {
+	if c.GroupCommitMaxBatch <= 0 {
+		return 128
+	}
+	return c.GroupCommitMaxBatch
+}
+
+// WalGroupCommitMaxWait returns the time to wait for more commits before syncing.
+func (c *Config) WalGroupCommitMaxWait() time.Duration {
+	if c.GroupCommitMaxWait <= 0 {
+		return 0
+	}
+	return time.Duration(c.GroupCommitMaxWait) * time.Millisecond
+}
+
+// WalRotateBytes returns the size a log is rotated at.
+func (c *Config) WalRotateBytes() int64 {
+	if c.WalMaxBytes <= 0 {
+		return 64 << 20
+	}
+	return c.WalMaxBytes
+}
+
+// WalRotateTransactions returns the number of transactions a log is rotated at.
+func (c *Config) WalRotateTransactions() int {
+	if c.WalMaxTransactions <= 0 {
+		return 256
+	}
+	return c.WalMaxTransactions
+}
+
+// WalRotateAge returns the age a log is rotated at, or 0 if logs are not rotated by age.
+func (c *Config) WalRotateAge() time.Duration {
+	if c.WalMaxAge <= 0 {
+		return 0
+	}
+	return time.Duration(c.WalMaxAge) * time.Second
 }
@@ -19,3 +19,13 @@ func FileExists(path string) (bool, error) {
 func EnsureDirectoryOfFile(filePath string) error {
 	return os.MkdirAll(path.Dir(filePath), 0755)
 }
+
+// SyncDirectory syncs the directory, so entries created in it survive power failure.
+func SyncDirectory(dirPath string) error {
+	fd, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return fd.Sync()
+}
@@ -0,0 +1,119 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Issue describes an invalid candle by its index in the written list.
+type Issue struct {
+	Index     int
+	Timestamp time.Time
+	Reason    string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("#%d (%s): %s", i.Index, i.Timestamp.Format(time.RFC3339), i.Reason)
+}
+
+// ValidationError is returned by strict validation, listing all invalid candles.
+type ValidationError struct {
+	Set    page.CandleSetWithoutYear
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	issues := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		issues = append(issues, issue.String())
+	}
+	return fmt.Sprintf("%d invalid candles for '%s': %s", len(e.Issues), e.Set.UniqueKey(), strings.Join(issues, ", "))
+}
+
+// Validator checks candles before they are written, with the mode configured per market.
+type Validator struct {
+	config *util.Config
+	now    func() time.Time
+}
+
+func NewValidator(config *util.Config) *Validator {
+	return &Validator{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// Validate checks the candles written to the set.
+// A *ValidationError is returned in strict mode; in warn mode issues are only logged.
+func (v *Validator) Validate(set page.CandleSetWithoutYear, candles common.CandleList) error {
+	mode := v.config.ValidationModeOf(set.MarketCode)
+	switch mode {
+	case util.ValidationOff:
+		return nil
+	case util.ValidationStrict, util.ValidationWarn:
+	default:
+		return errors.Errorf("unknown validation mode '%s' for market '%s'", mode, set.MarketCode)
+	}
+
+	issues := v.check(set, candles)
+	if len(issues) == 0 {
+		return nil
+	}
+	err := &ValidationError{Set: set, Issues: issues}
+	if mode == util.ValidationWarn {
+		log.Warn().Err(err).Msg("Writing invalid candles")
+		return nil
+	}
+	return err
+}
+
+func (v *Validator) check(set page.CandleSetWithoutYear, candles common.CandleList) []Issue {
+	issues := make([]Issue, 0)
+	now := v.now().Unix()
+	for i, candle := range candles {
+		add := func(reason string) {
+			issues = append(issues, Issue{Index: i, Timestamp: candle.Timestamp, Reason: reason})
+		}
+		if !allFinite(candle.Open, candle.High, candle.Low, candle.Close, candle.Volume) {
+			add("NaN or infinite value")
+			continue
+		}
+		if candle.High < candle.Low {
+			add("high is lower than low")
+		} else if !within(candle.Open, candle.Low, candle.High) || !within(candle.Close, candle.Low, candle.High) {
+			add("open or close is outside of low and high")
+		}
+		if candle.Volume < 0 {
+			add("negative volume")
+		}
+		ts := candle.Timestamp.Unix()
+		if set.CandleLength > 0 && common.BucketStart(ts, set.CandleLength) != ts {
+			add(fmt.Sprintf("timestamp is not aligned to candle length %d", set.CandleLength))
+		}
+		if ts > now {
+			add("timestamp is in the future")
+		}
+	}
+	return issues
+}
+
+func allFinite(values ...float64) bool {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func within(value, low, high float64) bool {
+	return low <= value && value <= high
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jungnoh/mora/database/command"
+	"github.com/jungnoh/mora/database/util"
+	"github.com/jungnoh/mora/database/validation"
+	"github.com/jungnoh/mora/page"
+	"github.com/pkg/errors"
+)
+
+func TestValidationDefaultsToOff(t *testing.T) {
+	db := openTestDatabase(t, testConfig(t))
+	set := testSet("A")
+	candles := testCandles(testStart, 2, 10)
+	candles[1].High = candles[1].Low - 1
+
+	if _, err := db.Write(set, candles); err != nil {
+		t.Fatalf("expected invalid candles to be written without validation: %v", err)
+	}
+	expectCandles(t, readAll(t, db, set), candles)
+}
+
+func TestValidationStrictRejectsRawInsert(t *testing.T) {
+	config := testConfig(t)
+	config.Validation = util.ValidationStrict
+	db := openTestDatabase(t, config)
+	set := testSet("A")
+	candles := testCandles(testStart, 2, 10)
+	candles[1].High = candles[1].Low - 1
+
+	insert := command.NewInsertCommand(page.CandleSet{Year: 2022, CandleSetWithoutYear: set}, candles.ToTimestampCandleList(), page.ConflictOverwrite)
+	_, err := db.Execute([]command.CommandContent{&insert})
+	var validationErr *validation.ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Issues) != 1 {
+		t.Fatalf("expected a validation error with 1 issue, got %v", err)
+	}
+	if got := readAll(t, db, set); len(got) != 0 {
+		t.Fatalf("expected nothing to be written, got %v", got)
+	}
+}
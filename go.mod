@@ -3,6 +3,8 @@ module github.com/jungnoh/mora
 go 1.18
 
 require (
+	github.com/carlmjohnson/errors v0.0.7
+	github.com/gammazero/deque v0.1.1
 	github.com/ilyakaznacheev/cleanenv v1.2.6
 	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.26.1
@@ -10,8 +12,6 @@ require (
 
 require (
 	github.com/BurntSushi/toml v1.0.0 // indirect
-	github.com/carlmjohnson/errors v0.0.7 // indirect
-	github.com/gammazero/deque v0.1.1 // indirect
 	github.com/joho/godotenv v1.4.0 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
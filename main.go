@@ -30,45 +30,32 @@ func demo(cfg util.Config) {
 			for i := 0; i < 1000; i++ {
 				cds[i] = common.Candle{
 					TimelessCandle: common.TimelessCandle{
-						Open:   float64(100.0 + 5*i),
-						High:   float64(101.0 + 5*i),
-						Low:    float64(102.0 + 5*i),
-						Close:  float64(103.0 + 5*i),
+						Open:   float64(101.0 + 5*i),
+						High:   float64(103.0 + 5*i),
+						Low:    float64(100.0 + 5*i),
+						Close:  float64(102.0 + 5*i),
 						Volume: float64(104.0 + 5*i),
 					},
 					Timestamp: now.AddDate(0, 0, i),
 				}
 			}
 
-			err = db.Write(page.CandleSetWithoutYear{
+			set := page.CandleSetWithoutYear{
 				MarketCode:   "UPBIT",
 				Code:         code,
 				CandleLength: 60,
-			}, cds)
-
-			accessor, err := db.Storage.Access()
-			if err != nil {
-				panic(err)
-			}
-			targetSet := page.CandleSet{
-				Year: uint16(now.Year()),
-				CandleSetWithoutYear: page.CandleSetWithoutYear{
-					MarketCode:   "UPBIT",
-					Code:         code,
-					CandleLength: 60,
-				},
 			}
-			accessor.AddRead(targetSet)
-			if err := accessor.Start(); err != nil {
+			if _, err := db.Write(set, cds); err != nil {
 				panic(err)
 			}
 
-			_, err = accessor.Get(targetSet)
+			_, err := db.Read(set, common.TimeRange{
+				Start: now,
+				End:   now.AddDate(1, 0, 0),
+			})
 			if err != nil {
 				panic(err)
 			}
-			// fmt.Println(pg.Body)
-			accessor.Rollback()
 			log.Info().Msg("DONE")
 		}()
 	}
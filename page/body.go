@@ -3,6 +3,7 @@ package page
 import (
 	"encoding/binary"
 	"io"
+	"time"
 
 	"github.com/jungnoh/mora/common"
 )
@@ -82,3 +83,17 @@ func (p *PageBodyBlock) Write(w io.Writer) (err error) {
 func (p *PageBodyBlock) SetYear(year uint16) {
 	p.Timestamp = uint64(common.GetStartOfYearTimestamp(int(year))) + uint64(p.TimestampOffset)
 }
+
+func (p PageBodyBlock) ToCandle() common.Candle {
+	return common.Candle{
+		TimelessCandle: common.TimelessCandle{
+			Open:      p.Open,
+			High:      p.High,
+			Low:       p.Low,
+			Close:     p.Close,
+			Volume:    p.Volume,
+			BitFields: p.BitFields,
+		},
+		Timestamp: time.Unix(int64(p.Timestamp), 0).UTC(),
+	}
+}
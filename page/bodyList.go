@@ -31,6 +31,14 @@ func (c PageBodyBlockList) Less(i, j int) bool {
 	return c[i].Timestamp < c[j].Timestamp
 }
 
+func (c PageBodyBlockList) ToCandleList() common.CandleList {
+	result := make(common.CandleList, len(c))
+	for i := range c {
+		result[i] = c[i].ToCandle()
+	}
+	return result
+}
+
 func (c PageBodyBlockList) CreateIndex() (PageIndex, error) {
 	dailyCount := make(PageIndex, INDEX_COUNT)
 	index := make(PageIndex, INDEX_COUNT)
@@ -1,5 +1,7 @@
 package page
 
+import "github.com/pkg/errors"
+
 const BLOCK_WIDTH int = 48
 const INDEX_ROW_COUNT int = 31
 const HEADER_SIZE int = 60
@@ -9,3 +11,51 @@ const DATA_OFFSET int64 = int64(BLOCK_WIDTH*INDEX_ROW_COUNT + HEADER_SIZE)
 const INDEX_COUNT int = INDEX_ROW_COUNT * (BLOCK_WIDTH / 4)
 const MAX_MARKET_CODE_LENGTH int = 10
 const MAX_CODE_LENGTH int = 18
+
+type SearchMode int
+
+const (
+	// SearchExact finds the block with the exact timestamp
+	SearchExact SearchMode = 0
+	// SearchAtOrBefore finds the latest block with a timestamp not after the given one
+	SearchAtOrBefore SearchMode = 1
+)
+
+// ConflictMode decides what happens when an inserted candle has the same timestamp as an existing one.
+// Inserted candles repeating a timestamp are resolved the same way in the order given,
+// so ConflictReject also rejects an insert with duplicate timestamps of its own.
+type ConflictMode uint8
+
+const (
+	// ConflictOverwrite replaces the existing candle
+	ConflictOverwrite ConflictMode = 0
+	// ConflictKeepExisting ignores the new candle
+	ConflictKeepExisting ConflictMode = 1
+	// ConflictReject fails the insert, even if the duplicate timestamps are only within the inserted candles
+	ConflictReject ConflictMode = 2
+	// ConflictMergeOHLC keeps the existing open, takes the new close, and merges high, low and volume
+	ConflictMergeOHLC ConflictMode = 3
+)
+
+// Validate returns an error if the mode is not one of the known modes.
+func (c ConflictMode) Validate() error {
+	if c > ConflictMergeOHLC {
+		return errors.Errorf("unknown conflict mode %d", c)
+	}
+	return nil
+}
+
+func (c ConflictMode) String() string {
+	switch c {
+	case ConflictOverwrite:
+		return "OVERWRITE"
+	case ConflictKeepExisting:
+		return "KEEP_EXISTING"
+	case ConflictReject:
+		return "REJECT"
+	case ConflictMergeOHLC:
+		return "MERGE_OHLC"
+	default:
+		return "UNKNOWN"
+	}
+}
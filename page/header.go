@@ -11,7 +11,11 @@ import (
 )
 
 type PageHeader struct {
-	LastTxId     uint64
+	// LastSeq is the commit sequence number of the last transaction applied to the page.
+	// Unlike transaction ids, it follows the order transactions commit in.
+	// It is stored where the last transaction id was, and both are taken from the same counter,
+	// so pages written before sequence numbers were added compare correctly against them.
+	LastSeq      uint64
 	MarketCode   string
 	Year         uint16
 	CandleLength uint32
@@ -39,7 +43,7 @@ func (p *PageHeader) Read(size uint32, r io.Reader) error {
 	p.Count = binary.LittleEndian.Uint32(headerBin[12:16])
 	p.StartOffset = binary.LittleEndian.Uint32(headerBin[16:20])
 	p.EndOffset = binary.LittleEndian.Uint32(headerBin[20:24])
-	p.LastTxId = binary.LittleEndian.Uint64(headerBin[24:32])
+	p.LastSeq = binary.LittleEndian.Uint64(headerBin[24:32])
 	p.MarketCode = common.ReadNullPaddedString(headerBin[32:42])
 	p.Code = common.ReadNullPaddedString(headerBin[42:60])
 	p.Index = make([]uint32, INDEX_COUNT)
@@ -84,7 +88,7 @@ func (p *PageHeader) Write(w io.Writer) error {
 	if err := binary.Write(w, binary.LittleEndian, p.EndOffset); err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.LittleEndian, p.LastTxId); err != nil {
+	if err := binary.Write(w, binary.LittleEndian, p.LastSeq); err != nil {
 		return err
 	}
 	if err := common.WriteNullPaddedString(MAX_MARKET_CODE_LENGTH, p.MarketCode, w); err != nil {
@@ -105,6 +109,16 @@ func (p *PageHeader) Write(w io.Writer) error {
 	return nil
 }
 
+// Copy returns a copy of the header. The index is copied as well, as appending blocks changes it in place.
+func (p PageHeader) Copy() PageHeader {
+	copied := p
+	if p.Index != nil {
+		copied.Index = make(PageIndex, len(p.Index))
+		copy(copied.Index, p.Index)
+	}
+	return copied
+}
+
 // Utility methods
 func (p PageHeader) TimestampInPageRange(ts int64) bool {
 	start := common.GetStartOfYearTimestamp(int(p.Year))
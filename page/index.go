@@ -27,6 +27,10 @@ type CandleSet struct {
 	Year uint16
 }
 
+func (p CandleSetWithoutYear) UniqueKey() string {
+	return fmt.Sprintf("%s^%s^%d", p.MarketCode, p.Code, p.CandleLength)
+}
+
 func (p CandleSet) IsZero() bool {
 	return p.Year == 0
 }
@@ -37,3 +41,18 @@ func (p CandleSet) UniqueKey() string {
 	}
 	return fmt.Sprintf("%s^%s^%d^%d", p.MarketCode, p.Code, p.CandleLength, p.Year)
 }
+
+// DayBounds returns the range [start, end) of body positions holding blocks of the given day.
+func (p PageIndex) DayBounds(day int, count uint32) (start, end uint32) {
+	if day < 0 || day >= len(p) {
+		return count, count
+	}
+	start, end = p[day], count
+	if day+1 < len(p) && p[day+1] < end {
+		end = p[day+1]
+	}
+	if start > end {
+		start = end
+	}
+	return
+}
@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"time"
 
 	"github.com/jungnoh/mora/common"
 	"github.com/pkg/errors"
 )
 
+var ErrDuplicateTimestamp = errors.New("duplicate candle timestamp")
+
 type Page struct {
 	Header PageHeader
 	Body   PageBodyBlockList
@@ -35,7 +38,7 @@ func (p *Page) Copy() Page {
 	copiedBody := make(PageBodyBlockList, len(p.Body))
 	copy(copiedBody, p.Body)
 	return Page{
-		Header: p.Header,
+		Header: p.Header.Copy(),
 		Body:   copiedBody,
 	}
 }
@@ -58,11 +61,11 @@ func (p *Page) Read(_ uint32, r io.Reader) error {
 	return nil
 }
 
-func (p *Page) Add(candles common.CandleList) error {
+func (p *Page) Add(candles common.CandleList, mode ConflictMode) error {
 	if len(candles) == 0 {
 		return nil
 	}
-	sort.Sort(candles)
+	sort.Stable(candles)
 	firstInRange := p.Header.TimestampInPageRange(candles[0].Timestamp.Unix())
 	lastInRange := p.Header.TimestampInPageRange(candles[len(candles)-1].Timestamp.Unix())
 
@@ -70,15 +73,22 @@ func (p *Page) Add(candles common.CandleList) error {
 		return errors.New("candle timestamp is not in range")
 	}
 
-	if !candles[0].Timestamp.Before(p.Header.GetFirstTime()) {
-		return p.append(candles)
+	blocks, err := resolveConflicts(NewPageBodyBlockList(p.Header.Year, candles), mode)
+	if err != nil {
+		return err
+	}
+	// Candles can only be appended if all of them are after the last block
+	if p.Header.Count == 0 || int64(blocks[0].Timestamp) > p.Header.GetLastTimestamp() {
+		return p.append(blocks)
 	} else {
-		return p.merge(candles)
+		return p.merge(blocks, mode)
 	}
 }
 
-func (p *Page) append(candles common.CandleList) error {
-	blocks := NewPageBodyBlockList(p.Header.Year, candles)
+func (p *Page) append(blocks PageBodyBlockList) error {
+	if p.Header.Count == 0 {
+		p.Header.StartOffset = blocks[0].TimestampOffset
+	}
 	p.Header.Count += uint32(len(blocks))
 	p.Header.EndOffset = blocks[len(blocks)-1].TimestampOffset
 
@@ -92,16 +102,7 @@ func (p *Page) append(candles common.CandleList) error {
 	return nil
 }
 
-func (p *Page) merge(candles common.CandleList) error {
-	blocks := NewPageBodyBlockList(p.Header.Year, candles)
-	if newStartOffset := blocks[0].TimestampOffset; newStartOffset < p.Header.StartOffset {
-		p.Header.StartOffset = newStartOffset
-	}
-	if newEndOffset := blocks[len(blocks)-1].TimestampOffset; newEndOffset > p.Header.EndOffset {
-		p.Header.EndOffset = newEndOffset
-	}
-
-	dailyCounts := make(PageIndex, INDEX_COUNT)
+func (p *Page) merge(blocks PageBodyBlockList, mode ConflictMode) error {
 	newBody := make(PageBodyBlockList, 0, len(p.Body)+len(blocks))
 	oldIndex, newIndex := 0, 0
 	for oldIndex < len(p.Body) && newIndex < len(blocks) {
@@ -109,36 +110,108 @@ func (p *Page) merge(candles common.CandleList) error {
 		newOffset := blocks[newIndex].TimestampOffset
 		if oldOffset < newOffset {
 			newBody = append(newBody, p.Body[oldIndex])
-			dailyCounts[oldOffset/86400]++
 			oldIndex++
 		} else if oldOffset > newOffset {
 			newBody = append(newBody, blocks[newIndex])
-			dailyCounts[newOffset/86400]++
 			newIndex++
 		} else {
-			newBody = append(newBody, blocks[newIndex])
-			dailyCounts[newOffset/86400]++
+			resolved, err := resolveConflict(p.Body[oldIndex], blocks[newIndex], mode)
+			if err != nil {
+				return err
+			}
+			newBody = append(newBody, resolved)
 			newIndex++
 			oldIndex++
 		}
 	}
-	for oldIndex < len(p.Body) {
-		newBody = append(newBody, p.Body[oldIndex])
-		dailyCounts[p.Body[oldIndex].TimestampOffset/86400]++
-		oldIndex++
+	newBody = append(newBody, p.Body[oldIndex:]...)
+	newBody = append(newBody, blocks[newIndex:]...)
+
+	p.setBody(newBody)
+	return nil
+}
+
+// resolveConflicts folds blocks with the same timestamp in a sorted list, the later one being the new block.
+func resolveConflicts(blocks PageBodyBlockList, mode ConflictMode) (PageBodyBlockList, error) {
+	result := make(PageBodyBlockList, 0, len(blocks))
+	for _, block := range blocks {
+		last := len(result) - 1
+		if last >= 0 && result[last].TimestampOffset == block.TimestampOffset {
+			resolved, err := resolveConflict(result[last], block, mode)
+			if err != nil {
+				return PageBodyBlockList{}, err
+			}
+			result[last] = resolved
+			continue
+		}
+		result = append(result, block)
 	}
-	for newIndex < len(blocks) {
-		newBody = append(newBody, blocks[newIndex])
-		dailyCounts[blocks[newIndex].TimestampOffset/86400]++
-		newIndex++
+	return result, nil
+}
+
+func resolveConflict(existing, new PageBodyBlock, mode ConflictMode) (PageBodyBlock, error) {
+	switch mode {
+	case ConflictOverwrite:
+		return new, nil
+	case ConflictKeepExisting:
+		return existing, nil
+	case ConflictReject:
+		return existing, errors.Wrapf(ErrDuplicateTimestamp, "candle at %s", new.ToCandle().Timestamp)
+	case ConflictMergeOHLC:
+		merged := existing
+		if new.High > merged.High {
+			merged.High = new.High
+		}
+		if new.Low < merged.Low {
+			merged.Low = new.Low
+		}
+		merged.Close = new.Close
+		merged.Volume += new.Volume
+		merged.BitFields |= new.BitFields
+		return merged, nil
 	}
+	return existing, errors.Errorf("unknown conflict mode %d", mode)
+}
+
+// DeleteRange removes blocks with timestamps in [start, end), returning the number of removed blocks.
+// The index, offsets and count of the header are rebuilt.
+func (p *Page) DeleteRange(start, end int64) int {
+	removed := p.Slice(start, end)
+	if len(removed) == 0 {
+		return 0
+	}
+	from := p.SearchOffset(removed[0].TimestampOffset)
+	to := from + len(removed)
+
+	newBody := make(PageBodyBlockList, 0, len(p.Body)-len(removed))
+	newBody = append(newBody, p.Body[:from]...)
+	newBody = append(newBody, p.Body[to:]...)
+	p.setBody(newBody)
+	return len(removed)
+}
+
+// Clear removes all blocks, returning the number of removed blocks.
+func (p *Page) Clear() int {
+	removed := len(p.Body)
+	p.setBody(PageBodyBlockList{})
+	return removed
+}
 
+// setBody replaces the body, rebuilding the header to match it.
+func (p *Page) setBody(body PageBodyBlockList) {
+	dailyCounts := make(PageIndex, INDEX_COUNT)
+	for _, block := range body {
+		dailyCounts[block.TimestampOffset/86400]++
+	}
 	p.Header.Index = make(PageIndex, INDEX_COUNT)
 	p.Header.Index.ApplyDailyCount(dailyCounts)
-	p.Body = newBody
-	p.Header.Count = uint32(len(newBody))
-
-	return nil
+	p.Header.Count = uint32(len(body))
+	p.Header.StartOffset, p.Header.EndOffset = 0, 0
+	if len(body) > 0 {
+		p.Header.StartOffset = body[0].TimestampOffset
+		p.Header.EndOffset = body[len(body)-1].TimestampOffset
+	}
+	p.Body = body
 }
 
 func (p Page) UniqueKey() string {
@@ -147,3 +220,95 @@ func (p Page) UniqueKey() string {
 	}
 	return fmt.Sprintf("%s^%s^%d^%d", p.Header.MarketCode, p.Header.Code, p.Header.CandleLength, p.Header.Year)
 }
+
+// SearchOffset returns the position of the first block whose TimestampOffset is not less than offset.
+// The page index is used to narrow the search down to a single day.
+func (p *Page) SearchOffset(offset uint32) int {
+	day := int(offset / 86400)
+	start, end := p.Header.Index.DayBounds(day, uint32(len(p.Body)))
+	if len(p.Header.Index) == 0 {
+		start, end = 0, uint32(len(p.Body))
+	}
+	lo, hi := int(start), int(end)
+	return lo + sort.Search(hi-lo, func(i int) bool {
+		return p.Body[lo+i].TimestampOffset >= offset
+	})
+}
+
+// Search looks up a block by its TimestampOffset.
+func (p *Page) Search(offset uint32, mode SearchMode) (PageBodyBlock, bool) {
+	if mode == SearchAtOrBefore {
+		position := p.SearchOffset(offset+1) - 1
+		if position < 0 {
+			return PageBodyBlock{}, false
+		}
+		return p.Body[position], true
+	}
+	position := p.SearchOffset(offset)
+	if position < len(p.Body) && p.Body[position].TimestampOffset == offset {
+		return p.Body[position], true
+	}
+	return PageBodyBlock{}, false
+}
+
+// Slice returns the blocks with timestamps in [start, end).
+// The returned list shares memory with the page body.
+func (p *Page) Slice(start, end int64) PageBodyBlockList {
+	yearStart := common.GetStartOfYearTimestamp(int(p.Header.Year))
+	yearEnd := common.GetStartOfYearTimestamp(int(p.Header.Year) + 1)
+	if start < yearStart {
+		start = yearStart
+	}
+	if end > yearEnd {
+		end = yearEnd
+	}
+	if start >= end {
+		return PageBodyBlockList{}
+	}
+	from := p.SearchOffset(uint32(start - yearStart))
+	to := len(p.Body)
+	if end < yearEnd {
+		to = p.SearchOffset(uint32(end - yearStart))
+	}
+	return p.Body[from:to]
+}
+
+// Tail returns the last n blocks of the page.
+// The returned list shares memory with the page body.
+func (p *Page) Tail(n int) PageBodyBlockList {
+	if n >= len(p.Body) {
+		return p.Body
+	}
+	if n <= 0 {
+		return PageBodyBlockList{}
+	}
+	return p.Body[len(p.Body)-n:]
+}
+
+// UpdateLast applies a partial update to the last block if it is at offset, or starts a new block at offset after it.
+// Blocks before the last one can not be updated.
+// An update in place keeps the flags of the block, and leaves the header unchanged since the offset and count stay the same.
+func (p *Page) UpdateLast(offset uint32, update common.CandleUpdate) error {
+	if p.Header.Count > 0 {
+		last := &p.Body[len(p.Body)-1]
+		if offset < last.TimestampOffset {
+			return errors.Errorf("offset %d is before the last candle (offset %d)", offset, last.TimestampOffset)
+		}
+		if offset == last.TimestampOffset {
+			candle := update.Apply(last.ToCandle().TimelessCandle)
+			last.Open, last.High, last.Low = candle.Open, candle.High, candle.Low
+			last.Close, last.Volume = candle.Close, candle.Volume
+			return nil
+		}
+	}
+	candle, ok := update.NewCandle()
+	if !ok {
+		return errors.New("close is required to start a new candle")
+	}
+	ts := common.GetStartOfYearTimestamp(int(p.Header.Year)) + int64(offset)
+	if !p.Header.TimestampInPageRange(ts) {
+		return errors.New("candle timestamp is not in range")
+	}
+	block := NewPageBodyBlock(p.Header.Year, common.Candle{TimelessCandle: candle, Timestamp: time.Unix(ts, 0)})
+	return p.append(PageBodyBlockList{block})
+}
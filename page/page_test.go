@@ -0,0 +1,151 @@
+package page
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jungnoh/mora/common"
+	"github.com/pkg/errors"
+)
+
+var testCandleSet = CandleSet{Year: 2022, CandleSetWithoutYear: CandleSetWithoutYear{MarketCode: "TEST", Code: "A", CandleLength: 60}}
+
+func candleAt(minute int, open, high, low, close, volume float64) common.Candle {
+	return common.Candle{
+		Timestamp:      time.Date(2022, 3, 1, 0, minute, 0, 0, time.UTC),
+		TimelessCandle: common.TimelessCandle{Open: open, High: high, Low: low, Close: close, Volume: volume},
+	}
+}
+
+func TestAddConflictModes(t *testing.T) {
+	existing := candleAt(1, 10, 12, 9, 11, 5)
+	added := candleAt(1, 20, 25, 8, 21, 3)
+	cases := []struct {
+		mode     ConflictMode
+		expected common.TimelessCandle
+	}{
+		{ConflictOverwrite, added.TimelessCandle},
+		{ConflictKeepExisting, existing.TimelessCandle},
+		{ConflictMergeOHLC, common.TimelessCandle{Open: 10, High: 25, Low: 8, Close: 21, Volume: 8}},
+	}
+	for _, c := range cases {
+		t.Run(c.mode.String(), func(t *testing.T) {
+			p := NewPage(testCandleSet)
+			if err := p.Add(common.CandleList{candleAt(0, 1, 1, 1, 1, 1), existing, candleAt(2, 1, 1, 1, 1, 1)}, c.mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Add(common.CandleList{added}, c.mode); err != nil {
+				t.Fatal(err)
+			}
+			if p.Header.Count != 3 {
+				t.Fatalf("expected 3 candles, got %d", p.Header.Count)
+			}
+			if got := p.Body[1].ToCandle().TimelessCandle; got != c.expected {
+				t.Errorf("expected %+v, got %+v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestAddConflictReject(t *testing.T) {
+	p := NewPage(testCandleSet)
+	if err := p.Add(common.CandleList{candleAt(1, 10, 12, 9, 11, 5)}, ConflictReject); err != nil {
+		t.Fatal(err)
+	}
+	err := p.Add(common.CandleList{candleAt(0, 1, 1, 1, 1, 1), candleAt(1, 20, 25, 8, 21, 3)}, ConflictReject)
+	if errors.Cause(err) != ErrDuplicateTimestamp {
+		t.Fatalf("expected duplicate timestamp error, got %v", err)
+	}
+	if p.Header.Count != 1 || p.Body[0].Open != 10 {
+		t.Errorf("expected the page to be unchanged, got %d candles", p.Header.Count)
+	}
+}
+
+func TestAddDuplicatesWithinInsert(t *testing.T) {
+	first := candleAt(1, 10, 12, 9, 11, 5)
+	second := candleAt(1, 20, 25, 8, 21, 3)
+	cases := []struct {
+		mode     ConflictMode
+		expected common.TimelessCandle
+	}{
+		{ConflictOverwrite, second.TimelessCandle},
+		{ConflictKeepExisting, first.TimelessCandle},
+		{ConflictMergeOHLC, common.TimelessCandle{Open: 10, High: 25, Low: 8, Close: 21, Volume: 8}},
+	}
+	for _, c := range cases {
+		t.Run(c.mode.String(), func(t *testing.T) {
+			p := NewPage(testCandleSet)
+			if err := p.Add(common.CandleList{first, second}, c.mode); err != nil {
+				t.Fatal(err)
+			}
+			if p.Header.Count != 1 {
+				t.Fatalf("expected 1 candle, got %d", p.Header.Count)
+			}
+			if got := p.Body[0].ToCandle().TimelessCandle; got != c.expected {
+				t.Errorf("expected %+v, got %+v", c.expected, got)
+			}
+		})
+	}
+
+	p := NewPage(testCandleSet)
+	if err := p.Add(common.CandleList{first, second}, ConflictReject); errors.Cause(err) != ErrDuplicateTimestamp {
+		t.Fatalf("expected duplicates within the insert to be rejected, got %v", err)
+	}
+}
+
+func TestUpdateLastKeepsPageConsistent(t *testing.T) {
+	first := candleAt(1, 10, 12, 9, 11, 5)
+	last := candleAt(2, 11, 13, 10, 12, 2)
+	last.BitFields = uint32(common.FlagIncomplete)
+
+	p := NewPage(testCandleSet)
+	if err := p.Add(common.CandleList{first, last}, ConflictReject); err != nil {
+		t.Fatal(err)
+	}
+	offset := p.Body[1].TimestampOffset
+	if err := p.UpdateLast(offset, common.CandleUpdate{Fields: common.UpdateClose | common.UpdateVolume, Close: 14, Volume: 4}); err != nil {
+		t.Fatal(err)
+	}
+	next := candleAt(3, 0, 0, 0, 0, 0)
+	nextOffset := uint32(next.Timestamp.Unix() - common.GetStartOfYearTimestamp(2022))
+	if err := p.UpdateLast(nextOffset, common.CandleUpdate{Fields: common.UpdateClose, Close: 15}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The in-place update keeps the flags of the block, and the new block has none.
+	updated := candleAt(2, 11, 14, 10, 14, 4)
+	updated.BitFields = last.BitFields
+	next.TimelessCandle = common.TimelessCandle{Open: 15, High: 15, Low: 15, Close: 15}
+	expected := NewPage(testCandleSet)
+	if err := expected.Add(common.CandleList{first, updated, next}, ConflictReject); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Header, expected.Header) {
+		t.Errorf("expected header %+v, got %+v", expected.Header, p.Header)
+	}
+	if !reflect.DeepEqual(p.Body, expected.Body) {
+		t.Errorf("expected body %+v, got %+v", expected.Body, p.Body)
+	}
+}
+
+func TestAddMergesCandlesBeforeTheLastOne(t *testing.T) {
+	p := NewPage(testCandleSet)
+	if err := p.Add(common.CandleList{candleAt(5, 1, 1, 1, 1, 1)}, ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	if expected := p.Body[0].TimestampOffset; p.Header.StartOffset != expected {
+		t.Errorf("expected the start offset of the first candle %d, got %d", expected, p.Header.StartOffset)
+	}
+	if err := p.Add(common.CandleList{candleAt(10, 2, 2, 2, 2, 1)}, ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	// Candles after the first one but before the last one are merged, not appended
+	if err := p.Add(common.CandleList{candleAt(7, 3, 3, 3, 3, 1), candleAt(10, 4, 4, 4, 4, 1)}, ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	expected := common.CandleList{candleAt(5, 1, 1, 1, 1, 1), candleAt(7, 3, 3, 3, 3, 1), candleAt(10, 4, 4, 4, 4, 1)}
+	if got := p.Body.ToCandleList(); !reflect.DeepEqual(got, expected) || p.Header.Count != 3 {
+		t.Errorf("expected %v, got %v (count %d)", expected, got, p.Header.Count)
+	}
+}